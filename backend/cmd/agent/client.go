@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"backend/internal/models"
+)
+
+var errUnauthorized = errors.New("unauthorized")
+
+// client talks to the Qprint API as a shopkeeper
+type client struct {
+	baseURL  string
+	username string
+	password string
+	token    string
+	http     *http.Client
+}
+
+func newClient(baseURL, username, password string) *client {
+	return &client{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		username: username,
+		password: password,
+		http:     &http.Client{Timeout: 2 * time.Minute},
+	}
+}
+
+func (c *client) login(ctx context.Context) error {
+	body, _ := json.Marshal(models.LoginRequest{Username: c.username, Password: c.password})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/login", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("login failed: HTTP %d", resp.StatusCode)
+	}
+
+	var login models.LoginResponse
+	if err := json.NewDecoder(resp.Body).Decode(&login); err != nil {
+		return err
+	}
+	if login.Role != "shopkeeper" {
+		return fmt.Errorf("user %s is not a shopkeeper", c.username)
+	}
+	c.token = login.Token
+	return nil
+}
+
+// do sends an authenticated request, logging in again once if the token has expired
+func (c *client) do(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		var payload io.Reader
+		if body != nil {
+			b, _ := json.Marshal(body)
+			payload = bytes.NewReader(b)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, payload)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			resp.Body.Close()
+			if err := c.login(ctx); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if resp.StatusCode == http.StatusUnauthorized {
+			resp.Body.Close()
+			return nil, errUnauthorized
+		}
+		if resp.StatusCode >= 300 {
+			msg, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return nil, fmt.Errorf("%s %s: HTTP %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(msg)))
+		}
+		return resp, nil
+	}
+}
+
+func (c *client) queue(ctx context.Context) ([]models.QueueFile, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/queue", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Queue []models.QueueFile `json:"queue"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	return body.Queue, nil
+}
+
+// download saves a queued job's document to a temporary file. The server
+// moves the job to "printing" when it is downloaded.
+func (c *client) download(ctx context.Context, fileID int) (string, error) {
+	resp, err := c.do(ctx, http.MethodGet, fmt.Sprintf("/queue/download/%d", fileID), nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	tmp, err := os.CreateTemp("", "qprint-agent-*.pdf")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), tmp.Close()
+}
+
+func (c *client) post(ctx context.Context, path string, body interface{}) error {
+	resp, err := c.do(ctx, http.MethodPost, path, body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (c *client) progress(ctx context.Context, fileID int, message string) error {
+	return c.post(ctx, fmt.Sprintf("/queue/%d/progress", fileID), map[string]string{"message": message})
+}
+
+func (c *client) fail(ctx context.Context, fileID int, reason string) error {
+	return c.post(ctx, fmt.Sprintf("/queue/%d/fail", fileID), map[string]string{"reason": reason})
+}
+
+func (c *client) confirm(ctx context.Context, fileID int) error {
+	return c.post(ctx, fmt.Sprintf("/queue/%d/confirm", fileID), nil)
+}
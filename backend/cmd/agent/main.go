@@ -0,0 +1,182 @@
+// Command agent is the shop print agent. It logs in as a shopkeeper, watches
+// the shop queue and prints jobs in queue order on a configured printer,
+// confirming each job only after the printer reports success.
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/printer"
+
+	"github.com/joho/godotenv"
+)
+
+func getenv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func main() {
+	if err := godotenv.Load("agent.env"); err != nil {
+		log.Println("No agent.env file found, using environment variables")
+	}
+
+	apiURL := getenv("QPRINT_API_URL", "http://localhost:8080")
+	username := os.Getenv("AGENT_USERNAME")
+	password := os.Getenv("AGENT_PASSWORD")
+	if username == "" || password == "" {
+		log.Fatal("AGENT_USERNAME and AGENT_PASSWORD must be set")
+	}
+
+	// PRINTER_TARGET is an ipp:// URI, host:9100, a CUPS destination or a directory
+	p, err := printer.New(getenv("PRINTER_BACKEND", "dir"), getenv("PRINTER_TARGET", "printed"))
+	if err != nil {
+		log.Fatalf("Invalid printer configuration: %v", err)
+	}
+
+	interval, err := time.ParseDuration(getenv("AGENT_POLL_INTERVAL", "5s"))
+	if err != nil {
+		log.Fatalf("Invalid AGENT_POLL_INTERVAL: %v", err)
+	}
+
+	state := stateFile(getenv("AGENT_STATE_FILE", "agent-state.json"))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c := newClient(apiURL, username, password)
+	if err := c.login(ctx); err != nil {
+		log.Fatalf("Failed to log in: %v", err)
+	}
+	log.Printf("Print agent running for %s against %s", username, apiURL)
+
+	for ctx.Err() == nil {
+		printed, err := printNext(ctx, c, p, state)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Agent error: %v", err)
+		}
+		if printed && err == nil {
+			// The queue may have changed while printing, so look again straight away
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(interval):
+		}
+	}
+	log.Println("Print agent stopped")
+}
+
+// printNext prints the first job waiting in the queue. It reports whether a job was attempted.
+// A job left unfinished by an earlier attempt or run is finished first.
+func printNext(ctx context.Context, c *client, p printer.Printer, state stateFile) (bool, error) {
+	queue, err := c.queue(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if unfinished, err := state.load(); err != nil {
+		return false, err
+	} else if unfinished != nil {
+		return true, finish(ctx, c, state, queue, *unfinished)
+	}
+
+	var job *models.QueueFile
+	for i := range queue {
+		// Jobs already printing were started by someone else; held jobs wait for the shopkeeper
+		if queue[i].Status == "queued" && !queue[i].OnHold {
+			job = &queue[i]
+			break
+		}
+	}
+	if job == nil {
+		return false, nil
+	}
+
+	// Recorded before downloading, which starts printing on the server
+	if err := state.save(current{FileID: job.ID}); err != nil {
+		return false, err
+	}
+
+	log.Printf("Printing job %d (%s)", job.ID, job.Filename)
+	path, err := c.download(ctx, job.ID)
+	if err != nil {
+		log.Printf("Job %d download failed: %v", job.ID, err)
+		return true, fail(ctx, c, state, job.ID, "download failed: "+err.Error())
+	}
+	defer os.Remove(path)
+
+	c.progress(ctx, job.ID, "sent to printer")
+
+	err = p.Print(ctx, printer.Job{
+		ID:        job.ID,
+		Name:      job.Filename,
+		Copies:    job.Copies,
+		Duplex:    job.PrintMode == "double",
+		Color:     job.ColorMode == "color",
+		PaperSize: job.PaperSize,
+	}, path)
+	if err != nil {
+		log.Printf("Job %d failed: %v", job.ID, err)
+		return true, fail(ctx, c, state, job.ID, err.Error())
+	}
+
+	if err := state.save(current{FileID: job.ID, Printed: true}); err != nil {
+		return true, err
+	}
+	if err := c.confirm(ctx, job.ID); err != nil {
+		return true, err
+	}
+	log.Printf("Job %d printed", job.ID)
+	return true, state.clear()
+}
+
+// fail reports a job the agent could not print and forgets it. If the
+// report does not get through, the job stays recorded and is failed again
+// on the next attempt.
+func fail(ctx context.Context, c *client, state stateFile, fileID int, reason string) error {
+	if ctx.Err() != nil {
+		// Shutting down: report with a fresh context so the job does not stay "printing"
+		ctx = context.Background()
+	}
+	if err := c.fail(ctx, fileID, reason); err != nil {
+		return err
+	}
+	return state.clear()
+}
+
+// finish settles a job the agent started but did not see through, after a
+// failed report or a restart. A job the printer completed is confirmed.
+// Otherwise it is failed rather than printed again, as the printer may
+// have printed some or all of it; the shopkeeper can retry it.
+func finish(ctx context.Context, c *client, state stateFile, queue []models.QueueFile, job current) error {
+	printing := false
+	for _, q := range queue {
+		if q.ID == job.FileID {
+			printing = q.Status == "printing"
+		}
+	}
+	if !printing {
+		// Never started, or already settled on the server
+		return state.clear()
+	}
+
+	if job.Printed {
+		log.Printf("Confirming job %d printed before the agent stopped", job.FileID)
+		if err := c.confirm(ctx, job.FileID); err != nil {
+			return err
+		}
+		return state.clear()
+	}
+	log.Printf("Failing job %d left printing when the agent stopped", job.FileID)
+	return fail(ctx, c, state, job.FileID, "print agent stopped while printing; check the printer before retrying")
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"backend/internal/models"
+	"backend/internal/printer"
+)
+
+// fakeAPI serves the part of the Qprint API the agent uses for one shop
+type fakeAPI struct {
+	mu        sync.Mutex
+	queue     []models.QueueFile
+	document  []byte // served by downloads; nil fails them after the job starts printing
+	confirmed []int
+	failed    map[int]string
+}
+
+func (a *fakeAPI) setStatus(id int, status string) {
+	for i := range a.queue {
+		if a.queue[i].ID == id {
+			a.queue[i].Status = status
+		}
+	}
+}
+
+func (a *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var id int
+	switch {
+	case r.URL.Path == "/login":
+		json.NewEncoder(w).Encode(models.LoginResponse{Token: "token", Role: "shopkeeper"})
+	case r.URL.Path == "/queue":
+		json.NewEncoder(w).Encode(map[string]any{"queue": a.queue})
+	case scan(r.URL.Path, "/queue/download/%d", &id):
+		a.setStatus(id, "printing")
+		if a.document == nil {
+			http.Error(w, "storage unavailable", http.StatusInternalServerError)
+			return
+		}
+		w.Write(a.document)
+	case scan(r.URL.Path, "/queue/%d/progress", &id):
+	case scan(r.URL.Path, "/queue/%d/confirm", &id):
+		a.confirmed = append(a.confirmed, id)
+		a.setStatus(id, "printed")
+	case scan(r.URL.Path, "/queue/%d/fail", &id):
+		var body struct{ Reason string }
+		json.NewDecoder(r.Body).Decode(&body)
+		a.failed[id] = body.Reason
+		a.setStatus(id, "failed")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// scan matches path against a pattern with one %d
+func scan(path, pattern string, id *int) bool {
+	prefix, suffix, _ := strings.Cut(pattern, "%d")
+	rest, ok := strings.CutPrefix(path, prefix)
+	if !ok {
+		return false
+	}
+	rest, ok = strings.CutSuffix(rest, suffix)
+	if !ok {
+		return false
+	}
+	n, err := strconv.Atoi(rest)
+	*id = n
+	return err == nil
+}
+
+func newAgentTest(t *testing.T, queue ...models.QueueFile) (*fakeAPI, *client, printer.Printer, stateFile) {
+	api := &fakeAPI{queue: queue, document: []byte("%PDF-1.7"), failed: map[int]string{}}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	p, err := printer.New("dir", filepath.Join(dir, "printed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newClient(server.URL, "shop", "secret")
+	if err := c.login(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return api, c, p, stateFile(filepath.Join(dir, "agent-state.json"))
+}
+
+func TestPrintNext(t *testing.T) {
+	api, c, p, state := newAgentTest(t,
+		models.QueueFile{ID: 1, Status: "printing", Filename: "by-hand.pdf", Copies: 1},
+		models.QueueFile{ID: 2, Status: "queued", Filename: "next.pdf", Copies: 1})
+
+	printed, err := printNext(context.Background(), c, p, state)
+	if err != nil || !printed {
+		t.Fatalf("printNext: %v, %v", printed, err)
+	}
+	if len(api.confirmed) != 1 || api.confirmed[0] != 2 {
+		t.Errorf("confirmed %v, want [2]; a job printing by hand is left alone", api.confirmed)
+	}
+	if job, _ := state.load(); job != nil {
+		t.Errorf("state still records %+v", job)
+	}
+}
+
+func TestPrintNextDownloadFails(t *testing.T) {
+	api, c, p, state := newAgentTest(t, models.QueueFile{ID: 7, Status: "queued", Filename: "a.pdf", Copies: 1})
+	api.document = nil
+
+	if _, err := printNext(context.Background(), c, p, state); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(api.failed[7], "download failed") {
+		t.Errorf("job failed with %q, want a download failure", api.failed[7])
+	}
+	if job, _ := state.load(); job != nil {
+		t.Errorf("state still records %+v", job)
+	}
+}
+
+func TestPrintNextAfterRestart(t *testing.T) {
+	tests := []struct {
+		name          string
+		left          current
+		wantConfirmed bool
+	}{
+		{"stopped while printing", current{FileID: 3}, false},
+		{"stopped before confirming", current{FileID: 3, Printed: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, c, p, state := newAgentTest(t,
+				models.QueueFile{ID: 3, Status: "printing", Filename: "left.pdf", Copies: 1},
+				models.QueueFile{ID: 4, Status: "queued", Filename: "next.pdf", Copies: 1})
+			if err := state.save(tt.left); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := printNext(context.Background(), c, p, state); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantConfirmed {
+				if len(api.confirmed) != 1 || api.confirmed[0] != 3 {
+					t.Errorf("confirmed %v, want [3]", api.confirmed)
+				}
+			} else if _, ok := api.failed[3]; !ok || len(api.confirmed) != 0 {
+				t.Errorf("failed %v, confirmed %v; want job 3 failed", api.failed, api.confirmed)
+			}
+
+			// The next round prints the next job
+			if _, err := printNext(context.Background(), c, p, state); err != nil {
+				t.Fatal(err)
+			}
+			if api.confirmed[len(api.confirmed)-1] != 4 {
+				t.Errorf("confirmed %v, want job 4 last", api.confirmed)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// current is the job the agent is working on
+type current struct {
+	FileID int `json:"file_id"`
+	// Printed is set once the printer reported the job completed, so only
+	// the confirmation is left
+	Printed bool `json:"printed"`
+}
+
+// stateFile remembers the job the agent is working on across restarts. A
+// job is recorded before it is downloaded and forgotten once the server has
+// been told how it ended, so a job the agent left "printing" can always be
+// told apart from one the shopkeeper is printing by hand.
+type stateFile string
+
+// load returns the job being worked on, or nil if there is none
+func (s stateFile) load() (*current, error) {
+	data, err := os.ReadFile(string(s))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var job current
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s stateFile) save(job current) error {
+	data, _ := json.Marshal(job)
+	tmp := string(s) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, string(s))
+}
+
+func (s stateFile) clear() error {
+	err := os.Remove(string(s))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
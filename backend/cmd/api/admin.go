@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"backend/internal/auth"
+	"backend/internal/database"
+)
+
+const createAdminUsage = `Usage: api create-admin <username> <password>
+
+Creates an admin account, or promotes an existing account to admin and
+resets its password.`
+
+// runCreateAdmin handles the "create-admin" subcommand. Admin accounts cannot
+// be created through POST /register.
+func runCreateAdmin(args []string) {
+	if len(args) != 2 || args[0] == "" || args[1] == "" {
+		fmt.Println(createAdminUsage)
+		os.Exit(2)
+	}
+
+	hashedPassword, err := auth.HashPassword(args[1])
+	if err != nil {
+		log.Fatalf("Failed to hash password: %v", err)
+	}
+
+	var userID int
+	err = database.DB.QueryRow(context.Background(),
+		`INSERT INTO users (username, password_hash, role) VALUES ($1, $2, $3)
+		 ON CONFLICT (username) DO UPDATE
+		 SET password_hash = EXCLUDED.password_hash, role = EXCLUDED.role,
+		     suspended_at = NULL, suspension_reason = NULL, token_generation = users.token_generation + 1
+		 RETURNING id`,
+		args[0], hashedPassword, auth.RoleAdmin).Scan(&userID)
+	if err != nil {
+		log.Fatalf("Failed to create admin: %v", err)
+	}
+
+	fmt.Printf("Admin %s ready (user ID %d)\n", args[0], userID)
+}
@@ -1,80 +1,114 @@
-package main
-
-import (
-	"fmt"
-	"log"
-	"net/http"
-	"os"
-
-	"backend/internal/auth"
-	"backend/internal/database"
-	"backend/internal/handlers"
-
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/cors"
-	"github.com/joho/godotenv"
-)
-
-func main() {
-	// Force load .env file and OVERRIDE any existing environment variables
-	if err := godotenv.Overload(".env"); err != nil {
-		if err := godotenv.Overload("backend/.env"); err != nil {
-			log.Println("No .env file found, using environment variables")
-		} else {
-			log.Println("Loaded and OVERRODE env vars from backend/.env")
-		}
-	} else {
-		log.Println("Loaded and OVERRODE env vars from current directory")
-	}
-
-	log.Printf("DEBUG: DATABASE_URL from env = %s", os.Getenv("DATABASE_URL"))
-
-	database.Connect()
-	database.InitSchema()
-	defer database.Close()
-
-	r := chi.NewRouter()
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
-	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: true,
-		MaxAge:           300,
-	}))
-
-	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte("Welcome to Qprint API - Print Without Standing in Queue"))
-	})
-
-	r.Post("/register", handlers.Register)
-	r.Post("/login", handlers.Login)
-
-	// Protected routes
-	r.Group(func(r chi.Router) {
-		r.Use(auth.AuthMiddleware)
-		r.Post("/upload", handlers.UploadFile)
-		r.Get("/file/{code}", handlers.DownloadFile)
-		r.Post("/file/{code}/confirm", handlers.ConfirmPrivatePrint)
-		r.Get("/file/{code}/status", handlers.CheckFileStatus)
-		r.Get("/shops", handlers.GetNearestShops)
-		r.Get("/queue", handlers.GetShopQueue)
-		r.Get("/queue/download/{fileId}", handlers.DownloadQueueFile)
-		r.Post("/queue/{fileId}/confirm", handlers.ConfirmQueuePrint)
-		r.Get("/my-files", handlers.GetMyFiles)
-		r.Get("/shop/history", handlers.GetShopHistory)
-	})
-
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-
-	fmt.Printf("Server running on port %s\n", port)
-	if err := http.ListenAndServe(":"+port, r); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
-	}
-}
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	_ "time/tzdata" // shop opening hours use IANA timezones even where the OS has none
+
+	"backend/internal/auth"
+	"backend/internal/database"
+	"backend/internal/encryption"
+	"backend/internal/events"
+	"backend/internal/handlers"
+	"backend/internal/payments"
+	"backend/internal/storage"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/cors"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	// Force load .env file and OVERRIDE any existing environment variables
+	if err := godotenv.Overload(".env"); err != nil {
+		if err := godotenv.Overload("backend/.env"); err != nil {
+			log.Println("No .env file found, using environment variables")
+		} else {
+			log.Println("Loaded and OVERRODE env vars from backend/.env")
+		}
+	} else {
+		log.Println("Loaded and OVERRODE env vars from current directory")
+	}
+
+	log.Printf("DEBUG: DATABASE_URL from env = %s", os.Getenv("DATABASE_URL"))
+
+	database.Connect()
+	defer database.Close()
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			runMigrate(os.Args[2:])
+			return
+		case "create-admin":
+			runCreateAdmin(os.Args[2:])
+			return
+		}
+	}
+
+	applied, err := database.Migrate(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+	for _, m := range applied {
+		fmt.Printf("Applied migration %03d_%s\n", m.Version, m.Name)
+	}
+
+	storage.Init()
+	encryption.Init()
+	payments.Init()
+
+	// Rewrap data keys after a master key rotation and encrypt older uploads
+	go encryption.Rotate(context.Background())
+
+	// Fan out job changes from every API instance to connected event streams
+	go events.Listen(context.Background())
+
+	// Settle online payments whose webhook never arrived
+	go handlers.ReconcilePayments(context.Background())
+
+	r := chi.NewRouter()
+	r.Use(auth.StreamToken("/events"))
+	r.Use(middleware.Logger)
+	r.Use(middleware.Recoverer)
+	r.Use(cors.Handler(cors.Options{
+		AllowedOrigins:   []string{"https://*", "http://*"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		ExposedHeaders:   []string{"Link"},
+		AllowCredentials: true,
+		MaxAge:           300,
+	}))
+
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Welcome to Qprint API - Print Without Standing in Queue"))
+	})
+
+	r.Post("/register", handlers.Register)
+	r.Post("/login", handlers.Login)
+	r.Post("/refresh", handlers.RefreshToken)
+
+	// IPP printers, authenticated with HTTP Basic credentials
+	r.Post("/ipp/print", handlers.IPPPrivatePrinter)
+	r.Post("/ipp/shops/{shopId}", handlers.IPPShopPrinter)
+
+	// Payment gateway webhooks, authenticated by their signature
+	r.Post("/payments/webhook", handlers.PaymentWebhook)
+
+	// Protected routes
+	mountProtected(r, auth.AuthMiddleware)
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	fmt.Printf("Server running on port %s\n", port)
+	if err := http.ListenAndServe(":"+port, r); err != nil {
+		log.Fatalf("Failed to start server: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"backend/internal/database"
+)
+
+const migrateUsage = `Usage: api migrate <command>
+
+Commands:
+  up          Apply all pending migrations
+  down [n]    Roll back the last n migrations (default 1)
+  status      List migrations and when they were applied`
+
+// runMigrate handles the "migrate" subcommand
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		fmt.Println(migrateUsage)
+		os.Exit(2)
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := database.Migrate(ctx)
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		for _, m := range applied {
+			fmt.Printf("Applied %03d_%s\n", m.Version, m.Name)
+		}
+		if len(applied) == 0 {
+			fmt.Println("Database is up to date")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				log.Fatalf("Invalid number of migrations to roll back: %s", args[1])
+			}
+			steps = n
+		}
+		reverted, err := database.Rollback(ctx, steps)
+		if err != nil {
+			log.Fatalf("Rollback failed: %v", err)
+		}
+		for _, m := range reverted {
+			fmt.Printf("Rolled back %03d_%s\n", m.Version, m.Name)
+		}
+		if len(reverted) == 0 {
+			fmt.Println("Nothing to roll back")
+		}
+
+	case "status":
+		states, err := database.MigrationStatus(ctx)
+		if err != nil {
+			log.Fatalf("Failed to read migration status: %v", err)
+		}
+		for _, s := range states {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%03d_%-30s %s\n", s.Version, s.Name, applied)
+		}
+
+	default:
+		fmt.Println(migrateUsage)
+		os.Exit(2)
+	}
+}
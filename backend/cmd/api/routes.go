@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+
+	"backend/internal/auth"
+	"backend/internal/handlers"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// route is a protected endpoint together with the roles allowed to call it
+type route struct {
+	method  string
+	pattern string
+	handler http.HandlerFunc
+	roles   []string
+}
+
+var (
+	everyone    = []string{auth.RoleCustomer, auth.RoleShopkeeper, auth.RoleAdmin}
+	customers   = []string{auth.RoleCustomer}
+	shopkeepers = []string{auth.RoleShopkeeper}
+	admins      = []string{auth.RoleAdmin}
+)
+
+// protectedRoutes is the permission table for every authenticated endpoint.
+// A route missing from this table is not served.
+var protectedRoutes = []route{
+	{"POST", "/logout", handlers.Logout, everyone},
+	{"GET", "/events", handlers.StreamEvents, []string{auth.RoleCustomer, auth.RoleShopkeeper}},
+	{"GET", "/wallet", handlers.GetWallet, []string{auth.RoleCustomer, auth.RoleShopkeeper}},
+	{"GET", "/jobs/{id}/upi", handlers.GetUPIRequest, []string{auth.RoleCustomer, auth.RoleShopkeeper}},
+	{"GET", "/jobs/{id}/upi/qr", handlers.GetUPIQRCode, []string{auth.RoleCustomer, auth.RoleShopkeeper}},
+	{"GET", "/jobs/{id}/invoice", handlers.GetInvoice, []string{auth.RoleCustomer, auth.RoleShopkeeper}},
+
+	// Customers
+	{"POST", "/upload", handlers.UploadFile, customers},
+	{"POST", "/quote", handlers.GetQuote, customers},
+	{"POST", "/recommend", handlers.RecommendShops, customers},
+	{"DELETE", "/file/{id}", handlers.CancelFile, customers},
+	{"GET", "/file/{code}/status", handlers.CheckFileStatus, customers},
+	{"GET", "/my-files", handlers.GetMyFiles, customers},
+	{"GET", "/payments/{fileId}", handlers.GetPayment, customers},
+	{"GET", "/billing", handlers.GetBillingDetails, customers},
+	{"PUT", "/billing", handlers.UpdateBillingDetails, customers},
+	{"GET", "/shops", handlers.GetNearestShops, []string{auth.RoleCustomer, auth.RoleAdmin}},
+	{"GET", "/shops/{shopId}/price-card", handlers.GetShopPriceCard, everyone},
+	{"GET", "/shops/{shopId}/profile", handlers.GetShopProfile, everyone},
+
+	// Shopkeepers: private jobs redeemed by code
+	{"GET", "/file/{code}", handlers.DownloadFile, shopkeepers},
+	{"POST", "/file/{code}/confirm", handlers.ConfirmPrivatePrint, shopkeepers},
+
+	// Shopkeepers: the shop queue
+	{"GET", "/queue", handlers.GetShopQueue, shopkeepers},
+	{"GET", "/queue/download/{fileId}", handlers.DownloadQueueFile, shopkeepers},
+	{"POST", "/queue/{fileId}/confirm", handlers.ConfirmQueuePrint, shopkeepers},
+	{"POST", "/queue/{fileId}/collected", handlers.MarkQueueCollected, shopkeepers},
+	{"POST", "/queue/{fileId}/paid", handlers.MarkQueuePaid, shopkeepers},
+	{"POST", "/queue/{fileId}/progress", handlers.ReportQueueProgress, shopkeepers},
+	{"POST", "/queue/{fileId}/fail", handlers.FailQueuePrint, shopkeepers},
+	{"POST", "/queue/{fileId}/retry", handlers.RetryQueuePrint, shopkeepers},
+	{"POST", "/queue/{fileId}/move", handlers.MoveQueueJob, shopkeepers},
+	{"POST", "/queue/{fileId}/priority", handlers.PinQueueJob, shopkeepers},
+	{"DELETE", "/queue/{fileId}/priority", handlers.UnpinQueueJob, shopkeepers},
+	{"POST", "/queue/{fileId}/hold", handlers.HoldQueueJob, shopkeepers},
+	{"POST", "/queue/{fileId}/resume", handlers.ResumeQueueJob, shopkeepers},
+
+	// Shopkeepers: the shop itself
+	{"GET", "/shop/history", handlers.GetShopHistory, shopkeepers},
+	{"GET", "/shop/application", handlers.GetShopApplication, shopkeepers},
+	{"PUT", "/shop/application", handlers.ResubmitShopApplication, shopkeepers},
+	{"GET", "/shop/profile", handlers.GetMyShopProfile, shopkeepers},
+	{"PUT", "/shop/profile", handlers.UpdateShopProfile, shopkeepers},
+	{"GET", "/shop/price-card", handlers.GetMyPriceCard, shopkeepers},
+	{"PUT", "/shop/price-card", handlers.PublishPriceCard, shopkeepers},
+
+	// Admins
+	{"GET", "/admin/users", handlers.ListUsers, admins},
+	{"POST", "/admin/users/{id}/suspend", handlers.SuspendUser, admins},
+	{"POST", "/admin/users/{id}/unsuspend", handlers.UnsuspendUser, admins},
+	{"DELETE", "/admin/users/{id}", handlers.DeleteUser, admins},
+	{"POST", "/admin/users/{id}/wallet/top-up", handlers.TopUpWallet, admins},
+	{"GET", "/admin/shops", handlers.ListShops, admins},
+	{"POST", "/admin/shops/{id}/approve", handlers.ApproveShop, admins},
+	{"POST", "/admin/shops/{id}/reject", handlers.RejectShop, admins},
+	{"GET", "/admin/jobs", handlers.ListJobs, admins},
+	{"GET", "/admin/jobs/{id}", handlers.GetJob, admins},
+	{"POST", "/admin/jobs/{id}/expire", handlers.ExpireJob, admins},
+	{"GET", "/admin/stats", handlers.GetPlatformStats, admins},
+}
+
+// mountProtected serves protectedRoutes on r behind authenticate, which
+// puts the caller's claims in the request context
+func mountProtected(r chi.Router, authenticate func(http.Handler) http.Handler) {
+	r.Group(func(r chi.Router) {
+		r.Use(authenticate)
+		for _, rt := range protectedRoutes {
+			r.With(auth.RequireRole(rt.roles...)).Method(rt.method, rt.pattern, rt.handler)
+		}
+	})
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"backend/internal/auth"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// permissions is who may call each protected route, written out separately
+// from protectedRoutes so a change to the table has to be made twice
+var permissions = map[string]string{
+	"POST /logout":                         "customer shopkeeper admin",
+	"GET /events":                          "customer shopkeeper",
+	"GET /wallet":                          "customer shopkeeper",
+	"GET /jobs/{id}/upi":                   "customer shopkeeper",
+	"GET /jobs/{id}/upi/qr":                "customer shopkeeper",
+	"GET /jobs/{id}/invoice":               "customer shopkeeper",
+	"POST /upload":                         "customer",
+	"POST /quote":                          "customer",
+	"POST /recommend":                      "customer",
+	"DELETE /file/{id}":                    "customer",
+	"GET /file/{code}/status":              "customer",
+	"GET /my-files":                        "customer",
+	"GET /payments/{fileId}":               "customer",
+	"GET /billing":                         "customer",
+	"PUT /billing":                         "customer",
+	"GET /shops":                           "customer admin",
+	"GET /shops/{shopId}/price-card":       "customer shopkeeper admin",
+	"GET /shops/{shopId}/profile":          "customer shopkeeper admin",
+	"GET /file/{code}":                     "shopkeeper",
+	"POST /file/{code}/confirm":            "shopkeeper",
+	"GET /queue":                           "shopkeeper",
+	"GET /queue/download/{fileId}":         "shopkeeper",
+	"POST /queue/{fileId}/confirm":         "shopkeeper",
+	"POST /queue/{fileId}/collected":       "shopkeeper",
+	"POST /queue/{fileId}/paid":            "shopkeeper",
+	"POST /queue/{fileId}/progress":        "shopkeeper",
+	"POST /queue/{fileId}/fail":            "shopkeeper",
+	"POST /queue/{fileId}/retry":           "shopkeeper",
+	"POST /queue/{fileId}/move":            "shopkeeper",
+	"POST /queue/{fileId}/priority":        "shopkeeper",
+	"DELETE /queue/{fileId}/priority":      "shopkeeper",
+	"POST /queue/{fileId}/hold":            "shopkeeper",
+	"POST /queue/{fileId}/resume":          "shopkeeper",
+	"GET /shop/history":                    "shopkeeper",
+	"GET /shop/application":                "shopkeeper",
+	"PUT /shop/application":                "shopkeeper",
+	"GET /shop/profile":                    "shopkeeper",
+	"PUT /shop/profile":                    "shopkeeper",
+	"GET /shop/price-card":                 "shopkeeper",
+	"PUT /shop/price-card":                 "shopkeeper",
+	"GET /admin/users":                     "admin",
+	"POST /admin/users/{id}/suspend":       "admin",
+	"POST /admin/users/{id}/unsuspend":     "admin",
+	"DELETE /admin/users/{id}":             "admin",
+	"POST /admin/users/{id}/wallet/top-up": "admin",
+	"GET /admin/shops":                     "admin",
+	"POST /admin/shops/{id}/approve":       "admin",
+	"POST /admin/shops/{id}/reject":        "admin",
+	"GET /admin/jobs":                      "admin",
+	"GET /admin/jobs/{id}":                 "admin",
+	"POST /admin/jobs/{id}/expire":         "admin",
+	"GET /admin/stats":                     "admin",
+}
+
+// testRole names the role a test request is made as; requests without it are anonymous
+const testRole = "X-Test-Role"
+
+// testAuthentication trusts testRole in place of a token, so the matrix
+// runs without a database. Anonymous requests go through the real middleware.
+func testAuthentication(next http.Handler) http.Handler {
+	authenticated := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := &auth.Claims{UserID: 1, Role: r.Header.Get(testRole)}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), auth.UserKey, claims)))
+	})
+	anonymous := auth.AuthMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(testRole) != "" {
+			authenticated.ServeHTTP(w, r)
+			return
+		}
+		anonymous.ServeHTTP(w, r)
+	})
+}
+
+func TestRoutePermissions(t *testing.T) {
+	// Handlers are replaced by one that reports the request got through
+	const reached = http.StatusTeapot
+	routes := protectedRoutes
+	defer func() { protectedRoutes = routes }()
+	protectedRoutes = nil
+	for _, rt := range routes {
+		rt.handler = func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(reached) }
+		protectedRoutes = append(protectedRoutes, rt)
+	}
+
+	r := chi.NewRouter()
+	mountProtected(r, testAuthentication)
+
+	seen := map[string]bool{}
+	for _, rt := range routes {
+		key := rt.method + " " + rt.pattern
+		seen[key] = true
+		allowed, ok := permissions[key]
+		if !ok {
+			t.Errorf("%s is not in the permission matrix", key)
+			continue
+		}
+
+		// Fill path parameters with something that parses as an ID or a code
+		path := rt.pattern
+		for strings.Contains(path, "{") {
+			start, end := strings.Index(path, "{"), strings.Index(path, "}")
+			path = path[:start] + "1" + path[end+1:]
+		}
+
+		for _, role := range []string{"", auth.RoleCustomer, auth.RoleShopkeeper, auth.RoleAdmin} {
+			want := http.StatusForbidden
+			switch {
+			case role == "":
+				want = http.StatusUnauthorized
+			case slices.Contains(strings.Fields(allowed), role):
+				want = reached
+			}
+
+			req := httptest.NewRequest(rt.method, path, nil)
+			if role != "" {
+				req.Header.Set(testRole, role)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != want {
+				name := role
+				if name == "" {
+					name = "anonymous"
+				}
+				t.Errorf("%s as %s: got %d, want %d", key, name, w.Code, want)
+			}
+		}
+	}
+
+	for key := range permissions {
+		if !seen[key] {
+			t.Errorf("%s is in the permission matrix but not served", key)
+		}
+	}
+}
+
+func TestRoutesUnique(t *testing.T) {
+	seen := map[string]bool{}
+	for _, rt := range protectedRoutes {
+		key := rt.method + " " + rt.pattern
+		if seen[key] {
+			t.Errorf("%s is listed twice", key)
+		}
+		seen[key] = true
+	}
+}
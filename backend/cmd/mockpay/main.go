@@ -0,0 +1,35 @@
+// Command mockpay runs the mock payment gateway for local development. Point
+// the API at it with PAYMENT_API_URL and use the same PAYMENT_API_KEY and
+// PAYMENT_WEBHOOK_SECRET on both sides.
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"backend/internal/payments/mock"
+)
+
+func getenv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func main() {
+	addr := getenv("MOCKPAY_ADDR", ":8090")
+	secret := getenv("PAYMENT_WEBHOOK_SECRET", "mock-webhook-secret")
+	server := mock.New(
+		getenv("PAYMENT_API_KEY", "mock-api-key"),
+		[]byte(secret),
+		getenv("MOCKPAY_WEBHOOK_URL", "http://localhost:8080/payments/webhook"),
+		getenv("MOCKPAY_PUBLIC_URL", "http://localhost"+addr),
+	)
+
+	log.Printf("Mock payment gateway listening on %s, sending webhooks to %s", addr, server.WebhookURL)
+	if err := http.ListenAndServe(addr, server); err != nil {
+		log.Fatalf("Failed to start mock gateway: %v", err)
+	}
+}
@@ -10,6 +10,7 @@ require (
 	github.com/joho/godotenv v1.5.1
 	github.com/pdfcpu/pdfcpu v0.11.1
 	golang.org/x/crypto v0.45.0
+	rsc.io/qr v0.2.0
 )
 
 require (
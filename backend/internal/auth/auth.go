@@ -1,59 +1,124 @@
-package auth
-
-import (
-	"errors"
-	"os"
-	"time"
-
-	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
-)
-
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
-
-type Claims struct {
-	UserID int    `json:"user_id"`
-	Role   string `json:"role"`
-	jwt.RegisteredClaims
-}
-
-func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	return string(bytes), err
-}
-
-func CheckPasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
-}
-
-func GenerateToken(userID int, role string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &Claims{
-		UserID: userID,
-		Role:   role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
-}
-
-func ValidateToken(tokenString string) (*Claims, error) {
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
-
-	if err != nil {
-		return nil, err
-	}
-
-	if !token.Valid {
-		return nil, errors.New("invalid token")
-	}
-
-	return claims, nil
-}
+package auth
+
+import (
+	"backend/internal/database"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+
+const (
+	// AccessTokenTTL is how long an access token is accepted
+	AccessTokenTTL = 15 * time.Minute
+	// RefreshTokenTTL is how long a refresh token can be exchanged for new tokens
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// ErrTokenRevoked is returned for tokens of a session that was logged out,
+// or issued before the user's sessions were all revoked
+var ErrTokenRevoked = errors.New("token revoked")
+
+type Claims struct {
+	UserID int    `json:"user_id"`
+	Role   string `json:"role"`
+	// Generation is users.token_generation when the token was issued.
+	// Bumping the counter revokes every access token issued before.
+	Generation int `json:"gen"`
+	// SessionID is the login the token belongs to. Logging out revokes
+	// the session and with it every access token it issued.
+	SessionID int `json:"sid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func HashPassword(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+	return string(bytes), err
+}
+
+func CheckPasswordHash(password, hash string) bool {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	return err == nil
+}
+
+func GenerateToken(userID int, role string, generation, sessionID int) (string, error) {
+	expirationTime := time.Now().Add(AccessTokenTTL)
+	claims := &Claims{
+		UserID:     userID,
+		Role:       role,
+		Generation: generation,
+		SessionID:  sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(jwtSecret)
+}
+
+func ValidateToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	return claims, nil
+}
+
+// Authenticate validates an access token and checks that neither its
+// session nor all of the user's sessions have been revoked since it was issued
+func Authenticate(tokenString string) (*Claims, error) {
+	claims, err := ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	var generation int
+	var sessionRevoked bool
+	err = database.DB.QueryRow(context.Background(),
+		`SELECT token_generation,
+		   EXISTS (SELECT 1 FROM sessions WHERE id = $2 AND user_id = users.id AND revoked_at IS NOT NULL)
+		 FROM users WHERE id = $1`, claims.UserID, claims.SessionID).Scan(&generation, &sessionRevoked)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Generation != generation || sessionRevoked {
+		return nil, ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+// NewRefreshToken returns a random refresh token and the hash to store for it
+func NewRefreshToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken returns the stored form of a refresh token. Only hashes
+// are kept, so a leaked refresh_tokens table cannot be replayed.
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
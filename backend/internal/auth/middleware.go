@@ -1,36 +1,68 @@
-package auth
-
-import (
-	"context"
-	"net/http"
-	"strings"
-)
-
-type contextKey string
-
-const UserKey contextKey = "user"
-
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Authorization header required", http.StatusUnauthorized)
-			return
-		}
-
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			http.Error(w, "Invalid authorization header", http.StatusUnauthorized)
-			return
-		}
-
-		claims, err := ValidateToken(parts[1])
-		if err != nil {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			return
-		}
-
-		ctx := context.WithValue(r.Context(), UserKey, claims)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
-}
+package auth
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+type contextKey string
+
+const UserKey contextKey = "user"
+
+func AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			http.Error(w, "Authorization header required", http.StatusUnauthorized)
+			return
+		}
+
+		parts := strings.Split(authHeader, " ")
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			http.Error(w, "Invalid authorization header", http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := Authenticate(parts[1])
+		if err != nil {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), UserKey, claims)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// queryTokenParam carries the access token of event streams opened by EventSource
+const queryTokenParam = "access_token"
+
+// StreamToken lets event streams on paths authenticate with
+// ?access_token=<token>, as EventSource cannot set headers. The token is
+// moved into the Authorization header and removed from the URL of every
+// request, so it never reaches the request log; it must run before the
+// logger. Elsewhere a query token is ignored.
+func StreamToken(paths ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			if !query.Has(queryTokenParam) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			token := query.Get(queryTokenParam)
+			query.Del(queryTokenParam)
+
+			r = r.Clone(r.Context())
+			r.URL.RawQuery = query.Encode()
+			r.RequestURI = r.URL.RequestURI()
+			if token != "" && r.Header.Get("Authorization") == "" &&
+				r.Header.Get("Accept") == "text/event-stream" && slices.Contains(paths, r.URL.Path) {
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
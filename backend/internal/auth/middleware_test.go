@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func TestStreamToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		target        string
+		accept        string
+		authorization string
+		wantAuth      string
+		wantURI       string
+	}{
+		{"event stream", "/events?access_token=secret", "text/event-stream", "", "Bearer secret", "/events"},
+		{"other query parameters kept", "/events?since=5&access_token=secret", "text/event-stream", "", "Bearer secret", "/events?since=5"},
+		{"header wins", "/events?access_token=secret", "text/event-stream", "Bearer header", "Bearer header", "/events"},
+		{"not a stream request", "/events?access_token=secret", "application/json", "", "", "/events"},
+		{"other route", "/queue/download/3?access_token=secret", "text/event-stream", "", "", "/queue/download/3"},
+		{"no token", "/queue?x=1", "", "", "", "/queue?x=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotAuth, gotURI string
+			handler := StreamToken("/events")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotAuth, gotURI = r.Header.Get("Authorization"), r.RequestURI
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			r.Header.Set("Accept", tt.accept)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			if gotAuth != tt.wantAuth {
+				t.Errorf("Authorization %q, want %q", gotAuth, tt.wantAuth)
+			}
+			if gotURI != tt.wantURI {
+				t.Errorf("request URI %q, want %q", gotURI, tt.wantURI)
+			}
+		})
+	}
+}
+
+func TestStreamTokenNotLogged(t *testing.T) {
+	var logged bytes.Buffer
+	logger := middleware.RequestLogger(&middleware.DefaultLogFormatter{Logger: log.New(&logged, "", 0), NoColor: true})
+	handler := StreamToken("/events")(logger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	for _, target := range []string{"/events?access_token=secret", "/my-files?access_token=secret"} {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.Header.Set("Accept", "text/event-stream")
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if strings.Contains(logged.String(), "secret") {
+		t.Errorf("token logged:\n%s", logged.String())
+	}
+}
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"net/http"
+	"slices"
+)
+
+// Roles a user can hold
+const (
+	RoleCustomer   = "customer"
+	RoleShopkeeper = "shopkeeper"
+	RoleAdmin      = "admin"
+)
+
+// RequireRole rejects requests whose token does not carry one of roles.
+// It must run after AuthMiddleware.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(UserKey).(*Claims)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if !slices.Contains(roles, claims.Role) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
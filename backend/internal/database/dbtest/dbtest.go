@@ -0,0 +1,97 @@
+// Package dbtest runs tests against a real PostgreSQL database. Setup
+// skips the test unless TEST_DATABASE_URL names a database the tests may
+// use; each call migrates a fresh schema in it and drops the schema when the
+// test ends, so test packages running at the same time do not interfere.
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"backend/internal/database"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var schemas atomic.Int64
+
+// Setup points database.DB at a freshly migrated schema for the rest of tb
+func Setup(tb testing.TB) {
+	tb.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		tb.Skip("TEST_DATABASE_URL not set")
+	}
+
+	ctx := context.Background()
+	admin, err := pgx.Connect(ctx, url)
+	if err != nil {
+		tb.Fatalf("connect to test database: %v", err)
+	}
+	schema := fmt.Sprintf("test_%d_%d_%d", os.Getpid(), time.Now().UnixNano(), schemas.Add(1))
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		tb.Fatalf("create schema: %v", err)
+	}
+
+	config, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		tb.Fatalf("parse TEST_DATABASE_URL: %v", err)
+	}
+	config.ConnConfig.RuntimeParams["search_path"] = schema
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		tb.Fatalf("connect to test database: %v", err)
+	}
+
+	previous := database.DB
+	database.DB = pool
+	tb.Cleanup(func() {
+		database.DB = previous
+		pool.Close()
+		admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE")
+		admin.Close(context.Background())
+	})
+
+	if _, err := database.Migrate(ctx); err != nil {
+		tb.Fatalf("migrate: %v", err)
+	}
+}
+
+var users atomic.Int64
+
+// CreateUser inserts a user with the given role and returns its ID
+func CreateUser(tb testing.TB, role string) int {
+	tb.Helper()
+	var id int
+	err := database.DB.QueryRow(context.Background(),
+		`INSERT INTO users (username, password_hash, role) VALUES ($1, 'x', $2) RETURNING id`,
+		fmt.Sprintf("%s%d", role, users.Add(1)), role).Scan(&id)
+	if err != nil {
+		tb.Fatalf("create %s: %v", role, err)
+	}
+	return id
+}
+
+// CreateShop inserts an approved shop at the given location that prints
+// every paper size in color and duplex, and returns its ID
+func CreateShop(tb testing.TB, lat, long float64) int {
+	tb.Helper()
+	ctx := context.Background()
+	id := CreateUser(tb, "shopkeeper")
+	_, err := database.DB.Exec(ctx,
+		"UPDATE users SET lat = $2, long = $3, shop_status = 'approved' WHERE id = $1", id, lat, long)
+	if err == nil {
+		_, err = database.DB.Exec(ctx,
+			`INSERT INTO shops (user_id, business_name, color, duplex, paper_sizes)
+			 VALUES ($1, $2, TRUE, TRUE, '{A4,A3,Letter,Legal}')`, id, fmt.Sprintf("Shop %d", id))
+	}
+	if err != nil {
+		tb.Fatalf("create shop: %v", err)
+	}
+	return id
+}
@@ -0,0 +1,266 @@
+// Package encryption encrypts stored documents at rest. Every document is
+// sealed with its own data key, and the data key is wrapped by a master key
+// from configuration, so rotating the master key only rewraps data keys.
+package encryption
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+const (
+	// chunkSize is the plaintext size of each sealed chunk
+	chunkSize = 64 << 10
+	tagSize   = 16
+	keySize   = 32
+)
+
+// magic starts every sealed document
+var magic = []byte("QPE1")
+
+var ErrUnknownKey = errors.New("unknown master key")
+
+// Envelope is a document's data key wrapped by a master key
+type Envelope struct {
+	KeyID      string `json:"key_id"`
+	WrappedKey []byte `json:"wrapped_key"`
+}
+
+// Keyring holds the master keys. New data keys are wrapped with the active
+// key; the others are kept to unwrap documents sealed before a rotation.
+type Keyring struct {
+	active string
+	keys   map[string][]byte
+}
+
+// Keys is the keyring used for stored documents
+var Keys *Keyring
+
+// Init loads Keys from STORAGE_MASTER_KEYS
+func Init() {
+	spec := os.Getenv("STORAGE_MASTER_KEYS")
+	if spec == "" {
+		log.Fatal("STORAGE_MASTER_KEYS environment variable is not set")
+	}
+
+	keys, err := ParseKeyring(spec)
+	if err != nil {
+		log.Fatalf("Invalid STORAGE_MASTER_KEYS: %v", err)
+	}
+	Keys = keys
+	fmt.Printf("Encrypting uploads with master key %s\n", keys.active)
+}
+
+// ParseKeyring parses a comma-separated list of id:base64key master keys.
+// The first key is the active one. Keys must be 32 bytes.
+func ParseKeyring(spec string) (*Keyring, error) {
+	k := &Keyring{keys: map[string][]byte{}}
+	for _, entry := range strings.Split(spec, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("key %q is not in id:base64key form", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		if len(key) != keySize {
+			return nil, fmt.Errorf("key %s must be %d bytes, got %d", id, keySize, len(key))
+		}
+		if _, dup := k.keys[id]; dup {
+			return nil, fmt.Errorf("key %s is listed twice", id)
+		}
+		if k.active == "" {
+			k.active = id
+		}
+		k.keys[id] = key
+	}
+	return k, nil
+}
+
+// ActiveID returns the ID of the master key that wraps new data keys
+func (k *Keyring) ActiveID() string {
+	return k.active
+}
+
+// Seal encrypts a document with a fresh data key and returns the sealed
+// document with the wrapped data key
+func (k *Keyring) Seal(plain []byte) ([]byte, *Envelope, error) {
+	dek := make([]byte, keySize)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, nil, err
+	}
+	env, err := k.wrap(dek)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	aead, err := newGCM(dek)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sealed := make([]byte, 0, SealedSize(int64(len(plain))))
+	sealed = append(sealed, magic...)
+	for i := uint64(0); ; i++ {
+		n := min(chunkSize, len(plain))
+		last := n == len(plain)
+		sealed = aead.Seal(sealed, chunkNonce(i, last), plain[:n], nil)
+		plain = plain[n:]
+		if last {
+			return sealed, env, nil
+		}
+	}
+}
+
+// Open returns a reader that decrypts a sealed document as it is read.
+// Reads fail if the document has been truncated or tampered with.
+func (k *Keyring) Open(src io.Reader, env *Envelope) (io.Reader, error) {
+	dek, err := k.unwrap(env)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReaderSize(src, chunkSize+tagSize+1)
+	header := make([]byte, len(magic))
+	if _, err := io.ReadFull(br, header); err != nil || string(header) != string(magic) {
+		return nil, errors.New("not a sealed document")
+	}
+	return &reader{src: br, aead: aead, buf: make([]byte, chunkSize+tagSize)}, nil
+}
+
+// Rewrap wraps a document's data key with the active master key
+func (k *Keyring) Rewrap(env *Envelope) (*Envelope, error) {
+	dek, err := k.unwrap(env)
+	if err != nil {
+		return nil, err
+	}
+	return k.wrap(dek)
+}
+
+// SealedSize returns the size of a sealed document with plainSize bytes of plaintext
+func SealedSize(plainSize int64) int64 {
+	chunks := max(1, (plainSize+chunkSize-1)/chunkSize)
+	return int64(len(magic)) + plainSize + chunks*tagSize
+}
+
+// PlainSize returns the plaintext size of a sealed document of sealedSize bytes
+func PlainSize(sealedSize int64) int64 {
+	body := sealedSize - int64(len(magic))
+	chunks := (body + chunkSize + tagSize - 1) / (chunkSize + tagSize)
+	if chunks < 1 {
+		return 0
+	}
+	return body - chunks*tagSize
+}
+
+func (k *Keyring) wrap(dek []byte) (*Envelope, error) {
+	aead, err := newGCM(k.keys[k.active])
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	// The key ID is authenticated so a wrapped key cannot be relabelled
+	wrapped := aead.Seal(nonce, nonce, dek, []byte(k.active))
+	return &Envelope{KeyID: k.active, WrappedKey: wrapped}, nil
+}
+
+func (k *Keyring) unwrap(env *Envelope) ([]byte, error) {
+	master, ok := k.keys[env.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrUnknownKey, env.KeyID)
+	}
+	aead, err := newGCM(master)
+	if err != nil {
+		return nil, err
+	}
+	if len(env.WrappedKey) < aead.NonceSize() {
+		return nil, errors.New("wrapped key is too short")
+	}
+	nonce, wrapped := env.WrappedKey[:aead.NonceSize()], env.WrappedKey[aead.NonceSize():]
+	return aead.Open(nil, nonce, wrapped, []byte(env.KeyID))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce derives a chunk's nonce from its index. The final chunk is
+// flagged so that dropping trailing chunks is detected. Nonces never repeat
+// under one data key because every document has its own.
+func chunkNonce(index uint64, last bool) []byte {
+	nonce := make([]byte, 12)
+	if last {
+		nonce[0] = 1
+	}
+	binary.BigEndian.PutUint64(nonce[4:], index)
+	return nonce
+}
+
+// reader decrypts a sealed document chunk by chunk
+type reader struct {
+	src   *bufio.Reader
+	aead  cipher.AEAD
+	buf   []byte
+	plain []byte
+	index uint64
+	done  bool
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+func (r *reader) next() error {
+	n, err := io.ReadFull(r.src, r.buf)
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		r.done = true
+	case err != nil:
+		return err
+	default:
+		// A full chunk is the last one only if nothing follows it
+		if _, err := r.src.Peek(1); err == io.EOF {
+			r.done = true
+		}
+	}
+
+	plain, err := r.aead.Open(r.buf[:0], chunkNonce(r.index, r.done), r.buf[:n], nil)
+	if err != nil {
+		return errors.New("sealed document is corrupt or truncated")
+	}
+	r.plain = plain
+	r.index++
+	return nil
+}
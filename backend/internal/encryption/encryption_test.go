@@ -0,0 +1,189 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// testKeyring returns a keyring with a random key for each ID, the first active
+func testKeyring(t *testing.T, ids ...string) *Keyring {
+	t.Helper()
+	var entries []string
+	for _, id := range ids {
+		key := make([]byte, keySize)
+		rand.Read(key)
+		entries = append(entries, id+":"+base64.StdEncoding.EncodeToString(key))
+	}
+	k, err := ParseKeyring(strings.Join(entries, ","))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func random(n int) []byte {
+	b := make([]byte, n)
+	rand.Read(b)
+	return b
+}
+
+func open(k *Keyring, sealed []byte, env *Envelope) ([]byte, error) {
+	r, err := k.Open(bytes.NewReader(sealed), env)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestRoundTrip(t *testing.T) {
+	k := testKeyring(t, "k1")
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3 * chunkSize} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			plain := random(size)
+			sealed, env, err := k.Seal(plain)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if env.KeyID != "k1" {
+				t.Errorf("wrapped with %s", env.KeyID)
+			}
+			if got := int64(len(sealed)); got != SealedSize(int64(size)) {
+				t.Errorf("sealed size %d, SealedSize says %d", got, SealedSize(int64(size)))
+			}
+			got, err := open(k, sealed, env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Errorf("opened %d bytes, not the %d sealed", len(got), size)
+			}
+		})
+	}
+}
+
+func TestSizes(t *testing.T) {
+	for _, n := range []int64{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 2 * chunkSize, 3*chunkSize + 7, 10 << 20} {
+		if got := PlainSize(SealedSize(n)); got != n {
+			t.Errorf("PlainSize(SealedSize(%d)) = %d", n, got)
+		}
+	}
+}
+
+func TestTampering(t *testing.T) {
+	k := testKeyring(t, "k1")
+	plain := random(3 * chunkSize)
+	sealed, env, err := k.Seal(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string][]byte{
+		"last chunk dropped":  sealed[:SealedSize(2*chunkSize)],
+		"first chunk only":    sealed[:SealedSize(chunkSize)],
+		"truncated mid chunk": sealed[:SealedSize(chunkSize)+100],
+		"tag cut short":       sealed[:len(sealed)-1],
+		"header only":         sealed[:len(magic)],
+	}
+	for _, offset := range []int{len(magic), len(magic) + chunkSize + tagSize + 5, len(sealed) - 1} {
+		flipped := bytes.Clone(sealed)
+		flipped[offset] ^= 1
+		tests[fmt.Sprintf("byte %d flipped", offset)] = flipped
+	}
+	swapped := bytes.Clone(sealed)
+	first, second := len(magic), len(magic)+chunkSize+tagSize
+	copy(swapped[first:second], sealed[second:second+chunkSize+tagSize])
+	copy(swapped[second:second+chunkSize+tagSize], sealed[first:second])
+	tests["chunks swapped"] = swapped
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got, err := open(k, data, env); err == nil {
+				t.Errorf("opened %d bytes", len(got))
+			}
+		})
+	}
+
+	if _, err := k.Open(bytes.NewReader([]byte("%PDF-1.7")), env); err == nil {
+		t.Error("opened a plaintext document")
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	k := testKeyring(t, "k1", "k2")
+	sealed, env, err := k.Seal([]byte("%PDF-1.7"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	relabelled := &Envelope{KeyID: "k2", WrappedKey: env.WrappedKey}
+	if _, err := k.Open(bytes.NewReader(sealed), relabelled); err == nil {
+		t.Error("unwrapped a data key relabelled with another key ID")
+	}
+
+	// The same master key under a second ID must not unwrap it either: the
+	// key ID is authenticated
+	alias := &Keyring{active: "k1", keys: map[string][]byte{"k1": k.keys["k1"], "alias": k.keys["k1"]}}
+	if _, err := alias.Open(bytes.NewReader(sealed), &Envelope{KeyID: "alias", WrappedKey: env.WrappedKey}); err == nil {
+		t.Error("unwrapped a data key relabelled with an alias of its master key")
+	}
+
+	unknown := &Envelope{KeyID: "k3", WrappedKey: env.WrappedKey}
+	if _, err := k.Open(bytes.NewReader(sealed), unknown); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("unknown key: %v, want ErrUnknownKey", err)
+	}
+	if _, err := k.Open(bytes.NewReader(sealed), &Envelope{KeyID: "k1", WrappedKey: []byte{1, 2}}); err == nil {
+		t.Error("unwrapped a short wrapped key")
+	}
+}
+
+func TestRewrap(t *testing.T) {
+	old := testKeyring(t, "old")
+	plain := random(chunkSize + 1)
+	sealed, env, err := old.Seal(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The new key is listed first, so it is active, and the old one is kept to unwrap
+	rotated := testKeyring(t, "new")
+	rotated.keys["old"] = old.keys["old"]
+
+	rewrapped, err := rotated.Rewrap(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rewrapped.KeyID != "new" {
+		t.Fatalf("rewrapped with %s, want new", rewrapped.KeyID)
+	}
+
+	// The old key is no longer needed to read the document
+	delete(rotated.keys, "old")
+	got, err := open(rotated, sealed, rewrapped)
+	if err != nil || !bytes.Equal(got, plain) {
+		t.Errorf("open after rewrap: %d bytes, %v", len(got), err)
+	}
+	if _, err := rotated.Rewrap(env); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("rewrap without the old key: %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestParseKeyring(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(make([]byte, keySize))
+	short := base64.StdEncoding.EncodeToString(make([]byte, 16))
+
+	k, err := ParseKeyring("b:" + key + ", a:" + key)
+	if err != nil || k.ActiveID() != "b" || len(k.keys) != 2 {
+		t.Errorf("ParseKeyring = %+v, %v", k, err)
+	}
+	for _, spec := range []string{"", "a", ":" + key, "a:" + short, "a:not base64!", "a:" + key + ",a:" + key} {
+		if _, err := ParseKeyring(spec); err == nil {
+			t.Errorf("ParseKeyring(%q) accepted", spec)
+		}
+	}
+}
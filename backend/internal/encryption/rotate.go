@@ -0,0 +1,147 @@
+package encryption
+
+import (
+	"backend/internal/database"
+	"backend/internal/jobs"
+	"backend/internal/storage"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"path"
+)
+
+// Rotate brings stored documents in line with the active master key. Data
+// keys wrapped by an older master key are rewrapped, which only touches the
+// files table, and documents stored before encryption was enabled are sealed.
+// It runs in the background at startup; old master keys can be removed from
+// STORAGE_MASTER_KEYS once it has logged a clean run.
+func Rotate(ctx context.Context) {
+	rewrapped, err := rewrapFileKeys(ctx)
+	if err != nil {
+		log.Printf("Key rotation failed: %v", err)
+	}
+	sealed, err := sealPlaintextFiles(ctx)
+	if err != nil {
+		log.Printf("Encrypting existing uploads failed: %v", err)
+	}
+	if rewrapped > 0 || sealed > 0 {
+		log.Printf("Key rotation: rewrapped %d data keys, encrypted %d existing uploads", rewrapped, sealed)
+	}
+}
+
+func rewrapFileKeys(ctx context.Context) (int, error) {
+	rows, err := database.DB.Query(ctx,
+		"SELECT id, key_id, wrapped_key FROM files WHERE key_id IS NOT NULL AND key_id <> $1", Keys.ActiveID())
+	if err != nil {
+		return 0, err
+	}
+	type fileKey struct {
+		id  int
+		env Envelope
+	}
+	var keys []fileKey
+	for rows.Next() {
+		var fk fileKey
+		if err := rows.Scan(&fk.id, &fk.env.KeyID, &fk.env.WrappedKey); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		keys = append(keys, fk)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, fk := range keys {
+		env, err := Keys.Rewrap(&fk.env)
+		if err != nil {
+			log.Printf("Cannot rewrap data key of file %d: %v", fk.id, err)
+			continue
+		}
+		// Skip rows another instance rotated in the meantime
+		tag, err := database.DB.Exec(ctx,
+			"UPDATE files SET key_id = $1, wrapped_key = $2 WHERE id = $3 AND key_id = $4",
+			env.KeyID, env.WrappedKey, fk.id, fk.env.KeyID)
+		if err != nil {
+			return count, err
+		}
+		count += int(tag.RowsAffected())
+	}
+	return count, nil
+}
+
+// sealPlaintextFiles encrypts documents that are still stored in plaintext.
+// Each sealed copy is written under a new key before the row is switched
+// over, so a download running at the same time never sees a mismatch.
+func sealPlaintextFiles(ctx context.Context) (int, error) {
+	rows, err := database.DB.Query(ctx,
+		"SELECT id, storage_key FROM files WHERE key_id IS NULL AND status <> ALL($1)",
+		[]string{string(jobs.Collected), string(jobs.Cancelled), string(jobs.Printed)})
+	if err != nil {
+		return 0, err
+	}
+	type plainFile struct {
+		id  int
+		key string
+	}
+	var files []plainFile
+	for rows.Next() {
+		var f plainFile
+		if err := rows.Scan(&f.id, &f.key); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		files = append(files, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, f := range files {
+		plain, err := readObject(ctx, f.key)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return count, err
+		}
+
+		sealed, env, err := Keys.Seal(plain)
+		if err != nil {
+			return count, err
+		}
+		sealedKey := path.Join(path.Dir(f.key), "enc-"+path.Base(f.key))
+		if err := storage.Files.Put(ctx, sealedKey, bytes.NewReader(sealed)); err != nil {
+			return count, err
+		}
+
+		tag, err := database.DB.Exec(ctx,
+			"UPDATE files SET storage_key = $1, key_id = $2, wrapped_key = $3 WHERE id = $4 AND key_id IS NULL",
+			sealedKey, env.KeyID, env.WrappedKey, f.id)
+		if err != nil || tag.RowsAffected() == 0 {
+			storage.Files.Delete(ctx, sealedKey)
+			if err != nil {
+				return count, err
+			}
+			continue
+		}
+		storage.Files.Delete(ctx, f.key)
+		count++
+	}
+	return count, nil
+}
+
+func readObject(ctx context.Context, key string) ([]byte, error) {
+	src, _, err := storage.Files.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	return io.ReadAll(src)
+}
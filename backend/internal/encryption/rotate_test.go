@@ -0,0 +1,118 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"backend/internal/database"
+	"backend/internal/database/dbtest"
+	"backend/internal/jobs"
+	"backend/internal/storage"
+)
+
+// TestRotate stores documents sealed under an old master key and documents
+// from before encryption, then checks that Rotate moves all of them to the
+// active key without losing any
+func TestRotate(t *testing.T) {
+	dbtest.Setup(t)
+	ctx := context.Background()
+	customer := dbtest.CreateUser(t, "customer")
+
+	old := testKeyring(t, "old")
+	Keys = testKeyring(t, "new")
+	Keys.keys["old"] = old.keys["old"]
+	storage.Files = &storage.Local{Dir: t.TempDir()}
+	t.Cleanup(func() { Keys, storage.Files = nil, nil })
+
+	put := func(key string, data []byte) {
+		if err := storage.Files.Put(ctx, key, bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	insert := func(code, key string, status jobs.Status, env *Envelope) int {
+		var keyID *string
+		var wrapped []byte
+		if env != nil {
+			keyID, wrapped = &env.KeyID, env.WrappedKey
+		}
+		var id int
+		err := database.DB.QueryRow(ctx,
+			`INSERT INTO files (user_id, storage_key, unique_code, status, print_type, key_id, wrapped_key)
+			 VALUES ($1, $2, $3, $4, 'private', $5, $6) RETURNING id`,
+			customer, key, code, status, keyID, wrapped).Scan(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	// Sealed under the old key: only the data key is rewrapped
+	oldPlain := []byte("%PDF-1.7 sealed under the old key")
+	oldSealed, oldEnv, err := old.Seal(oldPlain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	put("uploads/old.pdf", oldSealed)
+	rewrapped := insert("ROT001", "uploads/old.pdf", jobs.Uploaded, oldEnv)
+
+	// Stored before encryption: sealed under a new object key
+	plain := []byte("%PDF-1.7 stored in plaintext")
+	put("uploads/plain.pdf", plain)
+	sealed := insert("ROT002", "uploads/plain.pdf", jobs.Uploaded, nil)
+
+	// Finished jobs are left alone, as are rows whose document is gone
+	put("uploads/done.pdf", plain)
+	done := insert("ROT003", "uploads/done.pdf", jobs.Collected, nil)
+	missing := insert("ROT004", "uploads/missing.pdf", jobs.Uploaded, nil)
+
+	Rotate(ctx)
+
+	// Nothing in the files table needs the old key any more
+	only := &Keyring{active: "new", keys: map[string][]byte{"new": Keys.keys["new"]}}
+	check := func(id int, wantKey string, want []byte) {
+		t.Helper()
+		var key string
+		var env Envelope
+		if err := database.DB.QueryRow(ctx, "SELECT storage_key, key_id, wrapped_key FROM files WHERE id = $1", id).
+			Scan(&key, &env.KeyID, &env.WrappedKey); err != nil {
+			t.Fatalf("file %d: %v", id, err)
+		}
+		if key != wantKey || env.KeyID != "new" {
+			t.Errorf("file %d stored as %s under %s, want %s under new", id, key, env.KeyID, wantKey)
+		}
+		stored, err := readObject(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := open(only, stored, &env)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("file %d opens as %q, %v", id, got, err)
+		}
+	}
+	check(rewrapped, "uploads/old.pdf", oldPlain)
+	check(sealed, "uploads/enc-plain.pdf", plain)
+
+	if _, err := readObject(ctx, "uploads/plain.pdf"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("plaintext copy still stored: %v", err)
+	}
+	for _, id := range []int{done, missing} {
+		var keyID *string
+		database.DB.QueryRow(ctx, "SELECT key_id FROM files WHERE id = $1", id).Scan(&keyID)
+		if keyID != nil {
+			t.Errorf("file %d was sealed", id)
+		}
+	}
+	if stored, err := readObject(ctx, "uploads/done.pdf"); err != nil || !bytes.Equal(stored, plain) {
+		t.Errorf("collected job's document changed: %v", err)
+	}
+
+	// A second run finds nothing to do
+	if n, err := rewrapFileKeys(ctx); n != 0 || err != nil {
+		t.Errorf("second rewrap: %d, %v", n, err)
+	}
+	if n, err := sealPlaintextFiles(ctx); n != 0 || err != nil {
+		t.Errorf("second seal: %d, %v", n, err)
+	}
+}
@@ -0,0 +1,145 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"backend/internal/database"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// channel is the Postgres NOTIFY channel shared by all API instances
+const channel = "qprint_events"
+
+// Event describes a change to a job. Every API instance receives every event,
+// so subscribers filter on UserID and ShopID.
+type Event struct {
+	Type   string `json:"type"`
+	FileID int    `json:"file_id"`
+	UserID int    `json:"user_id"`
+	ShopID *int   `json:"shop_id,omitempty"`
+	Status string `json:"status"`
+}
+
+const (
+	JobCreated   = "job_created"
+	JobUpdated   = "job_updated"
+	QueueChanged = "queue_changed"
+
+	// Resync is delivered to a subscriber that fell behind in place of the
+	// events it missed. It carries no job; the subscriber must reload all of
+	// its state.
+	Resync = "resync"
+)
+
+// Execer is satisfied by pgx.Tx and *pgxpool.Pool
+type Execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// Notify publishes an event for a job. When called inside a transaction the
+// event is only delivered if the transaction commits, so subscribers never
+// see changes that were rolled back.
+func Notify(ctx context.Context, db Execer, eventType string, fileID int) error {
+	_, err := db.Exec(ctx,
+		`SELECT pg_notify($1, json_build_object(
+			'type', $2::text, 'file_id', id, 'user_id', user_id, 'shop_id', shop_id, 'status', status)::text)
+		 FROM files WHERE id = $3`, channel, eventType, fileID)
+	return err
+}
+
+var (
+	mu          sync.Mutex
+	subscribers = make(map[chan Event]struct{})
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind by
+// before its events are replaced with a Resync
+const subscriberBuffer = 16
+
+// Subscribe registers a listener for all events. The returned function must
+// be called to unsubscribe. A subscriber that falls behind receives a Resync
+// event instead of the events it has not read yet.
+func Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	mu.Lock()
+	subscribers[ch] = struct{}{}
+	mu.Unlock()
+
+	return ch, func() {
+		mu.Lock()
+		delete(subscribers, ch)
+		mu.Unlock()
+	}
+}
+
+func broadcast(ev Event) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for ch := range subscribers {
+		select {
+		case ch <- ev:
+			continue
+		default:
+		}
+
+		// The subscriber is behind. Every change it has not read yet,
+		// including this one, is committed, so reloading on Resync
+		// supersedes them all.
+	drain:
+		for {
+			select {
+			case <-ch:
+			default:
+				break drain
+			}
+		}
+		ch <- Event{Type: Resync}
+	}
+}
+
+// Listen receives events from Postgres and fans them out to subscribers
+// until ctx is cancelled, reconnecting if the connection is lost.
+func Listen(ctx context.Context) {
+	for ctx.Err() == nil {
+		if err := listen(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Event listener error: %v", err)
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+func listen(ctx context.Context) error {
+	conn, err := database.DB.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return err
+	}
+
+	for {
+		n, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			// Drop the connection so it is not returned to the pool while listening
+			conn.Conn().Close(context.Background())
+			return err
+		}
+
+		var ev Event
+		if err := json.Unmarshal([]byte(n.Payload), &ev); err != nil {
+			log.Printf("Invalid event payload: %v", err)
+			continue
+		}
+		broadcast(ev)
+	}
+}
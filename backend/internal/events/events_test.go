@@ -0,0 +1,44 @@
+package events
+
+import "testing"
+
+func TestBroadcastResync(t *testing.T) {
+	slow, unsubscribeSlow := Subscribe()
+	defer unsubscribeSlow()
+	fast, unsubscribeFast := Subscribe()
+	defer unsubscribeFast()
+
+	const sent = 3*subscriberBuffer + 5
+	var fastGot []Event
+	for i := 1; i <= sent; i++ {
+		broadcast(Event{Type: JobUpdated, FileID: i})
+		fastGot = append(fastGot, <-fast)
+	}
+
+	// A subscriber that keeps up sees every event
+	for i, ev := range fastGot {
+		if ev.Type != JobUpdated || ev.FileID != i+1 {
+			t.Fatalf("subscriber keeping up got %+v as event %d", ev, i+1)
+		}
+	}
+
+	// One that falls behind is told to resync, then sees what came after
+	var slowGot []Event
+	for len(slow) > 0 {
+		slowGot = append(slowGot, <-slow)
+	}
+	if len(slowGot) == 0 || slowGot[0].Type != Resync {
+		t.Fatalf("subscriber behind got %+v, want a resync first", slowGot)
+	}
+	for i, ev := range slowGot[1:] {
+		if ev.Type == Resync {
+			t.Fatalf("more than one resync in %+v", slowGot)
+		}
+		if want := sent - len(slowGot) + 2 + i; ev.FileID != want {
+			t.Fatalf("event %d after the resync is for file %d, want %d", i, ev.FileID, want)
+		}
+	}
+	if last := slowGot[len(slowGot)-1]; last.Type != Resync && last.FileID != sent {
+		t.Errorf("last event %+v, want file %d", last, sent)
+	}
+}
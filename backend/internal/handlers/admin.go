@@ -0,0 +1,618 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/database"
+	"backend/internal/events"
+	"backend/internal/jobs"
+	"backend/internal/models"
+	"backend/internal/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	defaultAdminPageSize = 50
+	maxAdminPageSize     = 200
+)
+
+// adminPage reads limit and offset query parameters
+func adminPage(r *http.Request) (limit, offset int) {
+	limit, _ = strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit < 1 {
+		limit = defaultAdminPageSize
+	}
+	if limit > maxAdminPageSize {
+		limit = maxAdminPageSize
+	}
+	offset, _ = strconv.Atoi(r.URL.Query().Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// adminTarget reads the {id} URL parameter and refuses actions an admin
+// takes against their own account
+func adminTarget(w http.ResponseWriter, r *http.Request) (int, *auth.Claims, bool) {
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return 0, nil, false
+	}
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return 0, nil, false
+	}
+	if userID == claims.UserID {
+		http.Error(w, "Admins cannot change their own account", http.StatusBadRequest)
+		return 0, nil, false
+	}
+	return userID, claims, true
+}
+
+// readReason decodes an optional {"reason": "..."} body
+func readReason(r *http.Request) (string, error) {
+	var req models.ReasonRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSpace(req.Reason), nil
+}
+
+const userSummaryColumns = `id, username, role, address, lat, long, shop_status, shop_rejection_reason,
+	suspended_at, suspension_reason, created_at`
+
+func scanUserSummary(row pgx.Row) (models.UserSummary, error) {
+	var u models.UserSummary
+	err := row.Scan(&u.ID, &u.Username, &u.Role, &u.Address, &u.Lat, &u.Long, &u.ShopStatus,
+		&u.ShopRejectionReason, &u.SuspendedAt, &u.SuspensionReason, &u.CreatedAt)
+	return u, err
+}
+
+// ListUsers lists and searches user accounts. Filters: q (username or
+// address contains), role, suspended=true|false, limit and offset.
+func ListUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	conditions := []string{"deleted_at IS NULL"}
+	var args []any
+
+	if q := strings.TrimSpace(query.Get("q")); q != "" {
+		args = append(args, "%"+q+"%")
+		conditions = append(conditions, "(username ILIKE $"+strconv.Itoa(len(args))+" OR address ILIKE $"+strconv.Itoa(len(args))+")")
+	}
+	if role := query.Get("role"); role != "" {
+		args = append(args, role)
+		conditions = append(conditions, "role = $"+strconv.Itoa(len(args)))
+	}
+	switch query.Get("suspended") {
+	case "true":
+		conditions = append(conditions, "suspended_at IS NOT NULL")
+	case "false":
+		conditions = append(conditions, "suspended_at IS NULL")
+	}
+
+	limit, offset := adminPage(r)
+	args = append(args, limit, offset)
+	rows, err := database.DB.Query(context.Background(),
+		"SELECT "+userSummaryColumns+" FROM users WHERE "+strings.Join(conditions, " AND ")+
+			" ORDER BY id LIMIT $"+strconv.Itoa(len(args)-1)+" OFFSET $"+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	users := []models.UserSummary{}
+	for rows.Next() {
+		u, err := scanUserSummary(rows)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+// updateUserAccount runs sql against a user that has not been deleted. When
+// lockOut is set it then revokes all of the user's sessions and, for a shop,
+// expires the jobs it can no longer print, see expireShopJobs.
+func updateUserAccount(w http.ResponseWriter, sql string, args []any, lockOut *lockOut, message string) {
+	ctx := context.Background()
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	var storageKeys []string
+	if lockOut != nil {
+		err = revokeSessions(ctx, tx, args[0].(int))
+		if err == nil {
+			storageKeys, err = expireShopJobs(ctx, tx, args[0].(int), lockOut.by, lockOut.note)
+		}
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	for _, key := range storageKeys {
+		storage.Files.Delete(ctx, key)
+	}
+
+	response := map[string]interface{}{"message": message}
+	if lockOut != nil {
+		response["jobs_expired"] = len(storageKeys)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// lockOut says who is suspending or deleting an account, and why
+type lockOut struct {
+	by   int
+	note string
+}
+
+// expireShopJobs expires every job at a shop that has not been printed yet,
+// since the shop will not print it, and refunds whatever was collected for
+// each as ExpireJob does. Printed jobs stay waiting for pickup. It returns
+// the storage keys of the expired jobs, to be deleted once tx commits.
+func expireShopJobs(ctx context.Context, tx pgx.Tx, shopID, changedBy int, note string) ([]string, error) {
+	open := []string{string(jobs.PendingPayment), string(jobs.Queued), string(jobs.Printing), string(jobs.Failed)}
+	var found bool
+	err := tx.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM files WHERE shop_id = $1 AND status = ANY($2))", shopID, open).Scan(&found)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	// The queue is locked before the file rows, as for every queue change,
+	// so no job joins it while it is emptied
+	if err := jobs.LockQueue(ctx, tx, shopID); err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query(ctx,
+		"SELECT id, user_id, storage_key FROM files WHERE shop_id = $1 AND status = ANY($2) ORDER BY id", shopID, open)
+	if err != nil {
+		return nil, err
+	}
+	type openJob struct {
+		id, customerID int
+		storageKey     string
+	}
+	var expire []openJob
+	for rows.Next() {
+		var job openJob
+		if err := rows.Scan(&job.id, &job.customerID, &job.storageKey); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		expire = append(expire, job)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var storageKeys []string
+	for _, job := range expire {
+		if _, err := jobs.Transition(ctx, tx, job.id, changedBy, note, jobs.Expired); err != nil {
+			return nil, err
+		}
+		if _, err := refundJob(ctx, tx, job.id, job.customerID, changedBy, note); err != nil {
+			return nil, err
+		}
+		if err := events.Notify(ctx, tx, events.JobUpdated, job.id); err != nil {
+			return nil, err
+		}
+		storageKeys = append(storageKeys, job.storageKey)
+	}
+	return storageKeys, nil
+}
+
+// SuspendUser blocks a user from logging in and revokes their sessions.
+// A suspended shop is also hidden from customers and stops receiving jobs,
+// and the jobs waiting at it are expired and refunded.
+func SuspendUser(w http.ResponseWriter, r *http.Request) {
+	userID, claims, ok := adminTarget(w, r)
+	if !ok {
+		return
+	}
+	reason, err := readReason(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	note := "shop suspended"
+	if reason != "" {
+		note += ": " + reason
+	}
+	updateUserAccount(w,
+		"UPDATE users SET suspended_at = NOW(), suspension_reason = $2 WHERE id = $1 AND deleted_at IS NULL",
+		[]any{userID, reason}, &lockOut{by: claims.UserID, note: note}, "User suspended")
+}
+
+// UnsuspendUser lets a suspended user log in again
+func UnsuspendUser(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := adminTarget(w, r)
+	if !ok {
+		return
+	}
+
+	updateUserAccount(w,
+		"UPDATE users SET suspended_at = NULL, suspension_reason = NULL WHERE id = $1 AND deleted_at IS NULL",
+		[]any{userID}, nil, "User unsuspended")
+}
+
+// DeleteUser closes an account. The row is kept so that jobs, refunds and
+// status history still resolve, but the username, password and location
+// are wiped and every session is revoked. Jobs waiting at a deleted shop
+// are expired and refunded.
+func DeleteUser(w http.ResponseWriter, r *http.Request) {
+	userID, claims, ok := adminTarget(w, r)
+	if !ok {
+		return
+	}
+
+	updateUserAccount(w,
+		`UPDATE users SET deleted_at = NOW(), username = 'deleted-' || id, password_hash = '',
+		 lat = NULL, long = NULL, address = NULL
+		 WHERE id = $1 AND deleted_at IS NULL`,
+		[]any{userID}, &lockOut{by: claims.UserID, note: "shop deleted"}, "User deleted")
+}
+
+// ListShops lists shop applications, by default those waiting for review,
+// oldest submission first. Filter with status=pending|approved|rejected.
+func ListShops(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = "pending"
+	}
+
+	limit, offset := adminPage(r)
+	rows, err := database.DB.Query(context.Background(),
+		"SELECT "+shopApplicationColumns+shopApplicationJoins+`
+		 WHERE u.role = 'shopkeeper' AND u.shop_status = $1 AND u.deleted_at IS NULL
+		 ORDER BY s.submitted_at, u.id LIMIT $2 OFFSET $3`, status, limit, offset)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	shops := []models.ShopApplication{}
+	for rows.Next() {
+		a, err := scanShopApplication(rows)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		shops = append(shops, a)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shops)
+}
+
+// reviewShop sets the review outcome of a shop application and records which
+// admin reviewed it
+const reviewShop = `WITH reviewed AS (
+	UPDATE users SET shop_status = $2, shop_rejection_reason = $3
+	WHERE id = $1 AND role = 'shopkeeper' AND deleted_at IS NULL
+	RETURNING id
+)
+UPDATE shops SET reviewed_at = NOW(), reviewed_by = $4 FROM reviewed WHERE shops.user_id = reviewed.id`
+
+// ApproveShop lists a shop so customers can find it and send it jobs
+func ApproveShop(w http.ResponseWriter, r *http.Request) {
+	shopID, claims, ok := adminTarget(w, r)
+	if !ok {
+		return
+	}
+
+	updateUserAccount(w, reviewShop, []any{shopID, "approved", nil, claims.UserID}, nil, "Shop approved")
+}
+
+// RejectShop turns down a shop application with a reason shown to the
+// shopkeeper, who can correct it and submit again
+func RejectShop(w http.ResponseWriter, r *http.Request) {
+	shopID, claims, ok := adminTarget(w, r)
+	if !ok {
+		return
+	}
+	reason, err := readReason(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if reason == "" {
+		http.Error(w, "reason is required", http.StatusBadRequest)
+		return
+	}
+
+	updateUserAccount(w, reviewShop, []any{shopID, "rejected", reason, claims.UserID}, nil, "Shop rejected")
+}
+
+const jobDetailColumns = `f.id, f.user_id, f.storage_key, f.unique_code, f.status, f.created_at, f.print_type,
+	f.copies, f.print_mode, f.color_mode, f.paper_size, f.num_pages, f.total_cost, f.shop_id,
+	q.queue_position, f.price_card_version, f.payment_method, f.paid_at, c.username, s.username, f.progress`
+
+const jobDetailJoins = ` FROM files f
+	JOIN users c ON c.id = f.user_id
+	LEFT JOIN users s ON s.id = f.shop_id
+	LEFT JOIN queue_positions q ON q.file_id = f.id`
+
+func scanJobDetail(row pgx.Row) (models.JobDetail, error) {
+	var j models.JobDetail
+	err := row.Scan(&j.ID, &j.UserID, &j.StorageKey, &j.UniqueCode, &j.Status, &j.CreatedAt, &j.PrintType,
+		&j.Copies, &j.PrintMode, &j.ColorMode, &j.PaperSize, &j.NumPages, &j.TotalCost, &j.ShopID,
+		&j.QueuePosition, &j.PriceCardVersion, &j.PaymentMethod, &j.PaidAt, &j.Customer, &j.Shop, &j.Progress)
+	return j, err
+}
+
+// ListJobs lists jobs across all shops, newest first. Filters: status,
+// shop_id, user_id, limit and offset.
+func ListJobs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var conditions []string
+	var args []any
+
+	if status := query.Get("status"); status != "" {
+		args = append(args, status)
+		conditions = append(conditions, "f.status = $"+strconv.Itoa(len(args)))
+	}
+	for _, filter := range []struct{ param, column string }{{"shop_id", "f.shop_id"}, {"user_id", "f.user_id"}} {
+		if v := query.Get(filter.param); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				http.Error(w, "Invalid "+filter.param, http.StatusBadRequest)
+				return
+			}
+			args = append(args, id)
+			conditions = append(conditions, filter.column+" = $"+strconv.Itoa(len(args)))
+		}
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	limit, offset := adminPage(r)
+	args = append(args, limit, offset)
+	rows, err := database.DB.Query(context.Background(),
+		"SELECT "+jobDetailColumns+jobDetailJoins+where+
+			" ORDER BY f.created_at DESC, f.id DESC LIMIT $"+strconv.Itoa(len(args)-1)+" OFFSET $"+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	list := []models.JobDetail{}
+	for rows.Next() {
+		j, err := scanJobDetail(rows)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		list = append(list, j)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// GetJob returns any job with its full status history
+func GetJob(w http.ResponseWriter, r *http.Request) {
+	fileID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	job, err := scanJobDetail(database.DB.QueryRow(ctx,
+		"SELECT "+jobDetailColumns+jobDetailJoins+" WHERE f.id = $1", fileID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := database.DB.Query(ctx,
+		`SELECT from_status, to_status, changed_by, note, changed_at
+		 FROM file_status_history WHERE file_id = $1 ORDER BY changed_at, id`, fileID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	job.History = []models.StatusChange{}
+	for rows.Next() {
+		var c models.StatusChange
+		if err := rows.Scan(&c.FromStatus, &c.ToStatus, &c.ChangedBy, &c.Note, &c.ChangedAt); err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		job.History = append(job.History, c)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// ExpireJob force-expires a job that is stuck in any non-terminal status,
+// removes its document and, unless it was already printed, refunds whatever
+// was collected for it
+func ExpireJob(w http.ResponseWriter, r *http.Request) {
+	fileID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	reason, err := readReason(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	note := "expired by admin"
+	if reason != "" {
+		note += ": " + reason
+	}
+
+	ctx := context.Background()
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	from, err := jobs.Transition(ctx, tx, fileID, claims.UserID, note, jobs.Expired)
+	if err != nil {
+		writeTransitionError(w, err)
+		return
+	}
+
+	var ownerID int
+	var storageKey string
+	err = tx.QueryRow(ctx,
+		"SELECT user_id, storage_key FROM files WHERE id = $1", fileID).Scan(&ownerID, &storageKey)
+
+	// The customer never got prints for a job that expired before printing
+	// finished, so whatever was collected for it goes back
+	if err == nil && from != jobs.Printed {
+		_, err = refundJob(ctx, tx, fileID, ownerID, claims.UserID, note)
+	}
+	if err == nil {
+		err = events.Notify(ctx, tx, events.JobUpdated, fileID)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Delete the file from storage
+	storage.Files.Delete(ctx, storageKey)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Job expired", "previous_status": string(from)})
+}
+
+// countBy runs a "SELECT key, COUNT(*) ... GROUP BY key" query into a map
+func countBy(ctx context.Context, sql string, args ...any) (map[string]int, error) {
+	rows, err := database.DB.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var key string
+		var n int
+		if err := rows.Scan(&key, &n); err != nil {
+			return nil, err
+		}
+		counts[key] = n
+	}
+	return counts, rows.Err()
+}
+
+// GetPlatformStats returns platform-wide counts of users, shops, jobs and money
+func GetPlatformStats(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	var stats models.PlatformStats
+	var err error
+
+	stats.UsersByRole, err = countBy(ctx,
+		"SELECT role, COUNT(*) FROM users WHERE deleted_at IS NULL GROUP BY role")
+	if err == nil {
+		stats.ShopsByStatus, err = countBy(ctx,
+			"SELECT shop_status, COUNT(*) FROM users WHERE role = 'shopkeeper' AND deleted_at IS NULL GROUP BY shop_status")
+	}
+	if err == nil {
+		stats.JobsByStatus, err = countBy(ctx, "SELECT status, COUNT(*) FROM files GROUP BY status")
+	}
+	if err == nil {
+		err = database.DB.QueryRow(ctx,
+			`SELECT
+			   (SELECT COUNT(*) FROM users WHERE suspended_at IS NOT NULL AND deleted_at IS NULL),
+			   (SELECT COUNT(*) FROM files WHERE created_at > NOW() - INTERVAL '24 hours'),
+			   (SELECT COALESCE(SUM(num_pages * copies), 0) FROM files WHERE status = ANY($1)),
+			   (SELECT COALESCE(SUM(total_cost), 0) FROM files WHERE status = ANY($1)),
+			   (SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE status = 'pending'),
+			   (SELECT COUNT(*) FROM files WHERE status = ANY($2))`,
+			jobs.DoneStatuses(), jobs.QueueStatuses()).Scan(&stats.SuspendedUsers, &stats.JobsLast24h,
+			&stats.PagesPrinted, &stats.Revenue, &stats.PendingRefunds, &stats.ActiveQueueJobs)
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
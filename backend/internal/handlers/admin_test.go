@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"backend/internal/database"
+	"backend/internal/database/dbtest"
+	"backend/internal/jobs"
+	"backend/internal/money"
+	"backend/internal/wallet"
+)
+
+func TestLockOutShopExpiresJobs(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"suspend", SuspendUser},
+		{"delete", DeleteUser},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t)
+			customer := dbtest.CreateUser(t, "customer")
+			admin := dbtest.CreateUser(t, "admin")
+			shop := dbtest.CreateShop(t, 12.97, 77.59)
+			other := dbtest.CreateShop(t, 12.98, 77.6)
+
+			ctx := context.Background()
+			tx, err := database.DB.Begin(ctx)
+			if err == nil {
+				err = wallet.AddFunds(ctx, tx, customer, money.Paise(100000), "test", admin)
+			}
+			if err == nil {
+				err = tx.Commit(ctx)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			walletJob := queueJob(t, customer, shop, payWallet, false)
+			cashJob := queueJob(t, customer, shop, payCash, false)
+			printedJob := queueJob(t, customer, shop, payWallet, false)
+			otherJob := queueJob(t, customer, other, payWallet, false)
+			if _, err := database.DB.Exec(ctx, "UPDATE files SET status = 'printed' WHERE id = $1", printedJob); err != nil {
+				t.Fatal(err)
+			}
+			before := balance(t, customer)
+
+			w := httptest.NewRecorder()
+			tt.handler(w, as(withID(httptest.NewRequest(http.MethodPost, "/", nil), "id", shop), admin, "admin"))
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s: %d %s", tt.name, w.Code, w.Body)
+			}
+			var response struct {
+				JobsExpired int `json:"jobs_expired"`
+			}
+			json.NewDecoder(w.Body).Decode(&response)
+			if response.JobsExpired != 2 {
+				t.Errorf("jobs_expired %d, want 2", response.JobsExpired)
+			}
+
+			want := map[int]struct {
+				status jobs.Status
+				refund string
+			}{
+				walletJob:  {jobs.Expired, "credited"},
+				cashJob:    {jobs.Expired, ""},
+				printedJob: {jobs.Printed, ""},
+				otherJob:   {jobs.Queued, ""},
+			}
+			for fileID, want := range want {
+				if status, _ := jobState(t, fileID); status != want.status {
+					t.Errorf("job %d is %s, want %s", fileID, status, want.status)
+				}
+				if refund := refundOf(t, fileID); refund != want.refund {
+					t.Errorf("job %d refund %q, want %q", fileID, refund, want.refund)
+				}
+			}
+			if got := balance(t, customer); got <= before {
+				t.Errorf("balance %s after the wallet job was refunded, was %s", got, before)
+			}
+			if n := countRows(t, "SELECT COUNT(*) FROM queue_positions WHERE shop_id = $1", shop); n != 0 {
+				t.Errorf("%d jobs still in the shop queue", n)
+			}
+		})
+	}
+}
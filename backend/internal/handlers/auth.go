@@ -1,73 +1,318 @@
-package handlers
-
-import (
-	"encoding/json"
-	"net/http"
-
-	"backend/internal/auth"
-	"backend/internal/database"
-	"backend/internal/models"
-	"context"
-)
-
-func Register(w http.ResponseWriter, r *http.Request) {
-	var req models.RegisterRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	hashedPassword, err := auth.HashPassword(req.Password)
-	if err != nil {
-		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
-		return
-	}
-
-	var userID int
-	err = database.DB.QueryRow(context.Background(),
-		"INSERT INTO users (username, password_hash, role, lat, long, address) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
-		req.Username, hashedPassword, req.Role, req.Lat, req.Long, req.Address).Scan(&userID)
-
-	if err != nil {
-		http.Error(w, "Failed to register user: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]int{"user_id": userID})
-}
-
-func Login(w http.ResponseWriter, r *http.Request) {
-	var req models.LoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	var user models.User
-	err := database.DB.QueryRow(context.Background(),
-		"SELECT id, username, password_hash, role FROM users WHERE username = $1",
-		req.Username).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Role)
-
-	if err != nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
-		return
-	}
-
-	if !auth.CheckPasswordHash(req.Password, user.PasswordHash) {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
-		return
-	}
-
-	token, err := auth.GenerateToken(user.ID, user.Role)
-	if err != nil {
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
-		return
-	}
-
-	json.NewEncoder(w).Encode(models.LoginResponse{
-		Token:    token,
-		Role:     user.Role,
-		Username: user.Username,
-	})
-}
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"backend/internal/auth"
+	"backend/internal/database"
+	"backend/internal/models"
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func Register(w http.ResponseWriter, r *http.Request) {
+	var req models.RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Admins are created with "api create-admin", never through registration
+	if req.Role == "" {
+		req.Role = auth.RoleCustomer
+	}
+	if req.Role != auth.RoleCustomer && req.Role != auth.RoleShopkeeper {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	// New shops are hidden from customers until an admin approves them
+	var shopStatus *string
+	if req.Role == auth.RoleShopkeeper {
+		if req.Shop == nil {
+			http.Error(w, "shop details are required for shopkeepers", http.StatusBadRequest)
+			return
+		}
+		if err := validateShopApplication(req.Shop, req.Address, req.Lat, req.Long); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		pending := "pending"
+		shopStatus = &pending
+	}
+
+	hashedPassword, err := auth.HashPassword(req.Password)
+	if err != nil {
+		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var userID int
+	err = tx.QueryRow(ctx,
+		`INSERT INTO users (username, password_hash, role, lat, long, address, shop_status)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+		req.Username, hashedPassword, req.Role, req.Lat, req.Long, req.Address, shopStatus).Scan(&userID)
+
+	if err == nil && req.Role == auth.RoleShopkeeper {
+		err = saveShopDetails(ctx, tx, userID, *req.Shop)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		http.Error(w, "Failed to register user: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]int{"user_id": userID})
+}
+
+func Login(w http.ResponseWriter, r *http.Request) {
+	var req models.LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	var generation int
+	var suspended bool
+	err := database.DB.QueryRow(context.Background(),
+		`SELECT id, username, password_hash, role, token_generation, suspended_at IS NOT NULL
+		 FROM users WHERE username = $1 AND deleted_at IS NULL`,
+		req.Username).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Role, &generation, &suspended)
+
+	if err != nil {
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	if !auth.CheckPasswordHash(req.Password, user.PasswordHash) {
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	if suspended {
+		http.Error(w, "Account suspended", http.StatusForbidden)
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	response, err := issueTokens(ctx, tx, user.ID, user.Username, user.Role, generation, 0)
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// issueTokens creates an access token and stores a new refresh token for a
+// user's session. A sessionID of 0 starts a new session.
+func issueTokens(ctx context.Context, tx pgx.Tx, userID int, username, role string, generation, sessionID int) (*models.LoginResponse, error) {
+	// Expired refresh tokens are of no further use, even for reuse detection,
+	// and a session without refresh tokens has long outlived its access tokens
+	_, err := tx.Exec(ctx, "DELETE FROM refresh_tokens WHERE user_id = $1 AND expires_at < NOW()", userID)
+	if err == nil {
+		_, err = tx.Exec(ctx,
+			`DELETE FROM sessions s WHERE user_id = $1
+			 AND NOT EXISTS (SELECT 1 FROM refresh_tokens WHERE session_id = s.id)`, userID)
+	}
+	if err == nil && sessionID == 0 {
+		err = tx.QueryRow(ctx, "INSERT INTO sessions (user_id) VALUES ($1) RETURNING id", userID).Scan(&sessionID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := auth.GenerateToken(userID, role, generation, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, refreshHash, err := auth.NewRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(ctx,
+		"INSERT INTO refresh_tokens (user_id, session_id, token_hash, expires_at) VALUES ($1, $2, $3, $4)",
+		userID, sessionID, refreshHash, time.Now().Add(auth.RefreshTokenTTL))
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.LoginResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(auth.AccessTokenTTL.Seconds()),
+		Role:         role,
+		Username:     username,
+	}, nil
+}
+
+// revokeSessions revokes every session and refresh token of a user and
+// bumps the token generation, which invalidates all access tokens issued so far
+func revokeSessions(ctx context.Context, tx pgx.Tx, userID int) error {
+	_, err := tx.Exec(ctx,
+		"UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, "UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, "UPDATE users SET token_generation = token_generation + 1 WHERE id = $1", userID)
+	return err
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a new
+// refresh token. Each refresh token works once; presenting one that was
+// already exchanged means it was copied, so every session of the user is
+// revoked. A token revoked by logging out is just refused.
+func RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var tokenID, userID, generation, sessionID int
+	var username, role string
+	var expiresAt time.Time
+	var revokedAt *time.Time
+	var rotated bool
+	err = tx.QueryRow(ctx,
+		`SELECT rt.id, rt.user_id, COALESCE(rt.session_id, 0), rt.expires_at, rt.revoked_at, rt.replaced_by IS NOT NULL,
+		   u.username, u.role, u.token_generation
+		 FROM refresh_tokens rt JOIN users u ON u.id = rt.user_id
+		 WHERE rt.token_hash = $1 AND u.suspended_at IS NULL AND u.deleted_at IS NULL
+		 FOR UPDATE OF rt`,
+		auth.HashRefreshToken(req.RefreshToken)).Scan(&tokenID, &userID, &sessionID, &expiresAt, &revokedAt, &rotated, &username, &role, &generation)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// A rotated token presented again was copied. One revoked by a logout
+	// is merely stale, from a tab or a retry, and changes nothing.
+	if rotated {
+		if err := revokeSessions(ctx, tx, userID); err == nil {
+			tx.Commit(ctx)
+		}
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if revokedAt != nil {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if time.Now().After(expiresAt) {
+		http.Error(w, "Refresh token expired", http.StatusUnauthorized)
+		return
+	}
+
+	response, err := issueTokens(ctx, tx, userID, username, role, generation, sessionID)
+	if err == nil {
+		_, err = tx.Exec(ctx,
+			`UPDATE refresh_tokens SET revoked_at = NOW(),
+			 replaced_by = (SELECT id FROM refresh_tokens WHERE token_hash = $1) WHERE id = $2`,
+			auth.HashRefreshToken(response.RefreshToken), tokenID)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// Logout ends the caller's session: its refresh tokens stop working and its
+// access tokens, including a stolen one, are rejected immediately. Other
+// devices stay logged in. With "all": true every session of the user ends.
+func Logout(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.LogoutRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx := context.Background()
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if req.All {
+		err = revokeSessions(ctx, tx, claims.UserID)
+	} else {
+		// Access tokens issued before sessions existed carry none; their
+		// refresh token is revoked if presented and they expire on their own
+		_, err = tx.Exec(ctx,
+			"UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL",
+			claims.SessionID, claims.UserID)
+		if err == nil {
+			_, err = tx.Exec(ctx,
+				`UPDATE refresh_tokens SET revoked_at = NOW()
+				 WHERE user_id = $1 AND (session_id = $2 OR token_hash = $3) AND revoked_at IS NULL`,
+				claims.UserID, claims.SessionID, auth.HashRefreshToken(req.RefreshToken))
+		}
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out"})
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"backend/internal/auth"
+	"backend/internal/database"
+	"backend/internal/database/dbtest"
+	"backend/internal/models"
+)
+
+// login starts a session for a user as POST /login does
+func login(t *testing.T, userID int) *models.LoginResponse {
+	t.Helper()
+	ctx := context.Background()
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback(ctx)
+	response, err := issueTokens(ctx, tx, userID, "customer", "customer", 0, 0)
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+// refresh exchanges a refresh token and returns the response status and tokens
+func refresh(t *testing.T, token string) (int, *models.LoginResponse) {
+	t.Helper()
+	body, _ := json.Marshal(models.RefreshRequest{RefreshToken: token})
+	w := httptest.NewRecorder()
+	RefreshToken(w, httptest.NewRequest(http.MethodPost, "/refresh", bytes.NewReader(body)))
+	var response models.LoginResponse
+	json.NewDecoder(w.Body).Decode(&response)
+	return w.Code, &response
+}
+
+func logout(t *testing.T, session *models.LoginResponse, all bool) {
+	t.Helper()
+	claims, err := auth.Authenticate(session.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := json.Marshal(models.LogoutRequest{RefreshToken: session.RefreshToken, All: all})
+	r := httptest.NewRequest(http.MethodPost, "/logout", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	Logout(w, r.WithContext(context.WithValue(r.Context(), auth.UserKey, claims)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("logout: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestLogoutEndsOneSession(t *testing.T) {
+	dbtest.Setup(t)
+	user := dbtest.CreateUser(t, "customer")
+	phone, laptop := login(t, user), login(t, user)
+
+	// The phone refreshes once, so its session has an older access token
+	oldPhoneToken := phone.Token
+	if code, next := refresh(t, phone.RefreshToken); code != http.StatusOK {
+		t.Fatalf("refresh: %d", code)
+	} else {
+		phone = next
+	}
+
+	logout(t, phone, false)
+
+	for name, token := range map[string]string{"access token": phone.Token, "earlier access token": oldPhoneToken} {
+		if _, err := auth.Authenticate(token); !errors.Is(err, auth.ErrTokenRevoked) {
+			t.Errorf("logged out %s: %v, want ErrTokenRevoked", name, err)
+		}
+	}
+	// A stale tab sends the logged out refresh token again. It is refused,
+	// but it is not a stolen token, so the laptop stays logged in.
+	if code, _ := refresh(t, phone.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("logged out refresh token: %d, want 401", code)
+	}
+	if _, err := auth.Authenticate(laptop.Token); err != nil {
+		t.Errorf("other session's access token: %v", err)
+	}
+	if code, _ := refresh(t, laptop.RefreshToken); code != http.StatusOK {
+		t.Errorf("other session's refresh: %d, want 200", code)
+	}
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	dbtest.Setup(t)
+	user := dbtest.CreateUser(t, "customer")
+	phone, laptop := login(t, user), login(t, user)
+
+	stolen := phone.RefreshToken
+	if code, _ := refresh(t, stolen); code != http.StatusOK {
+		t.Fatalf("refresh: %d", code)
+	}
+
+	// The rotated token is used again, so one of its holders stole it
+	if code, _ := refresh(t, stolen); code != http.StatusUnauthorized {
+		t.Errorf("reused refresh token: %d, want 401", code)
+	}
+	if _, err := auth.Authenticate(laptop.Token); !errors.Is(err, auth.ErrTokenRevoked) {
+		t.Errorf("other session after reuse: %v, want ErrTokenRevoked", err)
+	}
+	if code, _ := refresh(t, laptop.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("other session's refresh after reuse: %d, want 401", code)
+	}
+}
+
+func TestLogoutAll(t *testing.T) {
+	dbtest.Setup(t)
+	user := dbtest.CreateUser(t, "customer")
+	phone, laptop := login(t, user), login(t, user)
+
+	logout(t, phone, true)
+
+	for name, session := range map[string]*models.LoginResponse{"phone": phone, "laptop": laptop} {
+		if _, err := auth.Authenticate(session.Token); !errors.Is(err, auth.ErrTokenRevoked) {
+			t.Errorf("%s access token: %v, want ErrTokenRevoked", name, err)
+		}
+		if code, _ := refresh(t, session.RefreshToken); code != http.StatusUnauthorized {
+			t.Errorf("%s refresh token: %d, want 401", name, code)
+		}
+	}
+}
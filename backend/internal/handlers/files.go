@@ -1,573 +1,768 @@
-package handlers
-
-import (
-	"backend/internal/auth"
-	"backend/internal/database"
-	"backend/internal/models"
-	"backend/internal/utils"
-	"context"
-	"encoding/json"
-	"fmt"
-	"io"
-	"math"
-	"math/rand"
-	"net/http"
-	"os"
-	"path/filepath"
-	"sort"
-	"strconv"
-	"time"
-
-	"github.com/go-chi/chi/v5"
-)
-
-const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-
-func generateUniqueCode(length int) string {
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = charset[rand.Intn(len(charset))]
-	}
-	return string(b)
-}
-
-func UploadFile(w http.ResponseWriter, r *http.Request) {
-	// Limit file size to 10MB
-	r.ParseMultipartForm(10 << 20)
-
-	file, handler, err := r.FormFile("file")
-	if err != nil {
-		http.Error(w, "Error retrieving file", http.StatusBadRequest)
-		return
-	}
-	defer file.Close()
-
-	// Create uploads directory if not exists
-	if _, err := os.Stat("uploads"); os.IsNotExist(err) {
-		os.Mkdir("uploads", 0755)
-	}
-
-	filename := fmt.Sprintf("%d-%s", time.Now().Unix(), handler.Filename)
-	filePath := filepath.Join("uploads", filename)
-
-	dst, err := os.Create(filePath)
-	if err != nil {
-		http.Error(w, "Error saving file", http.StatusInternalServerError)
-		return
-	}
-	defer dst.Close()
-
-	if _, err := io.Copy(dst, file); err != nil {
-		http.Error(w, "Error saving file", http.StatusInternalServerError)
-		return
-	}
-
-	// Get user ID from context
-	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
-	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-	userID := claims.UserID
-
-	// Parse print settings from form data
-	printType := r.FormValue("print_type")
-	if printType == "" {
-		printType = "private"
-	}
-
-	copies, _ := strconv.Atoi(r.FormValue("copies"))
-	if copies < 1 {
-		copies = 1
-	}
-
-	printMode := r.FormValue("print_mode")
-	if printMode == "" {
-		printMode = "single"
-	}
-
-	colorMode := r.FormValue("color_mode")
-	if colorMode == "" {
-		colorMode = "bw"
-	}
-
-	paperSize := r.FormValue("paper_size")
-	if paperSize == "" {
-		paperSize = "A4"
-	}
-
-	// Count PDF pages
-	numPages, err := utils.CountPDFPages(filePath)
-	if err != nil {
-		// If page counting fails, default to 1
-		numPages = 1
-	}
-
-	// Calculate cost
-	totalCost := utils.CalculateCost(numPages, copies)
-
-	// Generate unique code
-	uniqueCode := generateUniqueCode(6)
-
-	// Handle queue print
-	var shopID *int
-	var queuePosition *int
-
-	if printType == "queue" {
-		shopIDStr := r.FormValue("shop_id")
-		if shopIDStr != "" {
-			sid, err := strconv.Atoi(shopIDStr)
-			if err == nil {
-				shopID = &sid
-
-				// Get current queue position for this shop
-				var maxPos int
-				err = database.DB.QueryRow(context.Background(),
-					"SELECT COALESCE(MAX(queue_position), 0) FROM files WHERE shop_id = $1 AND status != 'downloaded'",
-					sid).Scan(&maxPos)
-				if err == nil {
-					newPos := maxPos + 1
-					queuePosition = &newPos
-				}
-			}
-		}
-	}
-
-	// Insert into database
-	var fileID int
-	err = database.DB.QueryRow(context.Background(),
-		`INSERT INTO files (user_id, file_path, unique_code, print_type, copies, print_mode, 
-		 color_mode, paper_size, num_pages, total_cost, shop_id, queue_position) 
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id`,
-		userID, filePath, uniqueCode, printType, copies, printMode,
-		colorMode, paperSize, numPages, totalCost, shopID, queuePosition).Scan(&fileID)
-
-	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
-		return
-	}
-
-	// Prepare response
-	response := models.UploadResponse{
-		FileID:        fileID,
-		NumPages:      numPages,
-		TotalCost:     totalCost,
-		QueuePosition: queuePosition,
-	}
-
-	if printType == "private" {
-		response.Code = uniqueCode
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-}
-
-func DownloadFile(w http.ResponseWriter, r *http.Request) {
-	code := chi.URLParam(r, "code")
-
-	var filePath, status string
-	err := database.DB.QueryRow(context.Background(),
-		"SELECT file_path, status FROM files WHERE unique_code = $1", code).Scan(&filePath, &status)
-
-	if err != nil {
-		http.Error(w, "File not found", http.StatusNotFound)
-		return
-	}
-
-	// Check if file has already been downloaded
-	if status == "downloaded" {
-		http.Error(w, "File has already been downloaded and is no longer available", http.StatusGone)
-		return
-	}
-
-	// Serve the file
-	http.ServeFile(w, r, filePath)
-
-	// NOTE: File is no longer auto-deleted here.
-	// Shopkeeper must confirm print completion via /file/:code/confirm endpoint
-}
-
-func CheckFileStatus(w http.ResponseWriter, r *http.Request) {
-	code := chi.URLParam(r, "code")
-
-	var status string
-	var queuePosition *int
-	err := database.DB.QueryRow(context.Background(),
-		"SELECT status, queue_position FROM files WHERE unique_code = $1", code).Scan(&status, &queuePosition)
-
-	if err != nil {
-		http.Error(w, "File not found", http.StatusNotFound)
-		return
-	}
-
-	response := map[string]interface{}{
-		"status": status,
-	}
-
-	if queuePosition != nil {
-		response["queue_position"] = *queuePosition
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-}
-
-func GetNearestShops(w http.ResponseWriter, r *http.Request) {
-	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
-	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	var userLat, userLong float64
-	err := database.DB.QueryRow(context.Background(),
-		"SELECT lat, long FROM users WHERE id = $1", claims.UserID).Scan(&userLat, &userLong)
-
-	if err != nil {
-		http.Error(w, "User location not found", http.StatusNotFound)
-		return
-	}
-
-	rows, err := database.DB.Query(context.Background(),
-		"SELECT id, username, lat, long, address FROM users WHERE role = 'shopkeeper'")
-	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
-		return
-	}
-	defer rows.Close()
-
-	type Shop struct {
-		ID       int     `json:"id"`
-		Username string  `json:"username"`
-		Distance float64 `json:"distance"`
-		Address  *string `json:"address,omitempty"`
-		Lat      float64 `json:"lat"`
-		Long     float64 `json:"long"`
-	}
-
-	var shops []Shop
-	for rows.Next() {
-		var id int
-		var username string
-		var lat, long float64
-		var address *string
-		if err := rows.Scan(&id, &username, &lat, &long, &address); err != nil {
-			continue
-		}
-
-		distance := haversine(userLat, userLong, lat, long)
-		shops = append(shops, Shop{
-			ID:       id,
-			Username: username,
-			Distance: distance,
-			Address:  address,
-			Lat:      lat,
-			Long:     long,
-		})
-	}
-
-	// Sort shops by distance
-	sort.Slice(shops, func(i, j int) bool {
-		return shops[i].Distance < shops[j].Distance
-	})
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(shops)
-}
-
-func GetShopQueue(w http.ResponseWriter, r *http.Request) {
-	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
-	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	// Verify user is a shopkeeper
-	var role string
-	err := database.DB.QueryRow(context.Background(),
-		"SELECT role FROM users WHERE id = $1", claims.UserID).Scan(&role)
-	if err != nil || role != "shopkeeper" {
-		http.Error(w, "Forbidden", http.StatusForbidden)
-		return
-	}
-
-	rows, err := database.DB.Query(context.Background(),
-		`SELECT f.id, u.username, f.file_path, f.copies, f.print_mode, f.color_mode, 
-		 f.paper_size, f.num_pages, f.total_cost, f.queue_position, f.created_at
-		 FROM files f
-		 JOIN users u ON f.user_id = u.id
-		 WHERE f.shop_id = $1 AND f.status != 'downloaded' AND f.print_type = 'queue'
-		 ORDER BY f.queue_position ASC`, claims.UserID)
-
-	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
-		return
-	}
-	defer rows.Close()
-
-	var queue []models.QueueFile
-	for rows.Next() {
-		var qf models.QueueFile
-		var filePath string
-		if err := rows.Scan(&qf.ID, &qf.CustomerName, &filePath, &qf.Copies, &qf.PrintMode,
-			&qf.ColorMode, &qf.PaperSize, &qf.NumPages, &qf.TotalCost, &qf.QueuePosition, &qf.CreatedAt); err != nil {
-			continue
-		}
-		qf.Filename = filepath.Base(filePath)
-		queue = append(queue, qf)
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{"queue": queue})
-}
-
-func DownloadQueueFile(w http.ResponseWriter, r *http.Request) {
-	fileIDStr := chi.URLParam(r, "fileId")
-	fileID, err := strconv.Atoi(fileIDStr)
-	if err != nil {
-		http.Error(w, "Invalid file ID", http.StatusBadRequest)
-		return
-	}
-
-	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
-	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	// Get file info and verify it belongs to this shop
-	var filePath string
-	var shopID int
-	err = database.DB.QueryRow(context.Background(),
-		"SELECT file_path, shop_id FROM files WHERE id = $1", fileID).Scan(&filePath, &shopID)
-
-	if err != nil {
-		http.Error(w, "File not found", http.StatusNotFound)
-		return
-	}
-
-	if shopID != claims.UserID {
-		http.Error(w, "Forbidden", http.StatusForbidden)
-		return
-	}
-
-	// Serve the file
-	http.ServeFile(w, r, filePath)
-
-	// NOTE: File is no longer auto-deleted here.
-	// Shopkeeper must confirm print completion via /queue/:fileId/confirm endpoint
-}
-
-func GetMyFiles(w http.ResponseWriter, r *http.Request) {
-	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
-	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	rows, err := database.DB.Query(context.Background(),
-		`SELECT f.id, f.unique_code, f.print_type, f.status, f.copies, f.print_mode, 
-		 f.color_mode, f.paper_size, f.num_pages, f.total_cost, f.queue_position, 
-		 f.created_at, u.username as shop_name, u.lat as shop_lat, u.long as shop_long
-		 FROM files f
-		 LEFT JOIN users u ON f.shop_id = u.id
-		 WHERE f.user_id = $1
-		 ORDER BY f.created_at DESC`, claims.UserID)
-
-	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
-		return
-	}
-	defer rows.Close()
-
-	var files []map[string]interface{}
-	for rows.Next() {
-		var id int
-		var uniqueCode, printType, status, printMode, colorMode, paperSize string
-		var copies, numPages int
-		var totalCost float64
-		var queuePosition *int
-		var createdAt time.Time
-		var shopName *string
-		var shopLat, shopLong *float64
-
-		if err := rows.Scan(&id, &uniqueCode, &printType, &status, &copies, &printMode,
-			&colorMode, &paperSize, &numPages, &totalCost, &queuePosition, &createdAt, &shopName, &shopLat, &shopLong); err != nil {
-			continue
-		}
-
-		fileData := map[string]interface{}{
-			"id":         id,
-			"code":       uniqueCode,
-			"print_type": printType,
-			"status":     status,
-			"copies":     copies,
-			"print_mode": printMode,
-			"color_mode": colorMode,
-			"paper_size": paperSize,
-			"num_pages":  numPages,
-			"total_cost": totalCost,
-			"created_at": createdAt,
-		}
-
-		if queuePosition != nil {
-			fileData["queue_position"] = *queuePosition
-		}
-		if shopName != nil {
-			fileData["shop_name"] = *shopName
-		}
-		if shopLat != nil {
-			fileData["shop_lat"] = *shopLat
-		}
-		if shopLong != nil {
-			fileData["shop_long"] = *shopLong
-		}
-
-		files = append(files, fileData)
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{"files": files})
-}
-
-// ConfirmPrivatePrint marks a private print file as downloaded and deletes it
-func ConfirmPrivatePrint(w http.ResponseWriter, r *http.Request) {
-	code := chi.URLParam(r, "code")
-
-	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
-	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	var filePath string
-	err := database.DB.QueryRow(context.Background(),
-		"SELECT file_path FROM files WHERE unique_code = $1", code).Scan(&filePath)
-
-	if err != nil {
-		http.Error(w, "File not found", http.StatusNotFound)
-		return
-	}
-
-	// Update status to downloaded and set shop_id to current user (shopkeeper)
-	_, err = database.DB.Exec(context.Background(),
-		"UPDATE files SET status = 'downloaded', shop_id = $1 WHERE unique_code = $2", claims.UserID, code)
-	if err != nil {
-		fmt.Printf("Error updating file status: %v\n", err)
-	}
-
-	// Delete the file from server
-	os.Remove(filePath)
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Print confirmed"})
-}
-
-// ConfirmQueuePrint marks a queue print file as downloaded and deletes it
-func ConfirmQueuePrint(w http.ResponseWriter, r *http.Request) {
-	fileIDStr := chi.URLParam(r, "fileId")
-	fileID, err := strconv.Atoi(fileIDStr)
-	if err != nil {
-		http.Error(w, "Invalid file ID", http.StatusBadRequest)
-		return
-	}
-
-	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
-	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	// Get file info and verify it belongs to this shop
-	var filePath string
-	var shopID int
-	err = database.DB.QueryRow(context.Background(),
-		"SELECT file_path, shop_id FROM files WHERE id = $1", fileID).Scan(&filePath, &shopID)
-
-	if err != nil {
-		http.Error(w, "File not found", http.StatusNotFound)
-		return
-	}
-
-	if shopID != claims.UserID {
-		http.Error(w, "Forbidden", http.StatusForbidden)
-		return
-	}
-
-	// Update status and delete file
-	_, err = database.DB.Exec(context.Background(),
-		"UPDATE files SET status = 'downloaded' WHERE id = $1", fileID)
-	if err != nil {
-		fmt.Printf("Error updating file status: %v\n", err)
-	}
-
-	// Reorder queue positions
-	database.DB.Exec(context.Background(),
-		`UPDATE files SET queue_position = queue_position - 1 
-		 WHERE shop_id = $1 AND status != 'downloaded' AND queue_position > 
-		 (SELECT queue_position FROM files WHERE id = $2)`, shopID, fileID)
-
-	// Delete the file from server
-	os.Remove(filePath)
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Print confirmed"})
-}
-
-func haversine(lat1, lon1, lat2, lon2 float64) float64 {
-	const R = 6371 // Earth radius in kilometers
-	dLat := (lat2 - lat1) * math.Pi / 180
-	dLon := (lon2 - lon1) * math.Pi / 180
-	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
-		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*
-			math.Sin(dLon/2)*math.Sin(dLon/2)
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-	return R * c
-}
-
-func GetShopHistory(w http.ResponseWriter, r *http.Request) {
-	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
-	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	// Fetch all files printed by this shop (status='downloaded')
-	rows, err := database.DB.Query(context.Background(),
-		`SELECT id, unique_code, print_type, copies, num_pages, total_cost, created_at 
-		 FROM files 
-		 WHERE shop_id = $1 AND status = 'downloaded' 
-		 ORDER BY created_at DESC`, claims.UserID)
-
-	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
-		return
-	}
-	defer rows.Close()
-
-	var history []map[string]interface{}
-	for rows.Next() {
-		var id, copies, numPages int
-		var uniqueCode, printType string
-		var totalCost float64
-		var createdAt time.Time
-
-		if err := rows.Scan(&id, &uniqueCode, &printType, &copies, &numPages, &totalCost, &createdAt); err != nil {
-			continue
-		}
-
-		history = append(history, map[string]interface{}{
-			"id":     id,
-			"code":   uniqueCode,
-			"type":   printType,
-			"copies": copies,
-			"pages":  numPages,
-			"cost":   totalCost,
-			"date":   createdAt,
-		})
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{"history": history})
-}
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/database"
+	"backend/internal/encryption"
+	"backend/internal/events"
+	"backend/internal/jobs"
+	"backend/internal/models"
+	"backend/internal/money"
+	"backend/internal/storage"
+	"backend/internal/wallet"
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+func generateUniqueCode(length int) string {
+	b := make([]byte, length)
+	for i := range b {
+		b[i] = charset[rand.Intn(len(charset))]
+	}
+	return string(b)
+}
+
+// printSettings holds the print options a customer submits with a document
+type printSettings struct {
+	Copies    int
+	PrintMode string
+	ColorMode string
+	PaperSize string
+}
+
+// maxCopies is the most copies of a document one job may ask for, the
+// copies-supported range the IPP printers advertise
+const maxCopies = 999
+
+var errCopiesOutOfRange = fmt.Errorf("copies must be between 1 and %d", maxCopies)
+
+// parsePrintSettings reads print options from form data, applying defaults
+func parsePrintSettings(r *http.Request) (printSettings, error) {
+	settings := printSettings{
+		PrintMode: r.FormValue("print_mode"),
+		ColorMode: r.FormValue("color_mode"),
+		PaperSize: r.FormValue("paper_size"),
+	}
+
+	if copies := r.FormValue("copies"); copies != "" {
+		n, err := strconv.Atoi(copies)
+		if errors.Is(err, strconv.ErrRange) || n > maxCopies {
+			return settings, errCopiesOutOfRange
+		}
+		settings.Copies = n
+	}
+	if settings.Copies < 1 {
+		settings.Copies = 1
+	}
+	if settings.PrintMode == "" {
+		settings.PrintMode = "single"
+	}
+	if settings.ColorMode == "" {
+		settings.ColorMode = "bw"
+	}
+	if settings.PaperSize == "" {
+		settings.PaperSize = "A4"
+	}
+	return settings, nil
+}
+
+// maxUploadSize is the largest document accepted for printing
+const maxUploadSize = 10 << 20
+
+var errUploadTooLarge = errors.New("file exceeds 10MB limit")
+
+// readUpload reads a submitted document into memory
+func readUpload(src io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(src, maxUploadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxUploadSize {
+		return nil, errUploadTooLarge
+	}
+	return data, nil
+}
+
+// newStorageKey returns a unique storage key for a document named name
+func newStorageKey(name string) string {
+	b := make([]byte, 4)
+	crand.Read(b)
+	return fmt.Sprintf("%d-%s-%s", time.Now().Unix(), hex.EncodeToString(b), filepath.Base(name))
+}
+
+// fileEnvelope returns the wrapped data key stored on a files row, or nil
+// for documents stored before encryption was enabled
+func fileEnvelope(keyID *string, wrappedKey []byte) *encryption.Envelope {
+	if keyID == nil {
+		return nil
+	}
+	return &encryption.Envelope{KeyID: *keyID, WrappedKey: wrappedKey}
+}
+
+// serveStored streams a stored document to the client as a PDF attachment,
+// decrypting it on the way out. The plaintext is never written anywhere.
+func serveStored(w http.ResponseWriter, r *http.Request, key string, env *encryption.Envelope) {
+	src, info, err := storage.Files.Open(r.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Storage error", http.StatusInternalServerError)
+		return
+	}
+	defer src.Close()
+
+	var body io.Reader = src
+	size := info.Size
+	if env != nil {
+		if body, err = encryption.Keys.Open(src, env); err != nil {
+			http.Error(w, "Storage error", http.StatusInternalServerError)
+			return
+		}
+		size = encryption.PlainSize(info.Size)
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(key)))
+	if info.Size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	if !info.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	}
+	io.Copy(w, body)
+}
+
+func UploadFile(w http.ResponseWriter, r *http.Request) {
+	// Limit file size to 10MB
+	r.ParseMultipartForm(10 << 20)
+
+	// Get user ID from context
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := claims.UserID
+
+	var name, stagedKey string
+	var data []byte
+	var err error
+	if stagedID := r.FormValue("staged_id"); stagedID != "" {
+		// Reuse a document staged earlier through POST /quote
+		stagedKey, err = stagedUploadKey(userID, stagedID)
+		if err == nil {
+			data, err = readStaged(stagedKey)
+		}
+		if err != nil {
+			http.Error(w, "Staged upload not found", http.StatusNotFound)
+			return
+		}
+		name = stagedID + ".pdf"
+	} else {
+		file, handler, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "Error retrieving file", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		data, err = readUpload(file)
+		if err != nil {
+			http.Error(w, "Error reading file", http.StatusBadRequest)
+			return
+		}
+		name = handler.Filename
+	}
+
+	// Parse print settings from form data
+	printType := r.FormValue("print_type")
+	if printType == "" {
+		printType = "private"
+	}
+
+	// Queue prints go to the shop in shop_id; createJob checks that it
+	// takes jobs
+	var shopID *int
+	if printType == "queue" {
+		sid, err := strconv.Atoi(r.FormValue("shop_id"))
+		if err != nil {
+			http.Error(w, "shop_id is required for queue prints", http.StatusBadRequest)
+			return
+		}
+		shopID = &sid
+	}
+	settings, err := parsePrintSettings(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := createJob(newJob{
+		UserID:    userID,
+		Name:      name,
+		Document:  data,
+		PrintType: printType,
+		Settings:  settings,
+		ShopID:    shopID,
+		Note:      "uploaded by customer",
+
+		PaymentMethod: r.FormValue("payment_method"),
+	})
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+
+	if stagedKey != "" {
+		deleteStaged(stagedKey)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func DownloadFile(w http.ResponseWriter, r *http.Request) {
+	code := chi.URLParam(r, "code")
+
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var fileID int
+	var shopID *int
+	var storageKey, status, printType string
+	var keyID *string
+	var wrappedKey []byte
+	err := database.DB.QueryRow(context.Background(),
+		"SELECT id, shop_id, storage_key, status, print_type, key_id, wrapped_key FROM files WHERE unique_code = $1",
+		code).Scan(&fileID, &shopID, &storageKey, &status, &printType, &keyID, &wrappedKey)
+
+	// Queue jobs also have codes, for pickup, but are only ever served to their own shop's queue
+	if err != nil || printType != "private" {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	if shopID != nil && *shopID != claims.UserID {
+		http.Error(w, "File was downloaded by another shop", http.StatusForbidden)
+		return
+	}
+
+	// Only jobs that have not been printed yet can be downloaded
+	if status != string(jobs.Uploaded) && status != string(jobs.Printing) {
+		http.Error(w, "File is no longer available", http.StatusGone)
+		return
+	}
+
+	// Redeeming the code starts printing the job at the caller's shop
+	if status == string(jobs.Uploaded) {
+		if err := claimPrivateJob(fileID, claims.UserID); err != nil {
+			writeTransitionError(w, err)
+			return
+		}
+	}
+
+	// Serve the file
+	serveStored(w, r, storageKey, fileEnvelope(keyID, wrappedKey))
+
+	// NOTE: File is no longer auto-deleted here.
+	// Shopkeeper must confirm print completion via /file/:code/confirm endpoint
+}
+
+// claimPrivateJob starts printing a private job at the shop that redeemed its
+// code. Only that shop can download the job again or confirm it. Of two shops
+// redeeming the same code, the second fails the transition.
+func claimPrivateJob(fileID, shopID int) error {
+	ctx := context.Background()
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := jobs.Transition(ctx, tx, fileID, shopID, "downloaded by shop", jobs.Printing); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, "UPDATE files SET shop_id = $1 WHERE id = $2 AND shop_id IS NULL", shopID, fileID); err != nil {
+		return err
+	}
+	if err := events.Notify(ctx, tx, events.JobUpdated, fileID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// CheckFileStatus returns the status of one of the caller's jobs by its code.
+// Codes of other customers' jobs are reported as not found.
+func CheckFileStatus(w http.ResponseWriter, r *http.Request) {
+	code := chi.URLParam(r, "code")
+
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := context.Background()
+	var fileID int
+	var shopID *int
+	var status string
+	var queuePosition *int
+	err := database.DB.QueryRow(ctx,
+		`SELECT f.id, f.shop_id, f.status, q.queue_position FROM files f
+		 LEFT JOIN queue_positions q ON q.file_id = f.id
+		 WHERE f.unique_code = $1 AND f.user_id = $2`, code, claims.UserID).Scan(&fileID, &shopID, &status, &queuePosition)
+
+	if err != nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+
+	response := map[string]interface{}{
+		"status": status,
+	}
+
+	if queuePosition != nil {
+		response["queue_position"] = *queuePosition
+
+		etas, err := jobs.LoadETAs(ctx, database.DB, []int{*shopID})
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if eta, ok := etas[fileID]; ok {
+			response["estimated_start"] = eta.Start
+			response["estimated_completion"] = eta.Completion
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// loadShopQueue returns the jobs waiting in a shop queue, in queue order,
+// with their estimated print times
+func loadShopQueue(shopID int) ([]models.QueueFile, error) {
+	ctx := context.Background()
+	rows, err := database.DB.Query(ctx,
+		`SELECT f.id, u.username, f.storage_key, f.copies, f.print_mode, f.color_mode, 
+		 f.paper_size, f.num_pages, f.total_cost, q.queue_position, f.status,
+		 f.queue_priority, f.on_hold, COALESCE(f.progress, ''), f.created_at, f.payment_method, f.paid_at
+		 FROM files f
+		 JOIN users u ON f.user_id = u.id
+		 LEFT JOIN queue_positions q ON q.file_id = f.id
+		 WHERE f.shop_id = $1 AND f.status = ANY($2) AND f.print_type = 'queue'
+		 ORDER BY f.on_hold ASC, q.queue_position ASC, f.queue_seq ASC`, shopID, jobs.QueueStatuses())
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var queue []models.QueueFile
+	for rows.Next() {
+		var qf models.QueueFile
+		var storageKey string
+		if err := rows.Scan(&qf.ID, &qf.CustomerName, &storageKey, &qf.Copies, &qf.PrintMode,
+			&qf.ColorMode, &qf.PaperSize, &qf.NumPages, &qf.TotalCost, &qf.QueuePosition, &qf.Status,
+			&qf.Priority, &qf.OnHold, &qf.Progress, &qf.CreatedAt, &qf.PaymentMethod, &qf.PaidAt); err != nil {
+			continue
+		}
+		qf.Filename = path.Base(storageKey)
+		queue = append(queue, qf)
+	}
+	rows.Close()
+
+	etas, err := jobs.LoadETAs(ctx, database.DB, []int{shopID})
+	if err != nil {
+		return nil, err
+	}
+	for i := range queue {
+		if eta, ok := etas[queue[i].ID]; ok {
+			queue[i].EstimatedStart = &eta.Start
+			queue[i].EstimatedCompletion = &eta.Completion
+		}
+	}
+
+	return queue, nil
+}
+
+func GetShopQueue(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	queue, err := loadShopQueue(claims.UserID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"queue": queue})
+}
+
+func DownloadQueueFile(w http.ResponseWriter, r *http.Request) {
+	fileIDStr := chi.URLParam(r, "fileId")
+	fileID, err := strconv.Atoi(fileIDStr)
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Get file info and verify it belongs to this shop
+	var storageKey, status string
+	var shopID int
+	var keyID *string
+	var wrappedKey []byte
+	err = database.DB.QueryRow(context.Background(),
+		"SELECT storage_key, shop_id, status, key_id, wrapped_key FROM files WHERE id = $1",
+		fileID).Scan(&storageKey, &shopID, &status, &keyID, &wrappedKey)
+
+	if err != nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+
+	if shopID != claims.UserID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	// Downloading a queued job starts printing it
+	switch status {
+	case string(jobs.Queued):
+		if err := transitionFile(fileID, claims.UserID, "downloaded by shop", jobs.Printing); err != nil {
+			writeTransitionError(w, err)
+			return
+		}
+	case string(jobs.Printing):
+	default:
+		http.Error(w, "File is no longer available", http.StatusGone)
+		return
+	}
+
+	// Serve the file
+	serveStored(w, r, storageKey, fileEnvelope(keyID, wrappedKey))
+
+	// NOTE: File is no longer auto-deleted here.
+	// Shopkeeper must confirm print completion via /queue/:fileId/confirm endpoint
+}
+
+func GetMyFiles(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := context.Background()
+	rows, err := database.DB.Query(ctx,
+		`SELECT f.id, f.shop_id, f.unique_code, f.print_type, f.status, f.copies, f.print_mode, 
+		 f.color_mode, f.paper_size, f.num_pages, f.total_cost, q.queue_position, 
+		 f.created_at, f.payment_method, f.paid_at, u.username as shop_name, u.lat as shop_lat, u.long as shop_long
+		 FROM files f
+		 LEFT JOIN users u ON f.shop_id = u.id
+		 LEFT JOIN queue_positions q ON q.file_id = f.id
+		 WHERE f.user_id = $1
+		 ORDER BY f.created_at DESC`, claims.UserID)
+
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var files []map[string]interface{}
+	var queuedShops []int
+	for rows.Next() {
+		var id int
+		var shopID *int
+		var uniqueCode, printType, status, printMode, colorMode, paperSize string
+		var copies, numPages int
+		var totalCost money.Paise
+		var queuePosition *int
+		var createdAt time.Time
+		var paymentMethod string
+		var paidAt *time.Time
+		var shopName *string
+		var shopLat, shopLong *float64
+
+		if err := rows.Scan(&id, &shopID, &uniqueCode, &printType, &status, &copies, &printMode,
+			&colorMode, &paperSize, &numPages, &totalCost, &queuePosition, &createdAt,
+			&paymentMethod, &paidAt, &shopName, &shopLat, &shopLong); err != nil {
+			continue
+		}
+
+		fileData := map[string]interface{}{
+			"id":         id,
+			"code":       uniqueCode,
+			"print_type": printType,
+			"status":     status,
+			"copies":     copies,
+			"print_mode": printMode,
+			"color_mode": colorMode,
+			"paper_size": paperSize,
+			"num_pages":  numPages,
+			"total_cost": totalCost,
+			"created_at": createdAt,
+
+			"payment_method": paymentMethod,
+		}
+
+		if paidAt != nil {
+			fileData["paid_at"] = *paidAt
+		}
+
+		if queuePosition != nil {
+			fileData["queue_position"] = *queuePosition
+			if !slices.Contains(queuedShops, *shopID) {
+				queuedShops = append(queuedShops, *shopID)
+			}
+		}
+		if shopName != nil {
+			fileData["shop_name"] = *shopName
+		}
+		if shopLat != nil {
+			fileData["shop_lat"] = *shopLat
+		}
+		if shopLong != nil {
+			fileData["shop_long"] = *shopLong
+		}
+
+		files = append(files, fileData)
+	}
+	rows.Close()
+
+	etas, err := jobs.LoadETAs(ctx, database.DB, queuedShops)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	for _, fileData := range files {
+		if eta, ok := etas[fileData["id"].(int)]; ok {
+			fileData["estimated_start"] = eta.Start
+			fileData["estimated_completion"] = eta.Completion
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"files": files})
+}
+
+// ConfirmPrivatePrint marks a private print job as printed and handed over
+// to the customer, and deletes the file. Only the shop that downloaded the
+// job can confirm it.
+func ConfirmPrivatePrint(w http.ResponseWriter, r *http.Request) {
+	code := chi.URLParam(r, "code")
+
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var fileID int
+	var shopID *int
+	var storageKey, printType string
+	err = tx.QueryRow(ctx,
+		"SELECT id, shop_id, storage_key, print_type FROM files WHERE unique_code = $1 FOR UPDATE",
+		code).Scan(&fileID, &shopID, &storageKey, &printType)
+	if err != nil || printType != "private" {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	if shopID == nil {
+		http.Error(w, "Download the file before confirming it", http.StatusConflict)
+		return
+	}
+	if *shopID != claims.UserID {
+		http.Error(w, "File was downloaded by another shop", http.StatusForbidden)
+		return
+	}
+
+	// The customer is at the counter, so the job is collected as soon as it is printed
+	if _, err := jobs.Advance(ctx, tx, fileID, claims.UserID, "confirmed by shop", jobs.Collected); err != nil {
+		writeTransitionError(w, err)
+		return
+	}
+
+	// The shop that printed the job is paid for wallet jobs, and the job is invoiced
+	_, err = wallet.Settle(ctx, tx, fileID, claims.UserID, claims.UserID)
+	if err == nil {
+		_, err = issueJobInvoice(ctx, tx, fileID)
+	}
+	if err == nil {
+		err = events.Notify(ctx, tx, events.JobUpdated, fileID)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Delete the file from storage
+	storage.Files.Delete(ctx, storageKey)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Print confirmed"})
+}
+
+// ConfirmQueuePrint marks a queue print job as printed, removes it from the
+// shop queue and deletes the file
+func ConfirmQueuePrint(w http.ResponseWriter, r *http.Request) {
+	fileIDStr := chi.URLParam(r, "fileId")
+	fileID, err := strconv.Atoi(fileIDStr)
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Get file info and verify it belongs to this shop
+	var storageKey string
+	var shopID int
+	err = database.DB.QueryRow(context.Background(),
+		"SELECT storage_key, shop_id FROM files WHERE id = $1 AND print_type = 'queue'", fileID).Scan(&storageKey, &shopID)
+
+	if err != nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+
+	if shopID != claims.UserID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := jobs.Advance(ctx, tx, fileID, claims.UserID, "confirmed by shop", jobs.Printed); err != nil {
+		writeTransitionError(w, err)
+		return
+	}
+
+	// Leaving the queue statuses removes the job from queue_positions, so the
+	// jobs behind it move up without being rewritten
+	_, err = wallet.Settle(ctx, tx, fileID, claims.UserID, claims.UserID)
+	if err == nil {
+		_, err = issueJobInvoice(ctx, tx, fileID)
+	}
+	if err == nil {
+		err = events.Notify(ctx, tx, events.JobUpdated, fileID)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Delete the file from storage
+	storage.Files.Delete(ctx, storageKey)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Print confirmed"})
+}
+
+func GetShopHistory(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Fetch all files printed by this shop (status printed or collected)
+	rows, err := database.DB.Query(context.Background(),
+		`SELECT id, unique_code, print_type, status, copies, num_pages, total_cost, created_at, payment_method, paid_at
+		 FROM files 
+		 WHERE shop_id = $1 AND status = ANY($2) 
+		 ORDER BY created_at DESC`, claims.UserID, jobs.DoneStatuses())
+
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var history []map[string]interface{}
+	for rows.Next() {
+		var id, copies, numPages int
+		var uniqueCode, printType, status string
+		var totalCost money.Paise
+		var createdAt time.Time
+		var paymentMethod string
+		var paidAt *time.Time
+
+		if err := rows.Scan(&id, &uniqueCode, &printType, &status, &copies, &numPages, &totalCost, &createdAt,
+			&paymentMethod, &paidAt); err != nil {
+			continue
+		}
+
+		history = append(history, map[string]interface{}{
+			"id":     id,
+			"code":   uniqueCode,
+			"type":   printType,
+			"status": status,
+			"copies": copies,
+			"pages":  numPages,
+			"cost":   totalCost,
+			"date":   createdAt,
+
+			"payment_method": paymentMethod,
+			"paid_at":        paidAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"history": history})
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"backend/internal/auth"
+	"backend/internal/database"
+	"backend/internal/database/dbtest"
+	"backend/internal/encryption"
+	"backend/internal/jobs"
+	"backend/internal/money"
+	"backend/internal/storage"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+// setup gives a test a migrated database, document storage in a temporary
+// directory and an encryption keyring. It skips the test without a database.
+func setup(t *testing.T) {
+	t.Helper()
+	dbtest.Setup(t)
+
+	keys, err := encryption.ParseKeyring("test:" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previousKeys, previousFiles := encryption.Keys, storage.Files
+	encryption.Keys, storage.Files = keys, &storage.Local{Dir: t.TempDir()}
+	t.Cleanup(func() {
+		encryption.Keys, storage.Files = previousKeys, previousFiles
+	})
+}
+
+// testPDF returns a PDF document with the given number of pages
+func testPDF(t testing.TB, pages int) []byte {
+	t.Helper()
+	var content []string
+	for i := 1; i <= pages; i++ {
+		content = append(content, fmt.Sprintf(
+			`"%d":{"content":{"text":[{"value":"Page %d","pos":[50,50],"font":{"name":"Helvetica","size":12}}]}}`, i, i))
+	}
+	var buf bytes.Buffer
+	desc := `{"paper":"A4P","pages":{` + strings.Join(content, ",") + `}}`
+	if err := api.Create(nil, strings.NewReader(desc), &buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// as returns r as sent by an authenticated user
+func as(r *http.Request, userID int, role string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), auth.UserKey, &auth.Claims{UserID: userID, Role: role}))
+}
+
+// jobState returns a job's status and whether it has been paid
+func jobState(t *testing.T, fileID int) (jobs.Status, bool) {
+	t.Helper()
+	var status jobs.Status
+	var paid bool
+	err := database.DB.QueryRow(context.Background(),
+		"SELECT status, paid_at IS NOT NULL FROM files WHERE id = $1", fileID).Scan(&status, &paid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status, paid
+}
+
+// balance returns a user's wallet balance
+func balance(t *testing.T, userID int) money.Paise {
+	t.Helper()
+	var b money.Paise
+	err := database.DB.QueryRow(context.Background(),
+		"SELECT COALESCE((SELECT balance FROM wallet_accounts WHERE user_id = $1), 0)", userID).Scan(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
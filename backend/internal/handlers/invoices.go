@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/database"
+	"backend/internal/invoice"
+	"backend/internal/jobs"
+	"backend/internal/models"
+	"backend/internal/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// loadInvoice returns the invoice issued for a job
+func loadInvoice(ctx context.Context, tx pgx.Tx, fileID int) (*models.Invoice, error) {
+	var inv models.Invoice
+	var number int64
+	err := tx.QueryRow(ctx,
+		`SELECT shop_id, number, file_id, issued_at, seller_name, COALESCE(seller_address, ''),
+		 COALESCE(seller_gstin, ''), buyer_name, COALESCE(buyer_gstin, ''), gst_rate, lines, taxable_value,
+		 cgst, sgst, total
+		 FROM invoices WHERE file_id = $1`, fileID).Scan(&inv.ShopID, &number, &inv.FileID, &inv.IssuedAt,
+		&inv.SellerName, &inv.SellerAddress, &inv.SellerGSTIN, &inv.BuyerName, &inv.BuyerGSTIN, &inv.GSTRate,
+		&inv.Lines, &inv.TaxableValue, &inv.CGST, &inv.SGST, &inv.Total)
+	if err != nil {
+		return nil, err
+	}
+	inv.Number = invoice.FormatNumber(number)
+	return &inv, nil
+}
+
+// issueInvoice takes the shop's next invoice number and stores the invoice
+// for a job, itemised from the price card that priced it. Shops without a
+// GSTIN charge no GST. The buyer is named as in the customer's billing
+// details, or by username if they have none.
+func issueInvoice(ctx context.Context, tx pgx.Tx, fileID, userID, shopID int, job invoice.Job, cardVersion *int) (*models.Invoice, error) {
+	card, err := loadPriceCardVersion(shopID, cardVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	inv := models.Invoice{ShopID: shopID, FileID: fileID}
+	err = tx.QueryRow(ctx,
+		`SELECT COALESCE(s.display_name, s.business_name), COALESCE(u.address, ''), COALESCE(s.gstin, '')
+		 FROM users u JOIN shops s ON s.user_id = u.id WHERE u.id = $1`, shopID).Scan(
+		&inv.SellerName, &inv.SellerAddress, &inv.SellerGSTIN)
+	if err == nil {
+		err = tx.QueryRow(ctx,
+			"SELECT COALESCE(billing_name, username), COALESCE(gstin, '') FROM users WHERE id = $1",
+			userID).Scan(&inv.BuyerName, &inv.BuyerGSTIN)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if inv.SellerGSTIN != "" {
+		inv.GSTRate = card.GSTRate
+	}
+	inv.Lines = invoice.Lines(card, job)
+	invoice.ApplyTax(&inv)
+
+	number, err := invoice.NextNumber(ctx, tx, shopID)
+	if err != nil {
+		return nil, err
+	}
+	inv.Number = invoice.FormatNumber(number)
+
+	var sellerAddress, sellerGSTIN, buyerGSTIN *string
+	if inv.SellerAddress != "" {
+		sellerAddress = &inv.SellerAddress
+	}
+	if inv.SellerGSTIN != "" {
+		sellerGSTIN = &inv.SellerGSTIN
+	}
+	if inv.BuyerGSTIN != "" {
+		buyerGSTIN = &inv.BuyerGSTIN
+	}
+	err = tx.QueryRow(ctx,
+		`INSERT INTO invoices (shop_id, number, file_id, seller_name, seller_address, seller_gstin,
+		 buyer_name, buyer_gstin, gst_rate, lines, taxable_value, cgst, sgst, total)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) RETURNING issued_at`,
+		shopID, number, fileID, inv.SellerName, sellerAddress, sellerGSTIN, inv.BuyerName, buyerGSTIN,
+		inv.GSTRate, inv.Lines, inv.TaxableValue, inv.CGST, inv.SGST, inv.Total).Scan(&inv.IssuedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// issueJobInvoice issues the invoice for a job that the shop has just
+// confirmed printed, in the same transaction, so invoices are numbered and
+// dated in the order the shop supplied the jobs. A job that already has an
+// invoice keeps it. The caller must hold the job's row lock.
+func issueJobInvoice(ctx context.Context, tx pgx.Tx, fileID int) (*models.Invoice, error) {
+	inv, err := loadInvoice(ctx, tx, fileID)
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return inv, err
+	}
+
+	var userID int
+	var shopID, cardVersion *int
+	var job invoice.Job
+	err = tx.QueryRow(ctx,
+		`SELECT user_id, shop_id, num_pages, copies, paper_size, color_mode, print_mode,
+		 total_cost, price_card_version
+		 FROM files WHERE id = $1`, fileID).Scan(&userID, &shopID,
+		&job.Pages, &job.Copies, &job.PaperSize, &job.ColorMode, &job.PrintMode, &job.TotalCost, &cardVersion)
+	if err != nil {
+		return nil, err
+	}
+	if shopID == nil {
+		return nil, errors.New("job has no shop to invoice it")
+	}
+	return issueInvoice(ctx, tx, fileID, userID, *shopID, job, cardVersion)
+}
+
+// GetInvoice returns the invoice for a printed or collected job as a PDF.
+// The invoice was issued when the shop confirmed the job printed and never
+// changes. Jobs printed before that was the case are issued their invoice on
+// first download. Only the job's customer and its shop may download it.
+func GetInvoice(w http.ResponseWriter, r *http.Request) {
+	fileID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// The row lock makes concurrent first downloads wait for the one issuing the invoice
+	var userID int
+	var shopID *int
+	var status string
+	err = tx.QueryRow(ctx, "SELECT user_id, shop_id, status FROM files WHERE id = $1 FOR UPDATE",
+		fileID).Scan(&userID, &shopID, &status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if userID != claims.UserID && (shopID == nil || *shopID != claims.UserID) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if shopID == nil || (status != string(jobs.Printed) && status != string(jobs.Collected)) {
+		http.Error(w, "Invoices are issued once a job is printed", http.StatusConflict)
+		return
+	}
+
+	inv, err := issueJobInvoice(ctx, tx, fileID)
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	pdf, err := invoice.Render(inv)
+	if err != nil {
+		http.Error(w, "Could not render invoice", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `attachment; filename="invoice-`+inv.Number+`.pdf"`)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(pdf)
+}
+
+// GetBillingDetails returns the name and GSTIN printed on the caller's invoices
+func GetBillingDetails(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var details models.BillingDetails
+	err := database.DB.QueryRow(context.Background(),
+		"SELECT COALESCE(billing_name, ''), COALESCE(gstin, '') FROM users WHERE id = $1",
+		claims.UserID).Scan(&details.Name, &details.GSTIN)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(details)
+}
+
+// UpdateBillingDetails sets the name and GSTIN printed on the caller's
+// invoices. Empty fields are cleared. Invoices already issued keep the
+// details they were issued with.
+func UpdateBillingDetails(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.BillingDetails
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := utils.ValidateBillingDetails(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var name, gstin *string
+	if req.Name != "" {
+		name = &req.Name
+	}
+	if req.GSTIN != "" {
+		gstin = &req.GSTIN
+	}
+	_, err := database.DB.Exec(context.Background(),
+		"UPDATE users SET billing_name = $2, gstin = $3 WHERE id = $1", claims.UserID, name, gstin)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(req)
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"backend/internal/database"
+	"backend/internal/database/dbtest"
+)
+
+// TestInvoiceIssuedWhenPrinted checks that jobs are invoiced in the order
+// the shop confirms them, not the order the invoices are downloaded, and
+// that the customer's billing details are printed on them
+func TestInvoiceIssuedWhenPrinted(t *testing.T) {
+	setup(t)
+	customer := dbtest.CreateUser(t, "customer")
+	shop := dbtest.CreateShop(t, 12.97, 77.59)
+
+	billing := func(body string) int {
+		w := httptest.NewRecorder()
+		UpdateBillingDetails(w, as(httptest.NewRequest(http.MethodPut, "/billing", strings.NewReader(body)), customer, "customer"))
+		return w.Code
+	}
+	if code := billing(`{"name": "Acme Traders", "gstin": "27AAPFU0939F1ZX"}`); code != http.StatusBadRequest {
+		t.Errorf("GSTIN with a wrong check character: %d, want 400", code)
+	}
+	if code := billing(`{"name": " Acme Traders ", "gstin": "27aapfu0939f1zv"}`); code != http.StatusOK {
+		t.Fatalf("billing details: %d", code)
+	}
+
+	first := queueJob(t, customer, shop, payCash, false)
+	second := queueJob(t, customer, shop, payCash, false)
+	for _, fileID := range []int{second, first} {
+		w := httptest.NewRecorder()
+		ConfirmQueuePrint(w, as(withID(httptest.NewRequest(http.MethodPost, "/", nil), "fileId", fileID), shop, "shopkeeper"))
+		if w.Code != http.StatusOK {
+			t.Fatalf("confirm %d: %d %s", fileID, w.Code, w.Body)
+		}
+	}
+
+	invoice := func(fileID int) (number int64, buyer, gstin string) {
+		t.Helper()
+		err := database.DB.QueryRow(context.Background(),
+			"SELECT number, buyer_name, COALESCE(buyer_gstin, '') FROM invoices WHERE file_id = $1", fileID).
+			Scan(&number, &buyer, &gstin)
+		if err != nil {
+			t.Fatalf("invoice for %d: %v", fileID, err)
+		}
+		return number, buyer, gstin
+	}
+	if n, _, _ := invoice(second); n != 1 {
+		t.Errorf("job confirmed first has invoice %d", n)
+	}
+	n, buyer, gstin := invoice(first)
+	if n != 2 || buyer != "Acme Traders" || gstin != "27AAPFU0939F1ZV" {
+		t.Errorf("invoice %d to %q, GSTIN %q", n, buyer, gstin)
+	}
+
+	// Downloading serves the invoice already issued
+	w := httptest.NewRecorder()
+	GetInvoice(w, as(withID(httptest.NewRequest(http.MethodGet, "/", nil), "id", first), customer, "customer"))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Disposition") != `attachment; filename="invoice-INV-000002.pdf"` {
+		t.Errorf("download: %d %s", w.Code, w.Header().Get("Content-Disposition"))
+	}
+	if n := countRows(t, "SELECT COUNT(*) FROM invoices WHERE shop_id = $1", shop); n != 2 {
+		t.Errorf("%d invoices", n)
+	}
+}
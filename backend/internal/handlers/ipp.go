@@ -0,0 +1,558 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/database"
+	"backend/internal/ipp"
+	"backend/internal/models"
+	"backend/internal/utils"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+var serverStarted = time.Now()
+
+// ippPrinter is the printer a request was sent to: the private print printer
+// or the queue of one shop
+type ippPrinter struct {
+	uri    string
+	name   string
+	shopID *int
+	caps   models.ShopCapabilities // what the printer advertises to clients
+}
+
+// ippJobStates maps job statuses to IPP job-state values
+var ippJobStates = map[string]int{
+	"pending_payment": ipp.JobPendingHeld,
+	"uploaded":        ipp.JobPending,
+	"queued":          ipp.JobPending,
+	"printing":        ipp.JobProcessing,
+	"printed":         ipp.JobCompleted,
+	"collected":       ipp.JobCompleted,
+	"cancelled":       ipp.JobCanceled,
+	"expired":         ipp.JobAborted,
+	"failed":          ipp.JobAborted,
+}
+
+// IPPPrivatePrinter accepts IPP requests for private print jobs, redeemable by code
+func IPPPrivatePrinter(w http.ResponseWriter, r *http.Request) {
+	// Private jobs can be redeemed at any shop, so every option is offered
+	caps := models.ShopCapabilities{Color: true, Duplex: true, PaperSizes: utils.PaperSizes}
+	serveIPP(w, r, ippPrinter{uri: ippURI(r), name: "Qprint Private Print", caps: caps})
+}
+
+// IPPShopPrinter accepts IPP requests that queue jobs at one shop
+func IPPShopPrinter(w http.ResponseWriter, r *http.Request) {
+	shopID, err := strconv.Atoi(chi.URLParam(r, "shopId"))
+	if err != nil {
+		http.Error(w, "Invalid shop ID", http.StatusNotFound)
+		return
+	}
+
+	var name string
+	var caps models.ShopCapabilities
+	err = database.DB.QueryRow(context.Background(),
+		`SELECT COALESCE(s.display_name, s.business_name), s.color, s.duplex, s.paper_sizes
+		 FROM users JOIN shops s ON s.user_id = users.id WHERE users.id = $1 AND `+listedShop,
+		shopID).Scan(&name, &caps.Color, &caps.Duplex, &caps.PaperSizes)
+	if err != nil {
+		http.Error(w, "Shop not found", http.StatusNotFound)
+		return
+	}
+
+	serveIPP(w, r, ippPrinter{uri: ippURI(r), name: "Qprint " + name, shopID: &shopID, caps: caps})
+}
+
+// ippURI returns the ipp:// URI clients used to reach this printer
+func ippURI(r *http.Request) string {
+	scheme := "ipp"
+	if r.TLS != nil {
+		scheme = "ipps"
+	}
+	return scheme + "://" + r.Host + r.URL.Path
+}
+
+var (
+	errIPPUnauthorized = errors.New("unauthorized")
+	errIPPThrottled    = errors.New("too many failed logins")
+)
+
+// ippUser authenticates an IPP request with HTTP Basic credentials or a bearer token
+func ippUser(r *http.Request) (*auth.Claims, error) {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		claims, err := auth.Authenticate(strings.TrimPrefix(header, "Bearer "))
+		if err != nil {
+			return nil, errIPPUnauthorized
+		}
+		return claims, nil
+	}
+
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, errIPPUnauthorized
+	}
+
+	var userID int
+	var hash, role string
+	err := database.DB.QueryRow(context.Background(),
+		"SELECT id, password_hash, role FROM users WHERE username = $1 AND suspended_at IS NULL AND deleted_at IS NULL",
+		username).Scan(&userID, &hash, &role)
+	if err != nil {
+		return nil, errIPPUnauthorized
+	}
+	if err := ippLogins.check(username, remoteIP(r), password, hash, time.Now()); err != nil {
+		return nil, err
+	}
+	return &auth.Claims{UserID: userID, Role: role}, nil
+}
+
+const (
+	// ippVerifiedTTL is how long a checked password is accepted without
+	// running bcrypt again
+	ippVerifiedTTL = 5 * time.Minute
+	// At most ippMaxAttempts passwords of one user from one address are
+	// checked per ippAttemptWindow; more answer 429 until the window ends
+	ippMaxAttempts   = 5
+	ippAttemptWindow = time.Minute
+	// ippSweepAt is the number of entries at which expired ones are dropped
+	ippSweepAt = 1024
+)
+
+// ippCredentials remembers Basic credentials that were checked recently.
+// IPP clients send the password with every request and bcrypt is slow on
+// purpose, so without it every job and status poll would cost a hash.
+// Entries are keyed by the stored hash too, so changing the password ends
+// them, and the user is still looked up on every request, so suspending
+// or deleting the account takes effect at once.
+type ippCredentials struct {
+	mu       sync.Mutex
+	verified map[[32]byte]time.Time // credential key → expiry
+	attempts map[ippSource]ippAttempts
+}
+
+// ippSource is who failed attempts are counted against. Counting by address
+// too means guesses from elsewhere cannot lock a user out of their printer.
+type ippSource struct {
+	username, ip string
+}
+
+type ippAttempts struct {
+	count int
+	since time.Time
+}
+
+var ippLogins = &ippCredentials{verified: map[[32]byte]time.Time{}, attempts: map[ippSource]ippAttempts{}}
+
+func credentialKey(username, password, hash string) [32]byte {
+	return sha256.Sum256([]byte(username + "\x00" + hash + "\x00" + password))
+}
+
+// check verifies password against hash, from the cache if it was verified
+// recently. A password that still needs bcrypt counts as an attempt; a
+// correct one clears the attempts from that address.
+func (c *ippCredentials) check(username, ip, password, hash string, now time.Time) error {
+	key := credentialKey(username, password, hash)
+	source := ippSource{username, ip}
+
+	c.mu.Lock()
+	if expiry, ok := c.verified[key]; ok && now.Before(expiry) {
+		c.mu.Unlock()
+		return nil
+	}
+	attempts := c.attempts[source]
+	if now.Sub(attempts.since) >= ippAttemptWindow {
+		attempts = ippAttempts{since: now}
+	}
+	if attempts.count >= ippMaxAttempts {
+		c.mu.Unlock()
+		return errIPPThrottled
+	}
+	attempts.count++
+	c.attempts[source] = attempts
+	c.mu.Unlock()
+
+	if !auth.CheckPasswordHash(password, hash) {
+		return errIPPUnauthorized
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.attempts, source)
+	if len(c.verified) >= ippSweepAt || len(c.attempts) >= ippSweepAt {
+		c.sweep(now)
+	}
+	c.verified[key] = now.Add(ippVerifiedTTL)
+	return nil
+}
+
+// sweep drops expired entries. The caller holds c.mu.
+func (c *ippCredentials) sweep(now time.Time) {
+	for key, expiry := range c.verified {
+		if !now.Before(expiry) {
+			delete(c.verified, key)
+		}
+	}
+	for source, attempts := range c.attempts {
+		if now.Sub(attempts.since) >= ippAttemptWindow {
+			delete(c.attempts, source)
+		}
+	}
+}
+
+// remoteIP returns the address the request came from, without the port
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func serveIPP(w http.ResponseWriter, r *http.Request, printer ippPrinter) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/ipp") {
+		http.Error(w, "Expected application/ipp", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	req, err := ipp.Decode(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var resp *ipp.Message
+	switch {
+	case req.Major != 1 && req.Major != 2:
+		resp = ipp.NewResponse(req, ipp.StatusVersionNotSupported)
+	case req.Code == ipp.OpGetPrinterAttributes:
+		resp = ippPrinterAttributes(req, printer)
+	case req.Code == ipp.OpPrintJob, req.Code == ipp.OpValidateJob, req.Code == ipp.OpGetJobAttributes,
+		req.Code == ipp.OpGetJobs:
+		claims, err := ippUser(r)
+		if errors.Is(err, errIPPThrottled) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(ippAttemptWindow.Seconds())))
+			http.Error(w, "Too many failed logins", http.StatusTooManyRequests)
+			return
+		}
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Qprint"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		// Only customers submit jobs, as for POST /upload
+		if claims.Role != auth.RoleCustomer {
+			resp = ipp.NewResponse(req, ipp.StatusForbidden)
+			break
+		}
+
+		switch req.Code {
+		case ipp.OpPrintJob:
+			resp = ippPrintJob(req, r.Body, printer, claims)
+		case ipp.OpValidateJob:
+			resp = ippValidateJob(req)
+		case ipp.OpGetJobs:
+			resp = ippGetJobs(req, printer, claims)
+		default:
+			resp = ippJobAttributes(req, printer, claims)
+		}
+	default:
+		resp = ipp.NewResponse(req, ipp.StatusOperationNotSupported)
+	}
+
+	w.Header().Set("Content-Type", "application/ipp")
+	resp.Encode(w)
+}
+
+// ippStringAttr reads a job template attribute, which clients may send in
+// either the job or the operation group
+func ippStringAttr(req *ipp.Message, name string) string {
+	if v := req.String(ipp.TagJob, name); v != "" {
+		return v
+	}
+	return req.String(ipp.TagOperation, name)
+}
+
+// ippSettings converts IPP job template attributes into print settings. A
+// copies value outside copies-supported is refused rather than clamped.
+func ippSettings(req *ipp.Message) (printSettings, error) {
+	settings := printSettings{Copies: 1, PrintMode: "single", ColorMode: "bw", PaperSize: "A4"}
+
+	if copies, ok := req.Int(ipp.TagJob, "copies"); ok {
+		if copies < 1 || copies > maxCopies {
+			return settings, errCopiesOutOfRange
+		}
+		settings.Copies = copies
+	}
+	if strings.HasPrefix(ippStringAttr(req, "sides"), "two-sided") {
+		settings.PrintMode = "double"
+	}
+	// auto leaves the choice to the printer, whose default is monochrome
+	if ippStringAttr(req, "print-color-mode") == "color" {
+		settings.ColorMode = "color"
+	}
+	if media := ippStringAttr(req, "media"); media != "" {
+		settings.PaperSize = ipp.PaperSize(media)
+	}
+	return settings, nil
+}
+
+// ippUnsupportedCopies answers a request whose copies attribute is out of range
+func ippUnsupportedCopies(req *ipp.Message) *ipp.Message {
+	copies, _ := req.Int(ipp.TagJob, "copies")
+	resp := ipp.NewResponse(req, ipp.StatusAttributesNotSupported)
+	resp.Add(ipp.TagOperation, ipp.Text("status-message", errCopiesOutOfRange.Error()))
+	resp.Add(ipp.TagUnsupported, ipp.Integer("copies", copies))
+	return resp
+}
+
+func ippDocumentFormatOK(req *ipp.Message) bool {
+	format := req.String(ipp.TagOperation, "document-format")
+	return format == "" || format == "application/pdf" || format == "application/octet-stream"
+}
+
+func ippValidateJob(req *ipp.Message) *ipp.Message {
+	if !ippDocumentFormatOK(req) {
+		return ipp.NewResponse(req, ipp.StatusDocumentFormatUnsupported)
+	}
+	if _, err := ippSettings(req); err != nil {
+		return ippUnsupportedCopies(req)
+	}
+	return ipp.NewResponse(req, ipp.StatusOK)
+}
+
+// ippPrintJob stores the submitted document and creates a job through the
+// same pipeline as POST /upload
+func ippPrintJob(req *ipp.Message, doc io.Reader, printer ippPrinter, claims *auth.Claims) *ipp.Message {
+	if !ippDocumentFormatOK(req) {
+		return ipp.NewResponse(req, ipp.StatusDocumentFormatUnsupported)
+	}
+	settings, err := ippSettings(req)
+	if err != nil {
+		return ippUnsupportedCopies(req)
+	}
+
+	name := req.String(ipp.TagOperation, "job-name")
+	if name == "" {
+		name = "document"
+	}
+	if !strings.HasSuffix(strings.ToLower(name), ".pdf") {
+		name += ".pdf"
+	}
+
+	// Limit file size to 10MB, as for POST /upload
+	data, err := readUpload(doc)
+	if errors.Is(err, errUploadTooLarge) {
+		return ipp.NewResponse(req, ipp.StatusRequestEntityTooLarge)
+	}
+	if err != nil {
+		return ipp.NewResponse(req, ipp.StatusInternalError)
+	}
+
+	printType := "private"
+	if printer.shopID != nil {
+		printType = "queue"
+	}
+
+	job, err := createJob(newJob{
+		UserID:    claims.UserID,
+		Name:      name,
+		Document:  data,
+		PrintType: printType,
+		Settings:  settings,
+		ShopID:    printer.shopID,
+		Note:      "submitted over IPP",
+	})
+	if err != nil {
+		resp := ipp.NewResponse(req, ipp.StatusInternalError)
+		var rejected *jobRejectedError
+		var unreadable *unreadablePDFError
+		switch {
+		case errors.As(err, &rejected):
+			resp = ipp.NewResponse(req, ipp.StatusAttributesNotSupported)
+		case errors.As(err, &unreadable):
+			resp = ipp.NewResponse(req, ipp.StatusDocumentFormatError)
+		}
+		resp.Add(ipp.TagOperation, ipp.Text("status-message", err.Error()))
+		return resp
+	}
+
+	resp := ipp.NewResponse(req, ipp.StatusOK)
+	if job.Code != "" {
+		resp.Add(ipp.TagOperation, ipp.Text("status-message", "Collect your prints with code "+job.Code))
+	}
+	resp.Add(ipp.TagJob,
+		ipp.URI("job-uri", fmt.Sprintf("%s/jobs/%d", printer.uri, job.FileID)),
+		ipp.Integer("job-id", job.FileID),
+		ipp.Enum("job-state", ipp.JobPending),
+		ipp.Keyword("job-state-reasons", "none"))
+	return resp
+}
+
+// ippJobAttributes reports the state of one of the caller's jobs
+func ippJobAttributes(req *ipp.Message, printer ippPrinter, claims *auth.Claims) *ipp.Message {
+	jobID, ok := req.Int(ipp.TagOperation, "job-id")
+	if !ok {
+		return ipp.NewResponse(req, ipp.StatusBadRequest)
+	}
+
+	var status string
+	err := database.DB.QueryRow(context.Background(),
+		"SELECT status FROM files WHERE id = $1 AND user_id = $2", jobID, claims.UserID).Scan(&status)
+	if err != nil {
+		return ipp.NewResponse(req, ipp.StatusNotFound)
+	}
+
+	resp := ipp.NewResponse(req, ipp.StatusOK)
+	resp.Add(ipp.TagJob, ippJob(printer, jobID, status)...)
+	return resp
+}
+
+// ippJob describes a job in a job attributes group
+func ippJob(printer ippPrinter, jobID int, status string) []ipp.Attribute {
+	state := ippJobStates[status]
+	reason := "none"
+	switch state {
+	case ipp.JobPendingHeld:
+		reason = "job-hold-until-specified"
+	case ipp.JobCompleted:
+		reason = "job-completed-successfully"
+	case ipp.JobCanceled:
+		reason = "job-canceled-by-user"
+	case ipp.JobAborted:
+		reason = "aborted-by-system"
+	}
+	return []ipp.Attribute{
+		ipp.URI("job-uri", fmt.Sprintf("%s/jobs/%d", printer.uri, jobID)),
+		ipp.Integer("job-id", jobID),
+		ipp.Enum("job-state", state),
+		ipp.Keyword("job-state-reasons", reason),
+	}
+}
+
+// ippMaxJobs is the most jobs Get-Jobs returns
+const ippMaxJobs = 100
+
+// ippGetJobs lists the caller's jobs at this printer, newest first: the
+// private jobs for the private print printer, the jobs at the shop for a
+// shop printer. which-jobs selects "not-completed" (the default) or
+// "completed" jobs.
+func ippGetJobs(req *ipp.Message, printer ippPrinter, claims *auth.Claims) *ipp.Message {
+	which := req.String(ipp.TagOperation, "which-jobs")
+	if which == "" {
+		which = "not-completed"
+	}
+	if which != "not-completed" && which != "completed" {
+		resp := ipp.NewResponse(req, ipp.StatusAttributesNotSupported)
+		resp.Add(ipp.TagUnsupported, ipp.Keyword("which-jobs", which))
+		return resp
+	}
+	var statuses []string
+	for status, state := range ippJobStates {
+		finished := state == ipp.JobCompleted || state == ipp.JobCanceled || state == ipp.JobAborted
+		if finished == (which == "completed") {
+			statuses = append(statuses, status)
+		}
+	}
+	limit, ok := req.Int(ipp.TagOperation, "limit")
+	if !ok || limit <= 0 || limit > ippMaxJobs {
+		limit = ippMaxJobs
+	}
+
+	rows, err := database.DB.Query(context.Background(),
+		`SELECT id, status FROM files
+		 WHERE user_id = $1 AND status = ANY($2)
+		   AND (shop_id = $3 OR ($3::INT IS NULL AND print_type = 'private'))
+		 ORDER BY id DESC LIMIT $4`, claims.UserID, statuses, printer.shopID, limit)
+	if err != nil {
+		return ipp.NewResponse(req, ipp.StatusInternalError)
+	}
+	defer rows.Close()
+
+	resp := ipp.NewResponse(req, ipp.StatusOK)
+	for rows.Next() {
+		var id int
+		var status string
+		if err := rows.Scan(&id, &status); err != nil {
+			return ipp.NewResponse(req, ipp.StatusInternalError)
+		}
+		// Every job is a group of its own
+		resp.Groups = append(resp.Groups, ipp.Group{Tag: ipp.TagJob, Attributes: ippJob(printer, id, status)})
+	}
+	if rows.Err() != nil {
+		return ipp.NewResponse(req, ipp.StatusInternalError)
+	}
+	return resp
+}
+
+func ippPrinterAttributes(req *ipp.Message, printer ippPrinter) *ipp.Message {
+	var queued int
+	if printer.shopID != nil {
+		database.DB.QueryRow(context.Background(),
+			"SELECT COUNT(*) FROM queue_positions WHERE shop_id = $1", *printer.shopID).Scan(&queued)
+	}
+
+	sides := []string{"one-sided"}
+	if printer.caps.Duplex {
+		sides = append(sides, "two-sided-long-edge", "two-sided-short-edge")
+	}
+	colorModes := []string{"monochrome"}
+	if printer.caps.Color {
+		colorModes = append(colorModes, "color")
+	}
+	var media []string
+	for _, size := range printer.caps.PaperSizes {
+		media = append(media, ipp.MediaName(size))
+	}
+	// media-default needs a value even for a shop that lists no paper sizes.
+	// Its jobs are still refused when they are submitted.
+	if len(media) == 0 {
+		media = []string{ipp.MediaName("A4")}
+	}
+
+	resp := ipp.NewResponse(req, ipp.StatusOK)
+	resp.Add(ipp.TagPrinter,
+		ipp.URI("printer-uri-supported", printer.uri),
+		ipp.Keyword("uri-security-supported", "none"),
+		ipp.Keyword("uri-authentication-supported", "basic"),
+		ipp.Name("printer-name", printer.name),
+		ipp.Text("printer-info", printer.name),
+		ipp.Text("printer-make-and-model", "Qprint Virtual Printer"),
+		ipp.Enum("printer-state", 3), // idle
+		ipp.Keyword("printer-state-reasons", "none"),
+		ipp.Boolean("printer-is-accepting-jobs", true),
+		ipp.Integer("queued-job-count", queued),
+		ipp.Keyword("ipp-versions-supported", "1.1", "2.0"),
+		ipp.Enum("operations-supported",
+			int(ipp.OpPrintJob), int(ipp.OpValidateJob), int(ipp.OpGetJobAttributes), int(ipp.OpGetJobs),
+			int(ipp.OpGetPrinterAttributes)),
+		ipp.Charset("charset-configured", "utf-8"),
+		ipp.Charset("charset-supported", "utf-8"),
+		ipp.Language("natural-language-configured", "en"),
+		ipp.Language("generated-natural-language-supported", "en"),
+		ipp.MimeType("document-format-default", "application/pdf"),
+		ipp.MimeType("document-format-supported", "application/pdf", "application/octet-stream"),
+		ipp.Keyword("compression-supported", "none"),
+		ipp.Keyword("pdl-override-supported", "not-attempted"),
+		ipp.Integer("printer-up-time", int(time.Since(serverStarted).Seconds())+1),
+		ipp.Integer("copies-default", 1),
+		ipp.Range("copies-supported", 1, 999),
+		ipp.Keyword("sides-default", "one-sided"),
+		ipp.Keyword("sides-supported", sides...),
+		ipp.Keyword("media-default", media[0]),
+		ipp.Keyword("media-supported", media...),
+		ipp.Keyword("print-color-mode-default", "monochrome"),
+		ipp.Keyword("print-color-mode-supported", colorModes...),
+		ipp.Boolean("color-supported", printer.caps.Color))
+	return resp
+}
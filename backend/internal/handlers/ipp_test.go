@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend/internal/database"
+	"backend/internal/database/dbtest"
+	"backend/internal/ipp"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestIPPCredentials(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &ippCredentials{verified: map[[32]byte]time.Time{}, attempts: map[ippSource]ippAttempts{}}
+	now := time.Now()
+
+	if err := c.check("alice", "192.0.2.1", "secret", string(hash), now); err != nil {
+		t.Fatalf("correct password: %v", err)
+	}
+	if _, ok := c.verified[credentialKey("alice", "secret", string(hash))]; !ok {
+		t.Error("verified password not remembered")
+	}
+
+	// Wrong passwords are checked up to the limit, then refused unchecked
+	for i := range ippMaxAttempts {
+		if err := c.check("alice", "192.0.2.1", "guess", string(hash), now); !errors.Is(err, errIPPUnauthorized) {
+			t.Fatalf("guess %d: %v, want errIPPUnauthorized", i+1, err)
+		}
+	}
+	if err := c.check("alice", "192.0.2.1", "guess", string(hash), now); !errors.Is(err, errIPPThrottled) {
+		t.Errorf("guess over the limit: %v, want errIPPThrottled", err)
+	}
+	if err := c.check("alice", "192.0.2.1", "another", string(hash), now); !errors.Is(err, errIPPThrottled) {
+		t.Errorf("new guess over the limit: %v, want errIPPThrottled", err)
+	}
+	// A client that already logged in keeps working, and other users and addresses are unaffected
+	if err := c.check("alice", "192.0.2.1", "secret", string(hash), now.Add(time.Second)); err != nil {
+		t.Errorf("remembered password while throttled: %v", err)
+	}
+	if err := c.check("bob", "192.0.2.1", "secret", string(hash), now); err != nil {
+		t.Errorf("other user: %v", err)
+	}
+	if err := c.check("alice", "198.51.100.7", "guess", string(hash), now); !errors.Is(err, errIPPUnauthorized) {
+		t.Errorf("guess from another address: %v, want errIPPUnauthorized", err)
+	}
+
+	// After the window, guesses are checked again
+	later := now.Add(ippAttemptWindow)
+	if err := c.check("alice", "192.0.2.1", "guess", string(hash), later); !errors.Is(err, errIPPUnauthorized) {
+		t.Errorf("guess after the window: %v, want errIPPUnauthorized", err)
+	}
+
+	// A changed password no longer matches the remembered one
+	changed, _ := bcrypt.GenerateFromPassword([]byte("changed"), bcrypt.MinCost)
+	if err := c.check("bob", "192.0.2.1", "secret", string(changed), now); !errors.Is(err, errIPPUnauthorized) {
+		t.Errorf("old password after a change: %v, want errIPPUnauthorized", err)
+	}
+
+	// Remembered passwords expire
+	c.sweep(now.Add(ippVerifiedTTL))
+	if len(c.verified) != 0 {
+		t.Errorf("%d remembered passwords after they expired", len(c.verified))
+	}
+}
+
+func TestIPPSettings(t *testing.T) {
+	req := ipp.NewRequest(ipp.OpPrintJob, 1)
+	req.Add(ipp.TagJob, ipp.Integer("copies", 999), ipp.Keyword("sides", "two-sided-long-edge"))
+	settings, err := ippSettings(req)
+	if err != nil || settings.Copies != 999 || settings.PrintMode != "double" {
+		t.Errorf("ippSettings = %+v, %v", settings, err)
+	}
+
+	for mode, want := range map[string]string{"color": "color", "monochrome": "bw", "auto": "bw"} {
+		req := ipp.NewRequest(ipp.OpPrintJob, 1)
+		req.Add(ipp.TagJob, ipp.Keyword("print-color-mode", mode))
+		if settings, _ := ippSettings(req); settings.ColorMode != want {
+			t.Errorf("print-color-mode %s: colour mode %s, want %s", mode, settings.ColorMode, want)
+		}
+	}
+
+	for _, copies := range []int{0, 1000} {
+		req := ipp.NewRequest(ipp.OpPrintJob, 1)
+		req.Add(ipp.TagJob, ipp.Integer("copies", copies))
+		if _, err := ippSettings(req); err == nil {
+			t.Errorf("copies %d accepted", copies)
+		}
+		if resp := ippValidateJob(req); resp.Code != ipp.StatusAttributesNotSupported {
+			t.Errorf("Validate-Job with copies %d: status %#x", copies, resp.Code)
+		}
+	}
+}
+
+func TestIPPPrinterAttributesWithoutPaperSizes(t *testing.T) {
+	req := ipp.NewRequest(ipp.OpGetPrinterAttributes, 1)
+	resp := ippPrinterAttributes(req, ippPrinter{uri: "ipp://localhost/ipp/print", name: "Qprint Test"})
+
+	if got := resp.String(ipp.TagPrinter, "media-default"); got != "iso_a4_210x297mm" {
+		t.Errorf("media-default %q, want iso_a4_210x297mm", got)
+	}
+	if got := resp.Strings(ipp.TagPrinter, "media-supported"); len(got) != 1 || got[0] != "iso_a4_210x297mm" {
+		t.Errorf("media-supported %q", got)
+	}
+}
+
+// ippClient sends IPP requests to the printers as a customer would
+type ippClient struct {
+	url                string
+	username, password string
+}
+
+func (c ippClient) do(t *testing.T, path string, req *ipp.Message, document []byte) (*ipp.Message, int) {
+	t.Helper()
+	var body bytes.Buffer
+	if err := req.Encode(&body); err != nil {
+		t.Fatal(err)
+	}
+	body.Write(document)
+	r, _ := http.NewRequest(http.MethodPost, c.url+path, &body)
+	r.Header.Set("Content-Type", "application/ipp")
+	if c.username != "" {
+		r.SetBasicAuth(c.username, c.password)
+	}
+	httpResp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, httpResp.StatusCode
+	}
+	resp, err := ipp.Decode(httpResp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, httpResp.StatusCode
+}
+
+// jobIDs returns the job-id of every job group in a response
+func jobIDs(resp *ipp.Message) []int {
+	var ids []int
+	for _, g := range resp.Groups {
+		if g.Tag != ipp.TagJob {
+			continue
+		}
+		job := &ipp.Message{Groups: []ipp.Group{g}}
+		id, _ := job.Int(ipp.TagJob, "job-id")
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestIPPPrintJob(t *testing.T) {
+	setup(t)
+	customer := dbtest.CreateUser(t, "customer")
+	shop := dbtest.CreateShop(t, 12.97, 77.59)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	var username string
+	err := database.DB.QueryRow(context.Background(),
+		"UPDATE users SET password_hash = $1 WHERE id = $2 RETURNING username", string(hash), customer).Scan(&username)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := chi.NewRouter()
+	router.Post("/ipp/print", IPPPrivatePrinter)
+	router.Post("/ipp/shops/{shopId}", IPPShopPrinter)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	c := ippClient{url: server.URL, username: username, password: "secret"}
+	shopPath := fmt.Sprintf("/ipp/shops/%d", shop)
+
+	// Jobs need the customer's credentials
+	anonymous := ippClient{url: server.URL}
+	if _, code := anonymous.do(t, shopPath, ipp.NewRequest(ipp.OpGetJobs, 1), nil); code != http.StatusUnauthorized {
+		t.Errorf("anonymous Get-Jobs: %d, want 401", code)
+	}
+
+	printJob := ipp.NewRequest(ipp.OpPrintJob, 2)
+	printJob.Add(ipp.TagOperation, ipp.Name("job-name", "notes"), ipp.MimeType("document-format", "application/pdf"))
+	printJob.Add(ipp.TagJob, ipp.Integer("copies", 2), ipp.Keyword("sides", "two-sided-long-edge"),
+		ipp.Keyword("media", "iso_a3_297x420mm"))
+	resp, _ := c.do(t, shopPath, printJob, testPDF(t, 3))
+	if resp == nil || resp.Code != ipp.StatusOK {
+		t.Fatalf("Print-Job: %+v", resp)
+	}
+	jobID, ok := resp.Int(ipp.TagJob, "job-id")
+	if !ok {
+		t.Fatal("Print-Job returned no job-id")
+	}
+
+	var status, printMode, paperSize string
+	var copies, pages int
+	err = database.DB.QueryRow(context.Background(),
+		`SELECT status, copies, num_pages, print_mode, paper_size
+		 FROM files WHERE id = $1 AND user_id = $2 AND shop_id = $3`, jobID, customer, shop).
+		Scan(&status, &copies, &pages, &printMode, &paperSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != "queued" || copies != 2 || pages != 3 || printMode != "double" || paperSize != "A3" {
+		t.Errorf("job is %s, %d copies of %d pages, %s, %s", status, copies, pages, printMode, paperSize)
+	}
+
+	// The job is listed at the shop printer only, until it finishes
+	getJobs := func(path, which string) []int {
+		t.Helper()
+		req := ipp.NewRequest(ipp.OpGetJobs, 3)
+		if which != "" {
+			req.Add(ipp.TagOperation, ipp.Keyword("which-jobs", which))
+		}
+		resp, code := c.do(t, path, req, nil)
+		if resp == nil || resp.Code != ipp.StatusOK {
+			t.Fatalf("Get-Jobs %s: HTTP %d, %+v", which, code, resp)
+		}
+		return jobIDs(resp)
+	}
+	if ids := getJobs(shopPath, ""); len(ids) != 1 || ids[0] != jobID {
+		t.Errorf("Get-Jobs lists %v, want [%d]", ids, jobID)
+	}
+	if ids := getJobs(shopPath, "completed"); len(ids) != 0 {
+		t.Errorf("completed Get-Jobs lists %v", ids)
+	}
+	if ids := getJobs("/ipp/print", ""); len(ids) != 0 {
+		t.Errorf("private printer lists %v", ids)
+	}
+
+	attrs := ipp.NewRequest(ipp.OpGetJobAttributes, 4)
+	attrs.Add(ipp.TagOperation, ipp.Integer("job-id", jobID))
+	if resp, _ := c.do(t, shopPath, attrs, nil); resp == nil {
+		t.Fatal("Get-Job-Attributes failed")
+	} else if state, _ := resp.Int(ipp.TagJob, "job-state"); state != ipp.JobPending {
+		t.Errorf("job-state %d, want pending", state)
+	}
+
+	if _, err := database.DB.Exec(context.Background(), "UPDATE files SET status = 'cancelled' WHERE id = $1", jobID); err != nil {
+		t.Fatal(err)
+	}
+	if ids := getJobs(shopPath, "completed"); len(ids) != 1 || ids[0] != jobID {
+		t.Errorf("completed Get-Jobs lists %v, want [%d]", ids, jobID)
+	}
+	if ids := getJobs(shopPath, ""); len(ids) != 0 {
+		t.Errorf("Get-Jobs lists %v after the job ended", ids)
+	}
+}
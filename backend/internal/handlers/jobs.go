@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/database"
+	"backend/internal/events"
+	"backend/internal/jobs"
+	"backend/internal/models"
+	"backend/internal/storage"
+	"backend/internal/wallet"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// transitionFile moves a job to a new status in its own transaction
+func transitionFile(fileID, changedBy int, note string, to jobs.Status) error {
+	ctx := context.Background()
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := jobs.Transition(ctx, tx, fileID, changedBy, note, to); err != nil {
+		return err
+	}
+	if err := events.Notify(ctx, tx, events.JobUpdated, fileID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// writeTransitionError reports a failed status change, using 409 Conflict
+// for transitions the job lifecycle does not allow
+func writeTransitionError(w http.ResponseWriter, err error) {
+	var illegal *jobs.IllegalTransitionError
+	if errors.As(err, &illegal) {
+		http.Error(w, illegal.Error(), http.StatusConflict)
+		return
+	}
+	http.Error(w, "Database error", http.StatusInternalServerError)
+}
+
+// shopJobFromRequest parses the {fileId} URL parameter and checks that the
+// job belongs to the calling shopkeeper's shop. It writes an error response
+// and returns ok=false if not.
+func shopJobFromRequest(w http.ResponseWriter, r *http.Request) (fileID int, claims *auth.Claims, ok bool) {
+	fileID, err := strconv.Atoi(chi.URLParam(r, "fileId"))
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return 0, nil, false
+	}
+
+	claims, ok = r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return 0, nil, false
+	}
+
+	var shopID *int
+	err = database.DB.QueryRow(context.Background(),
+		"SELECT shop_id FROM files WHERE id = $1", fileID).Scan(&shopID)
+	if err != nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return 0, nil, false
+	}
+
+	if shopID == nil || *shopID != claims.UserID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return 0, nil, false
+	}
+	return fileID, claims, true
+}
+
+// MarkQueueCollected records that the customer has picked up a printed queue job
+func MarkQueueCollected(w http.ResponseWriter, r *http.Request) {
+	fileID, claims, ok := shopJobFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := transitionFile(fileID, claims.UserID, "collected by customer", jobs.Collected); err != nil {
+		writeTransitionError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Job collected"})
+}
+
+// ReportQueueProgress stores a progress message for a job that is printing,
+// such as those sent by the shop print agent
+func ReportQueueProgress(w http.ResponseWriter, r *http.Request) {
+	fileID, _, ok := shopJobFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	tag, err := database.DB.Exec(ctx,
+		"UPDATE files SET progress = $1 WHERE id = $2 AND status = $3", req.Message, fileID, jobs.Printing)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "Job is not printing", http.StatusConflict)
+		return
+	}
+	events.Notify(ctx, database.DB, events.JobUpdated, fileID)
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Progress recorded"})
+}
+
+// FailQueuePrint marks a job whose printing failed. The job leaves the queue
+// until the shopkeeper retries it.
+func FailQueuePrint(w http.ResponseWriter, r *http.Request) {
+	fileID, claims, ok := shopJobFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	if req.Reason == "" {
+		req.Reason = "print failed"
+	}
+
+	if err := transitionFile(fileID, claims.UserID, req.Reason, jobs.Failed); err != nil {
+		writeTransitionError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Job marked as failed"})
+}
+
+// RetryQueuePrint puts a failed queue job back into the queue at its
+// original place. Private jobs never had a place in the queue, so they cannot
+// be retried here.
+func RetryQueuePrint(w http.ResponseWriter, r *http.Request) {
+	fileID, claims, ok := shopJobFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// The job reappears among the queued jobs, so take the queue lock as
+	// every other change to the queue does
+	if err := jobs.LockQueue(ctx, tx, claims.UserID); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	var printType string
+	err = tx.QueryRow(ctx, "SELECT print_type FROM files WHERE id = $1", fileID).Scan(&printType)
+	if err != nil || printType != "queue" {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+
+	if _, err := jobs.Transition(ctx, tx, fileID, claims.UserID, "retried by shop", jobs.Queued); err != nil {
+		writeTransitionError(w, err)
+		return
+	}
+	err = events.Notify(ctx, tx, events.JobUpdated, fileID)
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Job queued again"})
+}
+
+// refundJob records a refund for a job that ended without being printed,
+// if any money was collected for it. A payment held in escrow, from the
+// wallet or the payment gateway, is credited straight back to the wallet.
+// A cash or UPI job the shop marked paid is owed its total cost, paid out by
+// hand. An unpaid job has nothing to refund and nil is returned. The caller
+// must hold the job's row lock.
+func refundJob(ctx context.Context, tx pgx.Tx, fileID, customerID, changedBy int, reason string) (*models.Refund, error) {
+	credited, err := wallet.Refund(ctx, tx, fileID, customerID, changedBy)
+	if err != nil {
+		return nil, err
+	}
+	refund := models.Refund{FileID: fileID, UserID: customerID, Amount: credited, Reason: reason, Status: "credited"}
+	if credited == 0 {
+		var paidAt *time.Time
+		err := tx.QueryRow(ctx, "SELECT paid_at, total_cost FROM files WHERE id = $1", fileID).Scan(&paidAt, &refund.Amount)
+		if err != nil || paidAt == nil || refund.Amount <= 0 {
+			return nil, err
+		}
+		refund.Status = "pending"
+	}
+
+	// A job is refunded at most once
+	err = tx.QueryRow(ctx,
+		`INSERT INTO refunds (file_id, user_id, amount, reason, status)
+		 VALUES ($1, $2, $3, $4, $5) ON CONFLICT (file_id) DO NOTHING
+		 RETURNING id, created_at`,
+		refund.FileID, refund.UserID, refund.Amount, refund.Reason, refund.Status).Scan(&refund.ID, &refund.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+// CancelFile lets the owning customer withdraw a job that has not started
+// printing. The job leaves the shop queue, its stored document is deleted and
+// any money collected for it is refunded, see refundJob.
+func CancelFile(w http.ResponseWriter, r *http.Request) {
+	fileID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var ownerID int
+	var storageKey string
+	err = database.DB.QueryRow(context.Background(),
+		"SELECT user_id, storage_key FROM files WHERE id = $1", fileID).Scan(&ownerID, &storageKey)
+	if err != nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+
+	if ownerID != claims.UserID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Cancelling is only allowed from uploaded or queued, so a job that has
+	// started printing is rejected here. Leaving the queue statuses removes the
+	// job from queue_positions, which moves everyone behind it up.
+	if _, err := jobs.Transition(ctx, tx, fileID, claims.UserID, "cancelled by customer", jobs.Cancelled); err != nil {
+		writeTransitionError(w, err)
+		return
+	}
+
+	// A job still waiting for its online payment has nothing to refund. If
+	// the payment completes later anyway, it is credited to the wallet then.
+	refund, err := refundJob(ctx, tx, fileID, claims.UserID, claims.UserID, "cancelled by customer")
+	if err == nil {
+		err = events.Notify(ctx, tx, events.JobUpdated, fileID)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Delete the file from storage
+	storage.Files.Delete(ctx, storageKey)
+
+	response := map[string]interface{}{"message": "Job cancelled"}
+	if refund != nil {
+		response["refund"] = refund
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"backend/internal/database"
+	"backend/internal/database/dbtest"
+	"backend/internal/jobs"
+	"backend/internal/money"
+	"backend/internal/wallet"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// withID sets the {name} URL parameter of r
+func withID(r *http.Request, name string, id int) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add(name, strconv.Itoa(id))
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
+
+// refundOf returns the status of a job's refund, or "" if it has none
+func refundOf(t *testing.T, fileID int) string {
+	t.Helper()
+	var status string
+	err := database.DB.QueryRow(context.Background(),
+		"SELECT COALESCE((SELECT status FROM refunds WHERE file_id = $1), '')", fileID).Scan(&status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+// queueJob submits a queue job and, if markPaid, has the shop mark it paid
+func queueJob(t *testing.T, customer, shop int, method string, markPaid bool) int {
+	t.Helper()
+	job, err := createJob(newJob{
+		UserID:        customer,
+		Name:          "notes.pdf",
+		Document:      testPDF(t, 1),
+		PrintType:     "queue",
+		Settings:      printSettings{Copies: 1, PrintMode: "single", ColorMode: "bw", PaperSize: "A4"},
+		ShopID:        &shop,
+		PaymentMethod: method,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if markPaid {
+		w := httptest.NewRecorder()
+		MarkQueuePaid(w, as(withID(httptest.NewRequest(http.MethodPost, "/", nil), "fileId", job.FileID), shop, "shopkeeper"))
+		if w.Code != http.StatusOK {
+			t.Fatalf("mark paid: %d %s", w.Code, w.Body)
+		}
+	}
+	return job.FileID
+}
+
+func TestRefundOnlyCollectedMoney(t *testing.T) {
+	setup(t)
+	customer := dbtest.CreateUser(t, "customer")
+	admin := dbtest.CreateUser(t, "admin")
+	shop := dbtest.CreateShop(t, 12.97, 77.59)
+
+	ctx := context.Background()
+	tx, err := database.DB.Begin(ctx)
+	if err == nil {
+		err = wallet.AddFunds(ctx, tx, customer, money.Paise(100000), "test", admin)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		markPaid   bool
+		wantRefund string
+	}{
+		{"unpaid cash", payCash, false, ""},
+		{"cash paid at the counter", payCash, true, "pending"},
+		{"wallet", payWallet, false, "credited"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Run("cancelled", func(t *testing.T) {
+				fileID := queueJob(t, customer, shop, tt.method, tt.markPaid)
+				before := balance(t, customer)
+				w := httptest.NewRecorder()
+				CancelFile(w, as(withID(httptest.NewRequest(http.MethodDelete, "/", nil), "id", fileID), customer, "customer"))
+				if w.Code != http.StatusOK {
+					t.Fatalf("cancel: %d %s", w.Code, w.Body)
+				}
+				if got := refundOf(t, fileID); got != tt.wantRefund {
+					t.Errorf("refund %q, want %q", got, tt.wantRefund)
+				}
+				if credited := balance(t, customer) > before; credited != (tt.wantRefund == "credited") {
+					t.Errorf("wallet credited: %v", credited)
+				}
+			})
+			t.Run("expired", func(t *testing.T) {
+				fileID := queueJob(t, customer, shop, tt.method, tt.markPaid)
+				w := httptest.NewRecorder()
+				ExpireJob(w, as(withID(httptest.NewRequest(http.MethodPost, "/", nil), "id", fileID), admin, "admin"))
+				if w.Code != http.StatusOK {
+					t.Fatalf("expire: %d %s", w.Code, w.Body)
+				}
+				if status, _ := jobState(t, fileID); status != jobs.Expired {
+					t.Errorf("job is %s", status)
+				}
+				if got := refundOf(t, fileID); got != tt.wantRefund {
+					t.Errorf("refund %q, want %q", got, tt.wantRefund)
+				}
+			})
+		})
+	}
+}
+
+// privateJob submits a private job and has shop redeem it, as downloading it by code does
+func privateJob(t *testing.T, customer, shop int, status jobs.Status) int {
+	t.Helper()
+	job, err := createJob(newJob{
+		UserID:    customer,
+		Name:      "notes.pdf",
+		Document:  testPDF(t, 1),
+		PrintType: "private",
+		Settings:  printSettings{Copies: 1, PrintMode: "single", ColorMode: "bw", PaperSize: "A4"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.DB.Exec(context.Background(),
+		"UPDATE files SET shop_id = $1, status = $2 WHERE id = $3", shop, status, job.FileID); err != nil {
+		t.Fatal(err)
+	}
+	return job.FileID
+}
+
+func TestConfirmQueuePrintOnlyQueueJobs(t *testing.T) {
+	setup(t)
+	customer := dbtest.CreateUser(t, "customer")
+	shop := dbtest.CreateShop(t, 12.97, 77.59)
+
+	fileID := privateJob(t, customer, shop, jobs.Printing)
+	w := httptest.NewRecorder()
+	ConfirmQueuePrint(w, as(withID(httptest.NewRequest(http.MethodPost, "/", nil), "fileId", fileID), shop, "shopkeeper"))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("confirm private job: %d %s, want 404", w.Code, w.Body)
+	}
+	if status, _ := jobState(t, fileID); status != jobs.Printing {
+		t.Errorf("private job is %s", status)
+	}
+}
+
+func TestRetryQueuePrint(t *testing.T) {
+	setup(t)
+	customer := dbtest.CreateUser(t, "customer")
+	shop := dbtest.CreateShop(t, 12.97, 77.59)
+	retry := func(fileID int) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		RetryQueuePrint(w, as(withID(httptest.NewRequest(http.MethodPost, "/", nil), "fileId", fileID), shop, "shopkeeper"))
+		return w
+	}
+
+	queued := queueJob(t, customer, shop, payCash, false)
+	behind := queueJob(t, customer, shop, payCash, false)
+	w := httptest.NewRecorder()
+	FailQueuePrint(w, as(withID(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"reason": "paper jam"}`)), "fileId", queued), shop, "shopkeeper"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("fail: %d %s", w.Code, w.Body)
+	}
+	if w := retry(queued); w.Code != http.StatusOK {
+		t.Fatalf("retry: %d %s", w.Code, w.Body)
+	}
+	// The retried job is back ahead of the job queued after it
+	var first int
+	err := database.DB.QueryRow(context.Background(),
+		"SELECT file_id FROM queue_positions WHERE shop_id = $1 ORDER BY queue_position LIMIT 1", shop).Scan(&first)
+	if err != nil || first != queued {
+		t.Errorf("first in the queue is %d, want %d (%d behind it): %v", first, queued, behind, err)
+	}
+
+	private := privateJob(t, customer, shop, jobs.Failed)
+	if w := retry(private); w.Code != http.StatusNotFound {
+		t.Errorf("retry private job: %d %s, want 404", w.Code, w.Body)
+	}
+	if status, _ := jobState(t, private); status != jobs.Failed {
+		t.Errorf("private job is %s", status)
+	}
+}
@@ -0,0 +1,413 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/database"
+	"backend/internal/events"
+	"backend/internal/jobs"
+	"backend/internal/models"
+	"backend/internal/money"
+	"backend/internal/payments"
+	"backend/internal/storage"
+	"backend/internal/wallet"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// maxWebhookBody is the largest webhook body accepted
+	maxWebhookBody = 64 << 10
+
+	// paymentReconcileInterval is how often payments without a webhook are checked
+	paymentReconcileInterval = time.Minute
+	// paymentPollAfter is how long a payment may wait for its webhook before
+	// the gateway is asked for its status
+	paymentPollAfter = 2 * time.Minute
+	// paymentTimeout is how long a customer has to pay before the job expires
+	paymentTimeout = 30 * time.Minute
+)
+
+var (
+	// errPaymentUnavailable is returned by createJob when the gateway could not start a payment
+	errPaymentUnavailable = errors.New("payment gateway unavailable")
+	// errUnknownPayment is returned for a gateway payment with no intent here
+	errUnknownPayment = errors.New("unknown payment")
+	// errPaymentMismatch is returned when a succeeded payment is not for the job's price
+	errPaymentMismatch = errors.New("payment amount does not match the job")
+)
+
+// paymentReference is the reference a job's payment carries at the gateway
+func paymentReference(fileID int) string {
+	return "file-" + strconv.Itoa(fileID)
+}
+
+// startPayment creates the gateway payment for a job waiting to be paid
+// online and records it as the job's payment intent
+func startPayment(ctx context.Context, fileID, userID int, amount money.Paise) (*models.PaymentIntent, error) {
+	p, err := payments.Gateway.Create(ctx, int64(amount), payments.Currency, paymentReference(fileID))
+	if err != nil {
+		log.Printf("Failed to start payment for file %d: %v", fileID, err)
+		return nil, errPaymentUnavailable
+	}
+
+	intent := models.PaymentIntent{
+		FileID:            fileID,
+		ProviderPaymentID: p.ID,
+		Amount:            amount,
+		Currency:          payments.Currency,
+		Status:            string(payments.Created),
+		CheckoutURL:       p.CheckoutURL,
+	}
+	err = database.DB.QueryRow(ctx,
+		`INSERT INTO payment_intents (file_id, user_id, provider_payment_id, amount, currency, checkout_url)
+		 VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`,
+		fileID, userID, p.ID, amount, payments.Currency, p.CheckoutURL).Scan(&intent.ID, &intent.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &intent, nil
+}
+
+// abandonJob cancels a job whose payment could not be started and deletes its document
+func abandonJob(ctx context.Context, fileID, userID int, storageKey string) {
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to cancel unpaid file %d: %v", fileID, err)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = jobs.Transition(ctx, tx, fileID, userID, "payment could not be started", jobs.Cancelled)
+	if err == nil {
+		err = events.Notify(ctx, tx, events.JobUpdated, fileID)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		log.Printf("Failed to cancel unpaid file %d: %v", fileID, err)
+		return
+	}
+	storage.Files.Delete(ctx, storageKey)
+}
+
+// applyPayment applies a final gateway status to a payment intent and its
+// job. The intent row is locked, so a webhook and the reconciler racing on
+// the same payment apply it once. A succeeded payment queues the job, or is
+// credited to the customer's wallet if the job was cancelled or expired in
+// the meantime. A failed or expired payment ends the job. It returns the
+// storage key of a document to delete once tx commits.
+func applyPayment(ctx context.Context, tx pgx.Tx, p payments.Payment) (string, error) {
+	var intentID, fileID, userID int
+	var amount money.Paise
+	var status string
+	err := tx.QueryRow(ctx,
+		`SELECT id, file_id, user_id, amount, status FROM payment_intents
+		 WHERE provider_payment_id = $1 FOR UPDATE`, p.ID).Scan(&intentID, &fileID, &userID, &amount, &status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", errUnknownPayment
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Only a waiting payment changes, except that money arriving after the
+	// job expired locally is still taken and credited to the wallet
+	switch {
+	case p.Status == payments.Created:
+		return "", nil
+	case payments.Status(status) == payments.Created:
+	case payments.Status(status) == payments.Expired && p.Status == payments.Succeeded:
+	default:
+		return "", nil
+	}
+	if p.Status == payments.Succeeded && (p.Amount != int64(amount) || p.Currency != payments.Currency) {
+		return "", errPaymentMismatch
+	}
+
+	if _, err := tx.Exec(ctx,
+		"UPDATE payment_intents SET status = $2, completed_at = NOW() WHERE id = $1", intentID, p.Status); err != nil {
+		return "", err
+	}
+
+	var shopID int
+	var storageKey string
+	if err := tx.QueryRow(ctx,
+		"SELECT shop_id, storage_key FROM files WHERE id = $1", fileID).Scan(&shopID, &storageKey); err != nil {
+		return "", err
+	}
+
+	var deleteKey string
+	switch p.Status {
+	case payments.Succeeded:
+		err = settleOnlinePayment(ctx, tx, fileID, userID, shopID, amount)
+	case payments.Failed:
+		err = endUnpaidJob(ctx, tx, fileID, userID, "payment failed", jobs.Cancelled)
+		deleteKey = storageKey
+	case payments.Expired:
+		err = endUnpaidJob(ctx, tx, fileID, userID, "payment not completed", jobs.Expired)
+		deleteKey = storageKey
+	default:
+		return "", fmt.Errorf("unknown payment status %q", p.Status)
+	}
+	if err != nil {
+		return "", err
+	}
+	return deleteKey, events.Notify(ctx, tx, events.JobUpdated, fileID)
+}
+
+// settleOnlinePayment takes a succeeded payment into escrow and queues its
+// job. A job that is no longer waiting for payment has its money credited
+// to the customer's wallet instead.
+func settleOnlinePayment(ctx context.Context, tx pgx.Tx, fileID, userID, shopID int, amount money.Paise) error {
+	if err := wallet.PayOnline(ctx, tx, fileID, userID, amount); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, "UPDATE files SET paid_at = NOW() WHERE id = $1", fileID); err != nil {
+		return err
+	}
+
+	// The queue counter is locked before the file row, in the same order as
+	// every queue reordering
+	seq, err := jobs.Enqueue(ctx, tx, shopID)
+	if err != nil {
+		return err
+	}
+	_, err = jobs.Transition(ctx, tx, fileID, userID, "payment received", jobs.Queued)
+	var illegal *jobs.IllegalTransitionError
+	if errors.As(err, &illegal) {
+		if _, err := wallet.Refund(ctx, tx, fileID, userID, userID); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx,
+			`INSERT INTO refunds (file_id, user_id, amount, reason, status)
+			 VALUES ($1, $2, $3, $4, 'credited') ON CONFLICT (file_id) DO NOTHING`,
+			fileID, userID, amount, "paid after the job was "+string(illegal.From))
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, "UPDATE files SET queue_seq = $1 WHERE id = $2", seq, fileID)
+	return err
+}
+
+// endUnpaidJob moves a job whose payment never arrived to a final status.
+// A job the customer already cancelled is left as it is.
+func endUnpaidJob(ctx context.Context, tx pgx.Tx, fileID, userID int, note string, to jobs.Status) error {
+	_, err := jobs.Transition(ctx, tx, fileID, userID, note, to)
+	var illegal *jobs.IllegalTransitionError
+	if errors.As(err, &illegal) {
+		return nil
+	}
+	return err
+}
+
+// PaymentWebhook receives signed payment events from the gateway. Events are
+// recorded by ID, so a redelivered event is acknowledged without being
+// applied twice. Any response other than 200 makes the gateway retry.
+func PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	if payments.Gateway == nil {
+		http.Error(w, "Online payments are disabled", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, "Invalid body", http.StatusBadRequest)
+		return
+	}
+	event, err := payments.VerifyWebhook(payments.WebhookSecret, r.Header.Get(payments.SignatureHeader), body, time.Now())
+	if errors.Is(err, payments.ErrBadSignature) {
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+	if err != nil || event.ID == "" || event.Payment.ID == "" {
+		http.Error(w, "Invalid event", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx,
+		`INSERT INTO payment_events (event_id, provider_payment_id, type)
+		 VALUES ($1, $2, $3) ON CONFLICT (event_id) DO NOTHING`, event.ID, event.Payment.ID, event.Type)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Event already processed"})
+		return
+	}
+
+	deleteKey, err := applyPayment(ctx, tx, event.Payment)
+	if errors.Is(err, errUnknownPayment) {
+		http.Error(w, "Payment not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, errPaymentMismatch) {
+		log.Printf("Payment %s does not match its job: %d %s", event.Payment.ID, event.Payment.Amount, event.Payment.Currency)
+		http.Error(w, "Payment amount does not match", http.StatusUnprocessableEntity)
+		return
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if deleteKey != "" {
+		storage.Files.Delete(ctx, deleteKey)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Event processed"})
+}
+
+// GetPayment returns the online payment for one of the caller's jobs
+func GetPayment(w http.ResponseWriter, r *http.Request) {
+	fileID, err := strconv.Atoi(chi.URLParam(r, "fileId"))
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var intent models.PaymentIntent
+	err = database.DB.QueryRow(context.Background(),
+		`SELECT id, file_id, provider_payment_id, amount, currency, status,
+		 COALESCE(checkout_url, ''), created_at, completed_at
+		 FROM payment_intents WHERE file_id = $1 AND user_id = $2`, fileID, claims.UserID).Scan(
+		&intent.ID, &intent.FileID, &intent.ProviderPaymentID, &intent.Amount, &intent.Currency, &intent.Status,
+		&intent.CheckoutURL, &intent.CreatedAt, &intent.CompletedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Payment not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// The checkout link is only useful while the payment is open
+	if intent.Status != string(payments.Created) {
+		intent.CheckoutURL = ""
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(intent)
+}
+
+// ReconcilePayments runs until ctx is cancelled, settling payments whose
+// webhook never arrived by asking the gateway for their status, and expiring
+// jobs whose customer never paid
+func ReconcilePayments(ctx context.Context) {
+	if payments.Gateway == nil {
+		return
+	}
+
+	ticker := time.NewTicker(paymentReconcileInterval)
+	defer ticker.Stop()
+	for {
+		if err := reconcilePayments(ctx); err != nil {
+			log.Printf("Payment reconciliation failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func reconcilePayments(ctx context.Context) error {
+	type openPayment struct {
+		id       string
+		timedOut bool
+	}
+
+	rows, err := database.DB.Query(ctx,
+		`SELECT provider_payment_id, created_at < NOW() - $2 * INTERVAL '1 second'
+		 FROM payment_intents
+		 WHERE status = 'created' AND created_at < NOW() - $1 * INTERVAL '1 second'
+		 ORDER BY created_at`, paymentPollAfter.Seconds(), paymentTimeout.Seconds())
+	if err != nil {
+		return err
+	}
+	var open []openPayment
+	for rows.Next() {
+		var p openPayment
+		if err := rows.Scan(&p.id, &p.timedOut); err != nil {
+			rows.Close()
+			return err
+		}
+		open = append(open, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, open := range open {
+		p, err := payments.Gateway.Get(ctx, open.id)
+		if err != nil {
+			log.Printf("Failed to check payment %s: %v", open.id, err)
+			continue
+		}
+		if p.Status == payments.Created {
+			if !open.timedOut {
+				continue
+			}
+			p.Status = payments.Expired
+		}
+		if err := reconcilePayment(ctx, p); err != nil {
+			log.Printf("Failed to apply payment %s: %v", open.id, err)
+		}
+	}
+	return nil
+}
+
+func reconcilePayment(ctx context.Context, p payments.Payment) error {
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	deleteKey, err := applyPayment(ctx, tx, p)
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	if deleteKey != "" {
+		storage.Files.Delete(ctx, deleteKey)
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend/internal/database"
+	"backend/internal/database/dbtest"
+	"backend/internal/jobs"
+	"backend/internal/models"
+	"backend/internal/payments"
+	"backend/internal/payments/mock"
+)
+
+var webhookSecret = []byte("whsec_test")
+
+// paymentTest runs the online payment flow against the mock gateway, which
+// delivers its webhooks to PaymentWebhook
+type paymentTest struct {
+	url      string // of the mock gateway
+	customer int
+	shop     int
+}
+
+func newPaymentTest(t *testing.T) *paymentTest {
+	setup(t)
+
+	hook := httptest.NewServer(http.HandlerFunc(PaymentWebhook))
+	t.Cleanup(hook.Close)
+	gateway := mock.New("key_test", webhookSecret, hook.URL, "")
+	server := httptest.NewServer(gateway)
+	t.Cleanup(server.Close)
+	gateway.PublicURL = server.URL
+
+	previousGateway, previousSecret := payments.Gateway, payments.WebhookSecret
+	payments.Gateway = payments.NewHTTPProvider(server.URL, "key_test")
+	payments.WebhookSecret = webhookSecret
+	t.Cleanup(func() {
+		payments.Gateway, payments.WebhookSecret = previousGateway, previousSecret
+	})
+
+	return &paymentTest{
+		url:      server.URL,
+		customer: dbtest.CreateUser(t, "customer"),
+		shop:     dbtest.CreateShop(t, 12.97, 77.59),
+	}
+}
+
+// submit uploads a queue job paid online and returns it
+func (p *paymentTest) submit(t *testing.T) *models.UploadResponse {
+	t.Helper()
+	job, err := createJob(newJob{
+		UserID:        p.customer,
+		Name:          "notes.pdf",
+		Document:      testPDF(t, 2),
+		PrintType:     "queue",
+		Settings:      printSettings{Copies: 1, PrintMode: "single", ColorMode: "bw", PaperSize: "A4"},
+		ShopID:        &p.shop,
+		PaymentMethod: payOnline,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Payment == nil {
+		t.Fatal("online job has no payment")
+	}
+	return job
+}
+
+// post sends a request to the mock gateway's checkout or test controls
+func (p *paymentTest) post(t *testing.T, path string) {
+	t.Helper()
+	resp, err := http.Post(p.url+path, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST %s: %s", path, resp.Status)
+	}
+}
+
+// deliver sends a webhook to PaymentWebhook as the gateway would
+func deliver(event payments.Event, signature func(body []byte) string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(event)
+	r := httptest.NewRequest(http.MethodPost, "/payments/webhook", bytes.NewReader(body))
+	r.Header.Set(payments.SignatureHeader, signature(body))
+	w := httptest.NewRecorder()
+	PaymentWebhook(w, r)
+	return w
+}
+
+func countRows(t *testing.T, query string, args ...any) int {
+	t.Helper()
+	var n int
+	if err := database.DB.QueryRow(context.Background(), query, args...).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestOnlinePayment(t *testing.T) {
+	p := newPaymentTest(t)
+	job := p.submit(t)
+
+	if status, paid := jobState(t, job.FileID); status != jobs.PendingPayment || paid {
+		t.Fatalf("new job is %s, paid %v; want pending_payment, unpaid", status, paid)
+	}
+	if job.Payment.Amount != job.TotalCost || job.Payment.CheckoutURL == "" {
+		t.Errorf("payment %+v for a job costing %s", job.Payment, job.TotalCost)
+	}
+
+	p.post(t, "/checkout/"+job.Payment.ProviderPaymentID+"/succeed")
+
+	if status, paid := jobState(t, job.FileID); status != jobs.Queued || !paid {
+		t.Fatalf("paid job is %s, paid %v; want queued, paid", status, paid)
+	}
+	ledger := "SELECT COUNT(*) FROM ledger_transactions WHERE file_id = $1"
+	if n := countRows(t, ledger, job.FileID); n != 1 {
+		t.Fatalf("%d ledger entries for the payment, want 1", n)
+	}
+
+	// The gateway delivers the same event again
+	p.post(t, "/mock/payments/"+job.Payment.ProviderPaymentID+"/resend")
+	if n := countRows(t, ledger, job.FileID); n != 1 {
+		t.Errorf("%d ledger entries after a redelivered webhook, want 1", n)
+	}
+	if n := countRows(t, "SELECT COUNT(*) FROM payment_events WHERE provider_payment_id = $1",
+		job.Payment.ProviderPaymentID); n != 1 {
+		t.Errorf("%d recorded events, want 1", n)
+	}
+}
+
+func TestPaymentWebhookSignature(t *testing.T) {
+	p := newPaymentTest(t)
+	job := p.submit(t)
+
+	event := payments.Event{
+		ID:   "evt_forged",
+		Type: "payment.succeeded",
+		Payment: payments.Payment{
+			ID:       job.Payment.ProviderPaymentID,
+			Status:   payments.Succeeded,
+			Amount:   int64(job.TotalCost),
+			Currency: payments.Currency,
+		},
+	}
+	tests := []struct {
+		name string
+		sign func(body []byte) string
+	}{
+		{"unsigned", func([]byte) string { return "" }},
+		{"wrong secret", func(body []byte) string { return payments.Sign([]byte("guess"), time.Now(), body) }},
+		{"stale", func(body []byte) string { return payments.Sign(webhookSecret, time.Now().Add(-10*time.Minute), body) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := deliver(event, tt.sign); w.Code != http.StatusUnauthorized {
+				t.Errorf("got %d, want 401", w.Code)
+			}
+			if status, _ := jobState(t, job.FileID); status != jobs.PendingPayment {
+				t.Errorf("job is %s after a rejected webhook", status)
+			}
+		})
+	}
+
+	// A rejected event is not recorded, so the genuine delivery still applies
+	valid := func(body []byte) string { return payments.Sign(webhookSecret, time.Now(), body) }
+	if w := deliver(event, valid); w.Code != http.StatusOK {
+		t.Fatalf("valid webhook: %d %s", w.Code, w.Body)
+	}
+	if status, paid := jobState(t, job.FileID); status != jobs.Queued || !paid {
+		t.Errorf("job is %s, paid %v after a valid webhook", status, paid)
+	}
+
+	// An event for a different amount is refused
+	other := p.submit(t)
+	event.ID = "evt_short"
+	event.Payment.ID = other.Payment.ProviderPaymentID
+	event.Payment.Amount = int64(other.TotalCost) - 1
+	if w := deliver(event, valid); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("short payment: got %d, want 422", w.Code)
+	}
+}
+
+func TestPaymentFailed(t *testing.T) {
+	p := newPaymentTest(t)
+	job := p.submit(t)
+
+	p.post(t, "/checkout/"+job.Payment.ProviderPaymentID+"/fail")
+
+	if status, paid := jobState(t, job.FileID); status != jobs.Cancelled || paid {
+		t.Errorf("job is %s, paid %v after a failed payment; want cancelled, unpaid", status, paid)
+	}
+}
+
+func TestPaymentReconciled(t *testing.T) {
+	p := newPaymentTest(t)
+	job := p.submit(t)
+	ctx := context.Background()
+
+	// The webhook is lost; the reconciler asks the gateway once the payment
+	// has waited long enough
+	p.post(t, "/checkout/"+job.Payment.ProviderPaymentID+"/silent-succeed")
+	if err := reconcilePayments(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := jobState(t, job.FileID); status != jobs.PendingPayment {
+		t.Fatalf("job is %s before the poll delay", status)
+	}
+
+	backdate(t, job.FileID, paymentPollAfter+time.Minute)
+	if err := reconcilePayments(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if status, paid := jobState(t, job.FileID); status != jobs.Queued || !paid {
+		t.Errorf("job is %s, paid %v after reconciliation; want queued, paid", status, paid)
+	}
+}
+
+func TestPaymentAfterExpiry(t *testing.T) {
+	p := newPaymentTest(t)
+	job := p.submit(t)
+	ctx := context.Background()
+
+	// The customer does not pay in time
+	backdate(t, job.FileID, paymentTimeout+time.Minute)
+	if err := reconcilePayments(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := jobState(t, job.FileID); status != jobs.Expired {
+		t.Fatalf("job is %s after the payment timed out, want expired", status)
+	}
+
+	// ...and then does. The money goes to their wallet.
+	p.post(t, "/checkout/"+job.Payment.ProviderPaymentID+"/succeed")
+
+	if status, _ := jobState(t, job.FileID); status != jobs.Expired {
+		t.Errorf("job is %s after a late payment, want expired", status)
+	}
+	if b := balance(t, p.customer); b != job.TotalCost {
+		t.Errorf("wallet balance %s after a late payment of %s", b, job.TotalCost)
+	}
+	if n := countRows(t, "SELECT COUNT(*) FROM refunds WHERE file_id = $1 AND status = 'credited' AND amount = $2",
+		job.FileID, job.TotalCost); n != 1 {
+		t.Errorf("%d credited refunds, want 1", n)
+	}
+
+	// Redelivery credits nothing more
+	p.post(t, "/mock/payments/"+job.Payment.ProviderPaymentID+"/resend")
+	if b := balance(t, p.customer); b != job.TotalCost {
+		t.Errorf("wallet balance %s after a redelivered late payment, want %s", b, job.TotalCost)
+	}
+}
+
+// backdate makes a job's payment look as if it was started d ago
+func backdate(t *testing.T, fileID int, d time.Duration) {
+	t.Helper()
+	_, err := database.DB.Exec(context.Background(),
+		"UPDATE payment_intents SET created_at = created_at - $2 * INTERVAL '1 second' WHERE file_id = $1",
+		fileID, d.Seconds())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/database"
+	"backend/internal/models"
+	"backend/internal/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// priceCardColumns select a row of price_cards
+const priceCardColumns = `id, shop_id, version, rates, min_order, per_job_fee, gst_rate, created_at`
+
+// scanPriceCard scans priceCardColumns
+func scanPriceCard(row pgx.Row) (*models.PriceCard, error) {
+	var card models.PriceCard
+	err := row.Scan(&card.ID, &card.ShopID, &card.Version,
+		&card.Rates, &card.MinOrder, &card.PerJobFee, &card.GSTRate, &card.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
+
+// loadPriceCard returns the latest published price card for a shop.
+// Shops that have not published a card are priced with the default card.
+func loadPriceCard(shopID int) (*models.PriceCard, error) {
+	card, err := scanPriceCard(database.DB.QueryRow(context.Background(),
+		"SELECT "+priceCardColumns+" FROM price_cards WHERE shop_id = $1 ORDER BY version DESC LIMIT 1", shopID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return utils.DefaultPriceCard(), nil
+	}
+	return card, err
+}
+
+// loadPriceCardVersion returns the version of a shop's price card that
+// priced a job. Jobs without a card version were priced with the default card.
+func loadPriceCardVersion(shopID int, version *int) (*models.PriceCard, error) {
+	if version == nil {
+		return utils.DefaultPriceCard(), nil
+	}
+	return scanPriceCard(database.DB.QueryRow(context.Background(),
+		"SELECT "+priceCardColumns+" FROM price_cards WHERE shop_id = $1 AND version = $2", shopID, *version))
+}
+
+// GetMyPriceCard returns the calling shopkeeper's current price card
+func GetMyPriceCard(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	card, err := loadPriceCard(claims.UserID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(card)
+}
+
+// PublishPriceCard stores a new version of the calling shopkeeper's price card.
+// Earlier versions are kept so jobs priced with them can still be explained.
+func PublishPriceCard(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.PriceCardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	card := models.PriceCard{
+		ShopID:    claims.UserID,
+		Rates:     req.Rates,
+		MinOrder:  req.MinOrder,
+		PerJobFee: req.PerJobFee,
+		GSTRate:   req.GSTRate,
+	}
+	if err := utils.ValidatePriceCard(&card); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Only shops registered for GST may charge it
+	if card.GSTRate > 0 {
+		var gstin *string
+		err := database.DB.QueryRow(context.Background(),
+			"SELECT gstin FROM shops WHERE user_id = $1", claims.UserID).Scan(&gstin)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if gstin == nil {
+			http.Error(w, "Add your GSTIN to your shop profile before charging GST", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// The unique (shop_id, version) constraint rejects a concurrent publish
+	// that computed the same version.
+	err := database.DB.QueryRow(context.Background(),
+		`INSERT INTO price_cards (shop_id, version, rates, min_order, per_job_fee, gst_rate)
+		 VALUES ($1, (SELECT COALESCE(MAX(version), 0) + 1 FROM price_cards WHERE shop_id = $1), $2, $3, $4, $5)
+		 RETURNING id, version, created_at`,
+		card.ShopID, card.Rates, card.MinOrder, card.PerJobFee, card.GSTRate).Scan(&card.ID, &card.Version, &card.CreatedAt)
+
+	if err != nil {
+		http.Error(w, "Failed to publish price card", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(card)
+}
+
+// GetShopPriceCard returns the current price card of any shop
+func GetShopPriceCard(w http.ResponseWriter, r *http.Request) {
+	shopID, err := strconv.Atoi(chi.URLParam(r, "shopId"))
+	if err != nil {
+		http.Error(w, "Invalid shop ID", http.StatusBadRequest)
+		return
+	}
+
+	var role string
+	err = database.DB.QueryRow(context.Background(),
+		"SELECT role FROM users WHERE id = $1", shopID).Scan(&role)
+	if err != nil || role != auth.RoleShopkeeper {
+		http.Error(w, "Shop not found", http.StatusNotFound)
+		return
+	}
+
+	card, err := loadPriceCard(shopID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	card.ShopID = shopID
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(card)
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/database"
+	"backend/internal/events"
+	"backend/internal/jobs"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// updateShopQueue runs a queue change for the calling shopkeeper's queue in a
+// single transaction, so customers polling their position see either the old
+// or the new order, never a mix of both.
+func updateShopQueue(w http.ResponseWriter, r *http.Request, message string,
+	change func(ctx context.Context, tx pgx.Tx, shopID, fileID int) error) {
+	fileID, err := strconv.Atoi(chi.URLParam(r, "fileId"))
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if err := change(ctx, tx, claims.UserID, fileID); err != nil {
+		switch {
+		case errors.Is(err, jobs.ErrNotQueued), errors.Is(err, jobs.ErrQueueEdge):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := events.Notify(ctx, tx, events.QueueChanged, fileID); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+// MoveQueueJob moves a job one place up or down in the shop queue
+func MoveQueueJob(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Direction string `json:"direction"` // "up" or "down"
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Direction != "up" && req.Direction != "down" {
+		http.Error(w, "direction must be \"up\" or \"down\"", http.StatusBadRequest)
+		return
+	}
+
+	updateShopQueue(w, r, "Job moved "+req.Direction, func(ctx context.Context, tx pgx.Tx, shopID, fileID int) error {
+		return jobs.Move(ctx, tx, shopID, fileID, req.Direction == "up")
+	})
+}
+
+// PinQueueJob makes a job a priority job, ahead of every normal job
+func PinQueueJob(w http.ResponseWriter, r *http.Request) {
+	updateShopQueue(w, r, "Job pinned", func(ctx context.Context, tx pgx.Tx, shopID, fileID int) error {
+		return jobs.SetPriority(ctx, tx, shopID, fileID, true)
+	})
+}
+
+// UnpinQueueJob returns a priority job to its normal place in the queue
+func UnpinQueueJob(w http.ResponseWriter, r *http.Request) {
+	updateShopQueue(w, r, "Job unpinned", func(ctx context.Context, tx pgx.Tx, shopID, fileID int) error {
+		return jobs.SetPriority(ctx, tx, shopID, fileID, false)
+	})
+}
+
+// HoldQueueJob puts a job on hold; it keeps no queue position until resumed
+func HoldQueueJob(w http.ResponseWriter, r *http.Request) {
+	updateShopQueue(w, r, "Job on hold", func(ctx context.Context, tx pgx.Tx, shopID, fileID int) error {
+		return jobs.SetHold(ctx, tx, shopID, fileID, true)
+	})
+}
+
+// ResumeQueueJob takes a job off hold
+func ResumeQueueJob(w http.ResponseWriter, r *http.Request) {
+	updateShopQueue(w, r, "Job resumed", func(ctx context.Context, tx pgx.Tx, shopID, fileID int) error {
+		return jobs.SetHold(ctx, tx, shopID, fileID, false)
+	})
+}
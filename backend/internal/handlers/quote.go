@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/encryption"
+	"backend/internal/models"
+	"backend/internal/storage"
+	"backend/internal/utils"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// stagingPrefix is the storage key prefix for staged documents
+	stagingPrefix = "staging/"
+	// stagedUploadTTL is how long a staged document can be referenced by
+	// POST /quote and POST /upload before it is swept
+	stagedUploadTTL   = time.Hour
+	defaultQuoteShops = 5
+)
+
+var stagedIDPattern = regexp.MustCompile(`^[0-9]+-[0-9a-f]{32}$`)
+
+// stageUpload seals a document into the staging area and returns its staged ID.
+// Staged IDs are prefixed with the owner's user ID so they cannot be claimed by others.
+// The wrapped data key is stored next to the document as <staged ID>.key.
+func stageUpload(userID int, data []byte) (string, error) {
+	sweepStagedUploads()
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	stagedID := fmt.Sprintf("%d-%s", userID, hex.EncodeToString(b))
+
+	sealed, env, err := encryption.Keys.Seal(data)
+	if err != nil {
+		return "", err
+	}
+	envJSON, err := json.Marshal(env)
+	if err != nil {
+		return "", err
+	}
+
+	ctx := context.Background()
+	key := stagingPrefix + stagedID + ".pdf"
+	if err := storage.Files.Put(ctx, stagedEnvelopeKey(key), bytes.NewReader(envJSON)); err != nil {
+		return "", err
+	}
+	if err := storage.Files.Put(ctx, key, bytes.NewReader(sealed)); err != nil {
+		storage.Files.Delete(ctx, stagedEnvelopeKey(key))
+		return "", err
+	}
+	return stagedID, nil
+}
+
+// stagedEnvelopeKey returns the storage key of a staged document's wrapped data key
+func stagedEnvelopeKey(key string) string {
+	return strings.TrimSuffix(key, ".pdf") + ".key"
+}
+
+// stagedUploadKey resolves a staged ID owned by userID to its storage key
+func stagedUploadKey(userID int, stagedID string) (string, error) {
+	if !stagedIDPattern.MatchString(stagedID) || !strings.HasPrefix(stagedID, strconv.Itoa(userID)+"-") {
+		return "", errors.New("invalid staged upload")
+	}
+
+	key := stagingPrefix + stagedID + ".pdf"
+	info, err := storage.Files.Stat(context.Background(), key)
+	if err != nil {
+		return "", err
+	}
+	if time.Since(info.ModTime) > stagedUploadTTL {
+		deleteStaged(key)
+		return "", errors.New("staged upload expired")
+	}
+	return key, nil
+}
+
+// readStaged decrypts a staged document into memory
+func readStaged(key string) ([]byte, error) {
+	ctx := context.Background()
+	envSrc, _, err := storage.Files.Open(ctx, stagedEnvelopeKey(key))
+	if err != nil {
+		return nil, err
+	}
+	var env encryption.Envelope
+	err = json.NewDecoder(envSrc).Decode(&env)
+	envSrc.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	src, _, err := storage.Files.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	plain, err := encryption.Keys.Open(src, &env)
+	if err != nil {
+		return nil, err
+	}
+	return readUpload(plain)
+}
+
+// deleteStaged removes a staged document and its wrapped data key
+func deleteStaged(key string) {
+	ctx := context.Background()
+	storage.Files.Delete(ctx, key)
+	storage.Files.Delete(ctx, stagedEnvelopeKey(key))
+}
+
+// sweepStagedUploads removes staged documents older than stagedUploadTTL
+func sweepStagedUploads() {
+	ctx := context.Background()
+	objects, err := storage.Files.List(ctx, stagingPrefix)
+	if err != nil {
+		return
+	}
+	for _, obj := range objects {
+		if time.Since(obj.ModTime) > stagedUploadTTL {
+			storage.Files.Delete(ctx, obj.Key)
+		}
+	}
+}
+
+// readQuotedDocument returns the document a quote is for: the "file" form
+// field, or the document referenced by "staged_id". With stage=true an
+// uploaded document is also staged and its staged ID returned.
+func readQuotedDocument(w http.ResponseWriter, r *http.Request, userID int) ([]byte, string, bool) {
+	if stagedID := r.FormValue("staged_id"); stagedID != "" {
+		key, err := stagedUploadKey(userID, stagedID)
+		var data []byte
+		if err == nil {
+			data, err = readStaged(key)
+		}
+		if err != nil {
+			http.Error(w, "Staged upload not found", http.StatusNotFound)
+			return nil, "", false
+		}
+		return data, stagedID, true
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Error retrieving file", http.StatusBadRequest)
+		return nil, "", false
+	}
+	defer file.Close()
+
+	data, err := readUpload(file)
+	if err != nil {
+		http.Error(w, "Error reading file", http.StatusBadRequest)
+		return nil, "", false
+	}
+
+	var stagedID string
+	if r.FormValue("stage") == "true" {
+		stagedID, err = stageUpload(userID, data)
+		if err != nil {
+			http.Error(w, "Error staging file", http.StatusInternalServerError)
+			return nil, "", false
+		}
+	}
+	return data, stagedID, true
+}
+
+// quoteShops prices a job at each shop. Shops that cannot print the job are
+// quoted as unavailable with the reason.
+func quoteShops(shops []nearbyShop, numPages int, settings printSettings) ([]models.ShopQuote, error) {
+	quotes := []models.ShopQuote{}
+	for _, shop := range shops {
+		quote := models.ShopQuote{
+			ShopID:   shop.ID,
+			ShopName: shop.Username,
+			Distance: shop.Distance,
+			Open:     shop.Open,
+		}
+		if err := utils.CanPrint(shop.ShopCapabilities, settings.PaperSize, settings.ColorMode, settings.PrintMode); err != nil {
+			quote.Reason = err.Error()
+			quotes = append(quotes, quote)
+			continue
+		}
+
+		card, err := loadPriceCard(shop.ID)
+		if err != nil {
+			return nil, err
+		}
+		quote.PriceCardVersion = card.Version
+
+		cost, err := utils.CalculateCost(card, numPages, settings.Copies, settings.PaperSize, settings.ColorMode, settings.PrintMode)
+		if err != nil {
+			quote.Reason = err.Error()
+		} else {
+			quote.Available = true
+			quote.TotalCost = cost
+		}
+		quotes = append(quotes, quote)
+	}
+	return quotes, nil
+}
+
+// GetQuote counts the pages of a document and prices it at the nearest shops
+// without creating a files row or taking a queue position. The document is
+// either sent as the "file" form field or referenced by "staged_id". With
+// stage=true the uploaded document is kept in the staging area so a later
+// POST /upload can reference it instead of uploading it again.
+func GetQuote(w http.ResponseWriter, r *http.Request) {
+	// Limit file size to 10MB
+	r.ParseMultipartForm(10 << 20)
+
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	data, stagedID, ok := readQuotedDocument(w, r, claims.UserID)
+	if !ok {
+		return
+	}
+
+	settings, err := parsePrintSettings(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	numPages, err := countPages(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	search, err := parseShopSearch(r, claims.UserID, defaultQuoteShops)
+	if err != nil {
+		writeSearchError(w, err)
+		return
+	}
+	shops, _, err := searchShops(context.Background(), search)
+	if err != nil {
+		writeSearchError(w, err)
+		return
+	}
+
+	quotes, err := quoteShops(shops, numPages, settings)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.QuoteResponse{
+		StagedID:  stagedID,
+		NumPages:  numPages,
+		Copies:    settings.Copies,
+		PrintMode: settings.PrintMode,
+		ColorMode: settings.ColorMode,
+		PaperSize: settings.PaperSize,
+		Quotes:    quotes,
+	})
+}
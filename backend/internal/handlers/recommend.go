@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/database"
+	"backend/internal/jobs"
+	"backend/internal/models"
+	"backend/internal/utils"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"time"
+)
+
+// defaultRecommendShops is how many nearby shops are considered for a recommendation
+const defaultRecommendShops = 20
+
+// queueLoad is the work waiting in a shop queue
+type queueLoad struct {
+	Jobs  int
+	Pages int           // pages × copies
+	Wait  time.Duration // until the queue is estimated to clear
+}
+
+// loadQueueLoads returns the queued work at each of the given shops. Held
+// jobs are not counted because they do not hold up new jobs.
+func loadQueueLoads(ctx context.Context, shopIDs []int) (map[int]queueLoad, error) {
+	rows, err := database.DB.Query(ctx,
+		`SELECT q.shop_id, COUNT(*), COALESCE(SUM(f.num_pages * f.copies), 0)
+		 FROM queue_positions q JOIN files f ON f.id = q.file_id
+		 WHERE q.shop_id = ANY($1)
+		 GROUP BY q.shop_id`, shopIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	loads := make(map[int]queueLoad)
+	for rows.Next() {
+		var shopID int
+		var load queueLoad
+		if err := rows.Scan(&shopID, &load.Jobs, &load.Pages); err != nil {
+			return nil, err
+		}
+		loads[shopID] = load
+	}
+	return loads, rows.Err()
+}
+
+// RecommendShops ranks nearby shops for a print job by distance, queue
+// length, estimated wait, price and whether the shop is open, and explains
+// each shop's score. It takes the same document, print settings and search
+// parameters as GetQuote.
+func RecommendShops(w http.ResponseWriter, r *http.Request) {
+	// Limit file size to 10MB
+	r.ParseMultipartForm(10 << 20)
+
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	data, stagedID, ok := readQuotedDocument(w, r, claims.UserID)
+	if !ok {
+		return
+	}
+
+	settings, err := parsePrintSettings(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	numPages, err := countPages(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	search, err := parseShopSearch(r, claims.UserID, defaultRecommendShops)
+	if err != nil {
+		writeSearchError(w, err)
+		return
+	}
+
+	ctx := context.Background()
+	shops, _, err := searchShops(ctx, search)
+	if err != nil {
+		writeSearchError(w, err)
+		return
+	}
+
+	quotes, err := quoteShops(shops, numPages, settings)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	shopIDs := make([]int, len(shops))
+	for i, shop := range shops {
+		shopIDs[i] = shop.ID
+	}
+	loads, err := loadQueueLoads(ctx, shopIDs)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	clearsAt, err := jobs.LoadQueueClear(ctx, database.DB, shopIDs)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	for shopID, at := range clearsAt {
+		load := loads[shopID]
+		load.Wait = time.Until(at)
+		loads[shopID] = load
+	}
+
+	recs := make([]models.ShopRecommendation, len(quotes))
+	for i, quote := range quotes {
+		load := loads[quote.ShopID]
+		recs[i] = models.ShopRecommendation{
+			ShopQuote:            quote,
+			QueueJobs:            load.Jobs,
+			QueuePages:           load.Pages,
+			EstimatedWaitMinutes: int(math.Ceil(max(load.Wait.Minutes(), 0))),
+		}
+	}
+	utils.RankShops(recs)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.RecommendResponse{
+		StagedID:        stagedID,
+		NumPages:        numPages,
+		Copies:          settings.Copies,
+		PrintMode:       settings.PrintMode,
+		ColorMode:       settings.ColorMode,
+		PaperSize:       settings.PaperSize,
+		Recommendations: recs,
+	})
+}
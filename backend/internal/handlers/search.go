@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/database"
+	"backend/internal/models"
+	"backend/internal/utils"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultSearchRadiusKm = 10
+	maxSearchRadiusKm     = 100
+	defaultSearchLimit    = 20
+	maxSearchLimit        = 100
+)
+
+// nearbyShop is a shopkeeper together with its distance from the search origin
+type nearbyShop struct {
+	ID          int     `json:"id"`
+	Username    string  `json:"username"`
+	DisplayName string  `json:"display_name"`
+	Distance    float64 `json:"distance"` // kilometres
+	Address     *string `json:"address,omitempty"`
+	Lat         float64 `json:"lat"`
+	Long        float64 `json:"long"`
+	models.ShopCapabilities
+	Open bool `json:"open"` // open right now
+}
+
+var errUserLocation = errors.New("user location not found")
+
+// shopSearch is a search for listed shops within a radius of a point
+type shopSearch struct {
+	Lat, Long float64
+	RadiusKm  float64
+	Limit     int
+	After     *shopCursor // continue after this shop
+
+	// Capability filters
+	Color     bool
+	Duplex    bool
+	PaperSize string
+	OpenOnly  bool
+}
+
+// shopCursor is the position of the last shop on a page of results.
+// Results are ordered by (distance, id), so the next page starts after it.
+type shopCursor struct {
+	Distance float64
+	ID       int
+}
+
+func (c shopCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString(
+		[]byte(strconv.FormatFloat(c.Distance, 'g', -1, 64) + ":" + strconv.Itoa(c.ID)))
+}
+
+func parseShopCursor(s string) (*shopCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	distance, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	var c shopCursor
+	if c.Distance, err = strconv.ParseFloat(distance, 64); err != nil {
+		return nil, err
+	}
+	if c.ID, err = strconv.Atoi(id); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// parseShopSearch reads a shop search from the query string: lat and long
+// (default: the caller's stored location), radius_km, limit, cursor, and the
+// color, duplex, paper_size and open filters
+func parseShopSearch(r *http.Request, userID int, defaultLimit int) (shopSearch, error) {
+	query := r.URL.Query()
+	search := shopSearch{
+		RadiusKm:  defaultSearchRadiusKm,
+		Limit:     defaultLimit,
+		Color:     query.Get("color") == "true",
+		Duplex:    query.Get("duplex") == "true",
+		PaperSize: query.Get("paper_size"),
+		OpenOnly:  query.Get("open") == "true",
+	}
+
+	if query.Get("lat") != "" || query.Get("long") != "" {
+		var err error
+		search.Lat, err = strconv.ParseFloat(query.Get("lat"), 64)
+		if err != nil || search.Lat < -90 || search.Lat > 90 {
+			return search, &invalidSearchError{reason: "invalid lat"}
+		}
+		search.Long, err = strconv.ParseFloat(query.Get("long"), 64)
+		if err != nil || search.Long < -180 || search.Long > 180 {
+			return search, &invalidSearchError{reason: "invalid long"}
+		}
+	} else {
+		var lat, long *float64
+		err := database.DB.QueryRow(context.Background(),
+			"SELECT lat, long FROM users WHERE id = $1", userID).Scan(&lat, &long)
+		if err != nil || lat == nil || long == nil {
+			return search, errUserLocation
+		}
+		search.Lat, search.Long = *lat, *long
+	}
+
+	if v := query.Get("radius_km"); v != "" {
+		radius, err := strconv.ParseFloat(v, 64)
+		if err != nil || radius <= 0 || radius > maxSearchRadiusKm {
+			return search, &invalidSearchError{reason: fmt.Sprintf("radius_km must be between 0 and %d", maxSearchRadiusKm)}
+		}
+		search.RadiusKm = radius
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return search, &invalidSearchError{reason: "invalid limit"}
+		}
+		search.Limit = min(limit, maxSearchLimit)
+	}
+
+	if v := query.Get("cursor"); v != "" {
+		cursor, err := parseShopCursor(v)
+		if err != nil {
+			return search, &invalidSearchError{reason: "invalid cursor"}
+		}
+		search.After = cursor
+	}
+	return search, nil
+}
+
+// invalidSearchError is returned by parseShopSearch for a malformed query string
+type invalidSearchError struct {
+	reason string
+}
+
+func (e *invalidSearchError) Error() string {
+	return e.reason
+}
+
+// writeSearchError reports a parseShopSearch or searchShops failure
+func writeSearchError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errUserLocation) {
+		http.Error(w, "User location not found", http.StatusNotFound)
+		return
+	}
+	var invalid *invalidSearchError
+	if errors.As(err, &invalid) {
+		http.Error(w, invalid.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, "Database error", http.StatusInternalServerError)
+}
+
+// distanceKm is the great-circle distance in kilometres from ($1, $2) to
+// shop u, by the haversine formula. LEAST guards asin against rounding
+// just above 1 for antipodal points.
+const distanceKm = `(2 * 6371 * asin(LEAST(1, sqrt(
+	power(sin(radians(u.lat - $1) / 2), 2) +
+	cos(radians($1)) * cos(radians(u.lat)) * power(sin(radians(u.long - $2) / 2), 2)))))`
+
+// shopOpenNow is the SQL form of utils.IsOpen for shop s: not on a holiday
+// and, if the shop publishes opening hours, inside one of them. Dates and
+// times are taken in the shop's timezone.
+const shopOpenNow = `NOT EXISTS (
+		SELECT 1 FROM shop_holidays h
+		WHERE h.shop_id = s.user_id AND h.day = (NOW() AT TIME ZONE s.timezone)::date)
+	AND (s.opening_hours IS NULL OR EXISTS (
+		SELECT 1 FROM jsonb_array_elements(s.opening_hours) oh
+		WHERE oh->>'day' = lower(to_char(NOW() AT TIME ZONE s.timezone, 'Dy'))
+		  AND oh->>'open' <= to_char(NOW() AT TIME ZONE s.timezone, 'HH24:MI')
+		  AND to_char(NOW() AT TIME ZONE s.timezone, 'HH24:MI') < oh->>'close'))`
+
+// query returns the SQL for a shop search and its arguments. The bounding
+// box test is answered by the GiST index on shop locations; exact distances
+// are only computed for shops inside the box.
+func (search shopSearch) query() (string, []any) {
+	minLat, minLong, maxLat, maxLong := utils.BoundingBox(search.Lat, search.Long, search.RadiusKm)
+	args := []any{search.Lat, search.Long, minLong, minLat, maxLong, maxLat}
+	conditions := []string{listedShop, "point(u.long, u.lat) <@ box(point($3, $4), point($5, $6))"}
+
+	if search.Color {
+		conditions = append(conditions, "s.color")
+	}
+	if search.Duplex {
+		conditions = append(conditions, "s.duplex")
+	}
+	if search.PaperSize != "" {
+		args = append(args, search.PaperSize)
+		conditions = append(conditions, fmt.Sprintf("$%d = ANY(s.paper_sizes)", len(args)))
+	}
+	if search.OpenOnly {
+		conditions = append(conditions, shopOpenNow)
+	}
+
+	args = append(args, search.RadiusKm)
+	outer := fmt.Sprintf("distance <= $%d", len(args))
+	if search.After != nil {
+		args = append(args, search.After.Distance, search.After.ID)
+		outer += fmt.Sprintf(" AND (distance, id) > ($%d, $%d)", len(args)-1, len(args))
+	}
+	args = append(args, search.Limit)
+
+	return `SELECT * FROM (
+		   SELECT ` + shopProfileColumns + `, u.username, u.lat, u.long, u.address, ` + distanceKm + ` AS distance
+		   FROM users u JOIN shops s ON s.user_id = u.id
+		   WHERE ` + strings.Join(conditions, " AND ") + `
+		 ) nearby
+		 WHERE ` + outer + `
+		 ORDER BY distance, id
+		 LIMIT $` + strconv.Itoa(len(args)), args
+}
+
+// searchShops returns listed shops within the search radius, nearest first,
+// and the cursor for the next page if there may be more
+func searchShops(ctx context.Context, search shopSearch) ([]nearbyShop, *shopCursor, error) {
+	query, args := search.query()
+	rows, err := database.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	shops := []nearbyShop{}
+	for rows.Next() {
+		var shop nearbyShop
+		profile, err := scanShopProfile(rows, &shop.Username, &shop.Lat, &shop.Long, &shop.Address, &shop.Distance)
+		if err != nil {
+			return nil, nil, err
+		}
+		shop.ID = profile.ShopID
+		shop.DisplayName = profile.DisplayName
+		shop.ShopCapabilities = profile.ShopCapabilities
+		shop.Open = profile.Open
+		shops = append(shops, shop)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var next *shopCursor
+	if len(shops) == search.Limit {
+		last := shops[len(shops)-1]
+		next = &shopCursor{Distance: last.Distance, ID: last.ID}
+	}
+	return shops, next, nil
+}
+
+// GetNearestShops lists shops within radius_km (default 10) of lat/long, or
+// of the caller's stored location, nearest first. Pages are linked with a
+// Link: <...>; rel="next" header.
+func GetNearestShops(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	search, err := parseShopSearch(r, claims.UserID, defaultSearchLimit)
+	if err != nil {
+		writeSearchError(w, err)
+		return
+	}
+
+	shops, next, err := searchShops(context.Background(), search)
+	if err != nil {
+		writeSearchError(w, err)
+		return
+	}
+
+	if next != nil {
+		nextURL := *r.URL
+		query := nextURL.Query()
+		query.Set("cursor", next.String())
+		nextURL.RawQuery = query.Encode()
+		w.Header().Set("Link", "<"+nextURL.RequestURI()+`>; rel="next"`)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shops)
+}
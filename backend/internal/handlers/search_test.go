@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"backend/internal/database"
+	"backend/internal/database/dbtest"
+)
+
+// Searches are made from the middle of the seeded area
+const searchLat, searchLong = 13.0, 77.5
+
+// seedShops inserts n listed shops spread over about 220 × 220 km around
+// the search origin, roughly one per square kilometre. Half print in color,
+// half duplex and a third take A3; the mix is the same on every run.
+func seedShops(tb testing.TB, n int) {
+	tb.Helper()
+	ctx := context.Background()
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "SELECT setseed(0.5)")
+	if err == nil {
+		_, err = tx.Exec(ctx,
+			`WITH seeded AS (
+			   INSERT INTO users (username, password_hash, role, lat, long, shop_status)
+			   SELECT 'shop' || i, 'x', 'shopkeeper',
+			     $2::FLOAT8 - 1 + 2 * random(), $3::FLOAT8 - 1 + 2 * random(), 'approved'
+			   FROM generate_series(1, $1) i
+			   RETURNING id)
+			 INSERT INTO shops (user_id, business_name, color, duplex, paper_sizes)
+			 SELECT id, 'Shop ' || id, random() < 0.5, random() < 0.5,
+			   CASE WHEN random() < 0.33 THEN '{A4,A3}'::TEXT[] ELSE '{A4}' END
+			 FROM seeded`, n, searchLat, searchLong)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err == nil {
+		_, err = database.DB.Exec(ctx, "ANALYZE users; ANALYZE shops")
+	}
+	if err != nil {
+		tb.Fatalf("seed shops: %v", err)
+	}
+}
+
+func TestShopSearchUsesLocationIndex(t *testing.T) {
+	dbtest.Setup(t)
+	seedShops(t, 20000)
+
+	searches := map[string]shopSearch{
+		"radius":  {Lat: searchLat, Long: searchLong, RadiusKm: 10, Limit: 20},
+		"filters": {Lat: searchLat, Long: searchLong, RadiusKm: 10, Limit: 20, Color: true, Duplex: true, PaperSize: "A3", OpenOnly: true},
+		"cursor":  {Lat: searchLat, Long: searchLong, RadiusKm: 10, Limit: 20, After: &shopCursor{Distance: 2.5, ID: 1}},
+	}
+	for name, search := range searches {
+		t.Run(name, func(t *testing.T) {
+			query, args := search.query()
+			rows, err := database.DB.Query(context.Background(), "EXPLAIN "+query, args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+			var plan []string
+			for rows.Next() {
+				var line string
+				if err := rows.Scan(&line); err != nil {
+					t.Fatal(err)
+				}
+				plan = append(plan, line)
+			}
+			if err := rows.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(strings.Join(plan, "\n"), "idx_users_shop_location") {
+				t.Errorf("search does not use idx_users_shop_location:\n%s", strings.Join(plan, "\n"))
+			}
+		})
+	}
+}
+
+func TestShopSearchPaging(t *testing.T) {
+	dbtest.Setup(t)
+	seedShops(t, 2000)
+	ctx := context.Background()
+
+	all, _, err := searchShops(ctx, shopSearch{Lat: searchLat, Long: searchLong, RadiusKm: 20, Limit: 2000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) == 0 {
+		t.Fatal("no shops within 20 km")
+	}
+
+	// Walking the pages returns the same shops in the same order
+	var paged []nearbyShop
+	search := shopSearch{Lat: searchLat, Long: searchLong, RadiusKm: 20, Limit: 7}
+	for {
+		page, next, err := searchShops(ctx, search)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paged = append(paged, page...)
+		if next == nil {
+			break
+		}
+		search.After = next
+	}
+	if len(paged) != len(all) {
+		t.Fatalf("%d shops over all pages, %d in one", len(paged), len(all))
+	}
+	for i := range all {
+		if paged[i].ID != all[i].ID {
+			t.Fatalf("shop %d is %d paged, %d in one page", i, paged[i].ID, all[i].ID)
+		}
+		if all[i].Distance > 20 || (i > 0 && all[i].Distance < all[i-1].Distance) {
+			t.Fatalf("shop %d at %.3f km is out of order", i, all[i].Distance)
+		}
+	}
+}
+
+// BenchmarkSearchShops measures shop search over 50,000 shops. Set
+// TEST_DATABASE_URL and run with -run '^$' -bench SearchShops.
+func BenchmarkSearchShops(b *testing.B) {
+	dbtest.Setup(b)
+	seedShops(b, 50000)
+	ctx := context.Background()
+
+	// The fifth page of a 10 km search
+	paging := shopSearch{Lat: searchLat, Long: searchLong, RadiusKm: 10, Limit: 20}
+	for range 4 {
+		_, next, err := searchShops(ctx, paging)
+		if err != nil || next == nil {
+			b.Fatalf("page through results: %v", err)
+		}
+		paging.After = next
+	}
+
+	benchmarks := []struct {
+		name   string
+		search shopSearch
+	}{
+		{"radius=2km", shopSearch{Lat: searchLat, Long: searchLong, RadiusKm: 2, Limit: 20}},
+		{"radius=10km", shopSearch{Lat: searchLat, Long: searchLong, RadiusKm: 10, Limit: 20}},
+		{"radius=100km", shopSearch{Lat: searchLat, Long: searchLong, RadiusKm: 100, Limit: 20}},
+		{"radius=10km/limit=100", shopSearch{Lat: searchLat, Long: searchLong, RadiusKm: 10, Limit: 100}},
+		{"radius=10km/page=5", paging},
+		{"radius=10km/color,duplex,A3", shopSearch{Lat: searchLat, Long: searchLong, RadiusKm: 10, Limit: 20,
+			Color: true, Duplex: true, PaperSize: "A3"}},
+		{"radius=10km/open", shopSearch{Lat: searchLat, Long: searchLong, RadiusKm: 10, Limit: 20, OpenOnly: true}},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			for b.Loop() {
+				if _, _, err := searchShops(ctx, bm.search); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/database"
+	"backend/internal/models"
+	"backend/internal/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// validateShopApplication checks the business details and location of a
+// shop registration and normalises them in place
+func validateShopApplication(details *models.ShopDetails, address string, lat, long *float64) error {
+	details.BusinessName = strings.TrimSpace(details.BusinessName)
+	details.ContactPhone = strings.TrimSpace(details.ContactPhone)
+	details.ContactEmail = strings.TrimSpace(details.ContactEmail)
+
+	if details.BusinessName == "" {
+		return fmt.Errorf("business_name is required")
+	}
+	if strings.TrimSpace(address) == "" {
+		return fmt.Errorf("address is required")
+	}
+	if lat == nil || long == nil || *lat < -90 || *lat > 90 || *long < -180 || *long > 180 {
+		return fmt.Errorf("a valid shop location (lat, long) is required")
+	}
+	if details.ContactPhone == "" {
+		return fmt.Errorf("contact_phone is required")
+	}
+	if details.ContactEmail != "" && !strings.Contains(details.ContactEmail, "@") {
+		return fmt.Errorf("invalid contact_email")
+	}
+
+	return utils.ValidateCapabilities(&details.ShopCapabilities)
+}
+
+// saveShopDetails stores a shop's business details and marks the application
+// as submitted for review
+func saveShopDetails(ctx context.Context, tx pgx.Tx, shopID int, details models.ShopDetails) error {
+	var email *string
+	if details.ContactEmail != "" {
+		email = &details.ContactEmail
+	}
+
+	_, err := tx.Exec(ctx,
+		`INSERT INTO shops (user_id, business_name, contact_phone, contact_email, color, duplex, paper_sizes)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 ON CONFLICT (user_id) DO UPDATE
+		 SET business_name = EXCLUDED.business_name, contact_phone = EXCLUDED.contact_phone,
+		     contact_email = EXCLUDED.contact_email, color = EXCLUDED.color, duplex = EXCLUDED.duplex,
+		     paper_sizes = EXCLUDED.paper_sizes, submitted_at = NOW(), reviewed_at = NULL, reviewed_by = NULL`,
+		shopID, details.BusinessName, details.ContactPhone, email, details.Color, details.Duplex, details.PaperSizes)
+	return err
+}
+
+const shopApplicationColumns = `u.id, u.username, s.business_name, s.contact_phone, s.contact_email, s.color, s.duplex,
+	s.paper_sizes, u.address, u.lat, u.long, u.shop_status, u.shop_rejection_reason, s.submitted_at, s.reviewed_at`
+
+const shopApplicationJoins = ` FROM users u JOIN shops s ON s.user_id = u.id`
+
+func scanShopApplication(row pgx.Row) (models.ShopApplication, error) {
+	var a models.ShopApplication
+	var email *string
+	err := row.Scan(&a.ShopID, &a.Username, &a.BusinessName, &a.ContactPhone, &email, &a.Color, &a.Duplex,
+		&a.PaperSizes, &a.Address, &a.Lat, &a.Long, &a.Status, &a.RejectionReason, &a.SubmittedAt, &a.ReviewedAt)
+	if email != nil {
+		a.ContactEmail = *email
+	}
+	return a, err
+}
+
+// GetShopApplication returns the calling shopkeeper's application and its review state
+func GetShopApplication(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	application, err := scanShopApplication(database.DB.QueryRow(context.Background(),
+		"SELECT "+shopApplicationColumns+shopApplicationJoins+" WHERE u.id = $1", claims.UserID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Shop application not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(application)
+}
+
+// ResubmitShopApplication updates a pending or rejected application and puts
+// it back in the review queue. Approved shops cannot change their application.
+func ResubmitShopApplication(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.ShopApplicationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateShopApplication(&req.ShopDetails, req.Address, req.Lat, req.Long); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var status string
+	err = tx.QueryRow(ctx,
+		"SELECT shop_status FROM users WHERE id = $1 FOR UPDATE", claims.UserID).Scan(&status)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if status == "approved" {
+		http.Error(w, "Shop is already approved", http.StatusConflict)
+		return
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE users SET address = $2, lat = $3, long = $4, shop_status = 'pending', shop_rejection_reason = NULL
+		 WHERE id = $1`,
+		claims.UserID, strings.TrimSpace(req.Address), req.Lat, req.Long)
+	if err == nil {
+		err = saveShopDetails(ctx, tx, claims.UserID, req.ShopDetails)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Application submitted", "status": "pending"})
+}
+
+// shopProfileColumns select a shop profile from users u joined with shops s.
+// Holidays before yesterday are left out; they cannot affect whether the
+// shop is open in any timezone.
+const shopProfileColumns = `u.id, COALESCE(s.display_name, s.business_name), s.color, s.duplex, s.paper_sizes,
+	s.timezone, s.opening_hours, COALESCE(s.upi_vpa, ''), COALESCE(s.gstin, ''),
+	ARRAY(SELECT h.day::text FROM shop_holidays h WHERE h.shop_id = u.id AND h.day >= CURRENT_DATE - 1 ORDER BY h.day),
+	ARRAY(SELECT COALESCE(h.note, '') FROM shop_holidays h WHERE h.shop_id = u.id AND h.day >= CURRENT_DATE - 1 ORDER BY h.day)`
+
+// scanShopProfile scans shopProfileColumns, followed by any extra columns
+// into extra, and works out whether the shop is open now
+func scanShopProfile(row pgx.Row, extra ...any) (models.ShopProfile, error) {
+	var p models.ShopProfile
+	var days, notes []string
+	dest := []any{&p.ShopID, &p.DisplayName, &p.Color, &p.Duplex, &p.PaperSizes,
+		&p.Timezone, &p.OpeningHours, &p.UPIVPA, &p.GSTIN, &days, &notes}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return p, err
+	}
+
+	if p.OpeningHours == nil {
+		p.OpeningHours = []models.OpeningHours{}
+	}
+	p.Holidays = []models.Holiday{}
+	for i, day := range days {
+		p.Holidays = append(p.Holidays, models.Holiday{Date: day, Note: notes[i]})
+	}
+	p.Open = utils.IsOpen(p.Timezone, p.OpeningHours, days, time.Now())
+	return p, nil
+}
+
+// writeShopProfile responds with the profile of one shop, limited to listed
+// shops unless the caller is the shop itself
+func writeShopProfile(w http.ResponseWriter, shopID int, listedOnly bool) {
+	query := "SELECT " + shopProfileColumns + " FROM users u JOIN shops s ON s.user_id = u.id WHERE u.id = $1"
+	if listedOnly {
+		query += " AND " + listedShop
+	}
+
+	profile, err := scanShopProfile(database.DB.QueryRow(context.Background(), query, shopID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Shop not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// GetMyShopProfile returns the calling shopkeeper's profile
+func GetMyShopProfile(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	writeShopProfile(w, claims.UserID, false)
+}
+
+// GetShopProfile returns the profile of any listed shop
+func GetShopProfile(w http.ResponseWriter, r *http.Request) {
+	shopID, err := strconv.Atoi(chi.URLParam(r, "shopId"))
+	if err != nil {
+		http.Error(w, "Invalid shop ID", http.StatusBadRequest)
+		return
+	}
+
+	writeShopProfile(w, shopID, true)
+}
+
+// UpdateShopProfile replaces the calling shopkeeper's profile, including the
+// whole holiday calendar. Jobs already in the queue are not re-checked
+// against the new capabilities.
+func UpdateShopProfile(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.ShopProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := utils.ValidateShopProfile(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var displayName *string
+	if req.DisplayName != "" {
+		displayName = &req.DisplayName
+	}
+	var upiVPA *string
+	if req.UPIVPA != "" {
+		upiVPA = &req.UPIVPA
+	}
+	var gstin *string
+	if req.GSTIN != "" {
+		gstin = &req.GSTIN
+	}
+	// No opening hours is stored as NULL, meaning always open
+	var openingHours any
+	if len(req.OpeningHours) > 0 {
+		openingHours = req.OpeningHours
+	}
+
+	ctx := context.Background()
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx,
+		`UPDATE shops SET display_name = $2, color = $3, duplex = $4, paper_sizes = $5,
+		 timezone = $6, opening_hours = $7, upi_vpa = $8, gstin = $9
+		 WHERE user_id = $1`,
+		claims.UserID, displayName, req.Color, req.Duplex, req.PaperSizes, req.Timezone, openingHours, upiVPA, gstin)
+	if err == nil && tag.RowsAffected() == 0 {
+		http.Error(w, "Shop application not found", http.StatusNotFound)
+		return
+	}
+
+	if err == nil {
+		_, err = tx.Exec(ctx, "DELETE FROM shop_holidays WHERE shop_id = $1", claims.UserID)
+	}
+	for _, holiday := range req.Holidays {
+		if err != nil {
+			break
+		}
+		var note *string
+		if holiday.Note != "" {
+			note = &holiday.Note
+		}
+		day, _ := time.Parse("2006-01-02", holiday.Date)
+		_, err = tx.Exec(ctx,
+			"INSERT INTO shop_holidays (shop_id, day, note) VALUES ($1, $2, $3)",
+			claims.UserID, day, note)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	writeShopProfile(w, claims.UserID, false)
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/database"
+	"backend/internal/events"
+	"backend/internal/jobs"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// streamHeartbeat keeps idle connections open through proxies
+const streamHeartbeat = 25 * time.Second
+
+// jobUpdate is the state of one customer job pushed over the event stream
+type jobUpdate struct {
+	FileID        int    `json:"file_id"`
+	Status        string `json:"status"`
+	ShopID        *int   `json:"shop_id,omitempty"`
+	QueuePosition *int   `json:"queue_position,omitempty"`
+	Paid          bool   `json:"paid"`
+
+	EstimatedStart      *time.Time `json:"estimated_start,omitempty"`
+	EstimatedCompletion *time.Time `json:"estimated_completion,omitempty"`
+}
+
+// etaTolerance is how far a job's estimated completion can move before the
+// customer is sent the new estimate
+const etaTolerance = time.Minute
+
+// loadCustomerJobs returns the customer's unfinished jobs, plus the jobs in
+// known so that a job leaving the active statuses is reported one last time
+func loadCustomerJobs(userID int, known map[int]jobUpdate) (map[int]jobUpdate, error) {
+	ids := make([]int, 0, len(known))
+	for id := range known {
+		ids = append(ids, id)
+	}
+
+	rows, err := database.DB.Query(context.Background(),
+		`SELECT f.id, f.status, f.shop_id, q.queue_position, f.paid_at IS NOT NULL
+		 FROM files f
+		 LEFT JOIN queue_positions q ON q.file_id = f.id
+		 WHERE f.user_id = $1 AND (f.status IN ('pending_payment', 'uploaded', 'queued', 'printing', 'printed') OR f.id = ANY($2))`,
+		userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	current := make(map[int]jobUpdate)
+	var queuedShops []int
+	for rows.Next() {
+		var job jobUpdate
+		if err := rows.Scan(&job.FileID, &job.Status, &job.ShopID, &job.QueuePosition, &job.Paid); err != nil {
+			return nil, err
+		}
+		current[job.FileID] = job
+		if job.QueuePosition != nil && !slices.Contains(queuedShops, *job.ShopID) {
+			queuedShops = append(queuedShops, *job.ShopID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	etas, err := jobs.LoadETAs(context.Background(), database.DB, queuedShops)
+	if err != nil {
+		return nil, err
+	}
+	for id, eta := range etas {
+		if job, ok := current[id]; ok {
+			job.EstimatedStart = &eta.Start
+			job.EstimatedCompletion = &eta.Completion
+			current[id] = job
+		}
+	}
+	return current, nil
+}
+
+func sameJobState(a, b jobUpdate) bool {
+	if a.Status != b.Status || a.Paid != b.Paid {
+		return false
+	}
+	if a.QueuePosition == nil || b.QueuePosition == nil {
+		return a.QueuePosition == nil && b.QueuePosition == nil
+	}
+	if *a.QueuePosition != *b.QueuePosition {
+		return false
+	}
+	if a.EstimatedCompletion == nil || b.EstimatedCompletion == nil {
+		return a.EstimatedCompletion == nil && b.EstimatedCompletion == nil
+	}
+	return a.EstimatedCompletion.Sub(*b.EstimatedCompletion).Abs() < etaTolerance
+}
+
+// StreamEvents pushes live updates over Server-Sent Events. Shopkeepers
+// receive their full queue whenever it changes; customers receive the
+// status, queue position and estimated print times of each of their jobs
+// whenever they change. Updates come from Postgres LISTEN/NOTIFY, so changes
+// made through any API instance reach clients connected to every instance.
+func StreamEvents(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Subscribe before loading the initial state so no change is missed
+	sub, unsubscribe := events.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	send := func(event string, data interface{}) {
+		payload, _ := json.Marshal(data)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+		flusher.Flush()
+	}
+
+	isShop := claims.Role == auth.RoleShopkeeper
+
+	var known map[int]jobUpdate
+	refresh := func() error {
+		if isShop {
+			queue, err := loadShopQueue(claims.UserID)
+			if err != nil {
+				return err
+			}
+			send("queue", map[string]interface{}{"queue": queue})
+			return nil
+		}
+
+		current, err := loadCustomerJobs(claims.UserID, known)
+		if err != nil {
+			return err
+		}
+		for id, job := range current {
+			if previous, ok := known[id]; !ok || !sameJobState(previous, job) {
+				send("job", job)
+			}
+		}
+		// Stop tracking jobs that have finished
+		for id, job := range current {
+			if job.Status != "pending_payment" && job.Status != "uploaded" && job.Status != "queued" && job.Status != "printing" && job.Status != "printed" {
+				delete(current, id)
+			}
+		}
+		known = current
+		return nil
+	}
+
+	// affects reports whether an event can change what this client sees
+	affects := func(ev events.Event) bool {
+		if ev.Type == events.Resync {
+			return true
+		}
+		if isShop {
+			return ev.ShopID != nil && *ev.ShopID == claims.UserID
+		}
+		if ev.UserID == claims.UserID {
+			return true
+		}
+		if ev.ShopID == nil {
+			return false
+		}
+		for _, job := range known {
+			if job.ShopID != nil && *job.ShopID == *ev.ShopID {
+				return true
+			}
+		}
+		return false
+	}
+
+	if err := refresh(); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case ev := <-sub:
+			if !affects(ev) {
+				continue
+			}
+			if err := refresh(); err != nil {
+				send("error", map[string]string{"message": "Database error"})
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"backend/internal/database"
+	"backend/internal/encryption"
+	"backend/internal/events"
+	"backend/internal/jobs"
+	"backend/internal/models"
+	"backend/internal/money"
+	"backend/internal/payments"
+	"backend/internal/storage"
+	"backend/internal/utils"
+	"backend/internal/wallet"
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// listedShop is the SQL condition on users for shops that customers can
+// find and send jobs to: approved, not suspended and not deleted
+const listedShop = `role = 'shopkeeper' AND shop_status = 'approved' AND suspended_at IS NULL AND deleted_at IS NULL`
+
+// newJob describes a submitted document that is ready to become a print job
+type newJob struct {
+	UserID    int
+	Name      string // original file name, kept in the storage key
+	Document  []byte
+	PrintType string // "private" or "queue"
+	Settings  printSettings
+	ShopID    *int   // target shop for queue jobs
+	Note      string // recorded in the job's status history
+
+	PaymentMethod string // "cash" (default), "wallet" or "online"
+}
+
+// Payment methods for a job
+const (
+	payCash   = "cash"   // paid at the shop counter
+	payWallet = "wallet" // paid from the customer's wallet on submission
+	payOnline = "online" // paid at the payment gateway before the job is queued
+)
+
+// jobRejectedError is returned by createJob when the job cannot be accepted
+// as requested, as opposed to a server failure
+type jobRejectedError struct {
+	reason string
+}
+
+func (e *jobRejectedError) Error() string {
+	return e.reason
+}
+
+// unreadablePDFError is returned when the pages of a document cannot be
+// counted. Such a document can be neither priced nor printed.
+type unreadablePDFError struct {
+	err error
+}
+
+func (e *unreadablePDFError) Error() string {
+	return e.err.Error()
+}
+
+func (e *unreadablePDFError) Unwrap() error {
+	return e.err
+}
+
+// countPages returns the number of pages of a PDF document
+func countPages(document []byte) (int, error) {
+	pages, err := utils.CountPDFPages(bytes.NewReader(document))
+	if err != nil {
+		return 0, &unreadablePDFError{err: err}
+	}
+	return pages, nil
+}
+
+// writeJobError reports a createJob failure, using 400 Bad Request for
+// rejected jobs, 422 Unprocessable Entity for documents that cannot be read,
+// 402 Payment Required when the wallet cannot pay and 502 Bad Gateway when
+// an online payment cannot be started
+func writeJobError(w http.ResponseWriter, err error) {
+	var unreadable *unreadablePDFError
+	if errors.As(err, &unreadable) {
+		http.Error(w, unreadable.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if errors.Is(err, wallet.ErrInsufficientFunds) {
+		http.Error(w, "Insufficient wallet balance", http.StatusPaymentRequired)
+		return
+	}
+	if errors.Is(err, errPaymentUnavailable) {
+		http.Error(w, "Payment gateway unavailable", http.StatusBadGateway)
+		return
+	}
+	var rejected *jobRejectedError
+	if errors.As(err, &rejected) {
+		http.Error(w, rejected.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, "Database error", http.StatusInternalServerError)
+}
+
+// createJob counts pages, prices the job, stores the document and inserts
+// its files row. Queue jobs take the next slot in the target shop's queue
+// and wallet jobs are paid for in the same transaction. Online jobs wait
+// outside the queue until the gateway reports their payment. Every way of
+// submitting a document (web upload, IPP) goes through here.
+func createJob(job newJob) (*models.UploadResponse, error) {
+	settings := job.Settings
+	switch {
+	case job.PrintType != "private" && job.PrintType != "queue":
+		return nil, &jobRejectedError{reason: "print_type must be private or queue"}
+	case job.PrintType == "queue" && job.ShopID == nil:
+		return nil, &jobRejectedError{reason: "shop_id is required for queue prints"}
+	case settings.Copies < 1 || settings.Copies > maxCopies:
+		return nil, &jobRejectedError{reason: errCopiesOutOfRange.Error()}
+	}
+	if job.PaymentMethod == "" {
+		job.PaymentMethod = payCash
+	}
+	switch job.PaymentMethod {
+	case payCash, payWallet:
+	case payOnline:
+		if job.ShopID == nil {
+			return nil, &jobRejectedError{reason: "online payment is only available for queue jobs"}
+		}
+		if payments.Gateway == nil {
+			return nil, &jobRejectedError{reason: "online payment is not available"}
+		}
+	default:
+		return nil, &jobRejectedError{reason: "payment_method must be cash, wallet or online"}
+	}
+
+	numPages, err := countPages(job.Document)
+	if err != nil {
+		return nil, err
+	}
+
+	// Generate unique code
+	uniqueCode := generateUniqueCode(6)
+
+	// Price the job from the target shop's card (default card for private prints)
+	card := utils.DefaultPriceCard()
+	if job.ShopID != nil {
+		var caps models.ShopCapabilities
+		err = database.DB.QueryRow(context.Background(),
+			"SELECT s.color, s.duplex, s.paper_sizes FROM users JOIN shops s ON s.user_id = users.id WHERE users.id = $1 AND "+listedShop,
+			*job.ShopID).Scan(&caps.Color, &caps.Duplex, &caps.PaperSizes)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, &jobRejectedError{reason: "shop is not accepting jobs"}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := utils.CanPrint(caps, settings.PaperSize, settings.ColorMode, settings.PrintMode); err != nil {
+			return nil, &jobRejectedError{reason: err.Error()}
+		}
+
+		card, err = loadPriceCard(*job.ShopID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	totalCost, err := utils.CalculateCost(card, numPages, settings.Copies, settings.PaperSize, settings.ColorMode, settings.PrintMode)
+	if err != nil {
+		return nil, &jobRejectedError{reason: err.Error()}
+	}
+
+	var priceCardVersion *int
+	if card.Version > 0 {
+		priceCardVersion = &card.Version
+	}
+
+	// Queue jobs enter the shop queue straight away; private jobs wait to be redeemed by code
+	status := jobs.Uploaded
+	if job.PaymentMethod == payOnline {
+		status = jobs.PendingPayment
+	} else if job.ShopID != nil {
+		status = jobs.Queued
+	}
+
+	// Documents are only ever stored encrypted
+	sealed, env, err := encryption.Keys.Seal(job.Document)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	storageKey := newStorageKey(job.Name)
+	if err := storage.Files.Put(ctx, storageKey, bytes.NewReader(sealed)); err != nil {
+		return nil, err
+	}
+
+	response, err := insertJob(ctx, job, storageKey, env, uniqueCode, status, numPages, totalCost, priceCardVersion)
+	if err != nil {
+		storage.Files.Delete(ctx, storageKey)
+		return nil, err
+	}
+
+	// The payment is started once the job exists, so a webhook can never
+	// arrive for a job that is not there yet
+	if status == jobs.PendingPayment {
+		response.Payment, err = startPayment(ctx, response.FileID, job.UserID, totalCost)
+		if err != nil {
+			abandonJob(ctx, response.FileID, job.UserID, storageKey)
+			return nil, err
+		}
+	}
+	return response, nil
+}
+
+// insertJob inserts the files row for a stored document, records its first
+// status and takes payment for wallet jobs
+func insertJob(ctx context.Context, job newJob, storageKey string, env *encryption.Envelope,
+	uniqueCode string, status jobs.Status, numPages int, totalCost money.Paise, priceCardVersion *int) (*models.UploadResponse, error) {
+	settings := job.Settings
+
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Reserve a slot in the shop queue
+	var queueSeq *int64
+	if status == jobs.Queued {
+		seq, err := jobs.Enqueue(ctx, tx, *job.ShopID)
+		if err != nil {
+			return nil, err
+		}
+		queueSeq = &seq
+	}
+
+	var fileID int
+	err = tx.QueryRow(ctx,
+		`INSERT INTO files (user_id, storage_key, unique_code, status, print_type, copies, print_mode, 
+		 color_mode, paper_size, num_pages, total_cost, shop_id, queue_seq, price_card_version, key_id, wrapped_key,
+		 payment_method) 
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17) RETURNING id`,
+		job.UserID, storageKey, uniqueCode, status, job.PrintType, settings.Copies, settings.PrintMode,
+		settings.ColorMode, settings.PaperSize, numPages, totalCost, job.ShopID, queueSeq, priceCardVersion,
+		env.KeyID, env.WrappedKey, job.PaymentMethod).Scan(&fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The wallet row lock serialises concurrent uploads by one customer, so
+	// each payment sees the balance left by the one before
+	if job.PaymentMethod == payWallet {
+		if err := wallet.PayForJob(ctx, tx, fileID, job.UserID, totalCost); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(ctx, "UPDATE files SET paid_at = NOW() WHERE id = $1", fileID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := jobs.Record(ctx, tx, fileID, status, job.UserID, job.Note); err != nil {
+		return nil, err
+	}
+
+	var queuePosition *int
+	if status == jobs.Queued {
+		if queuePosition, err = jobs.Position(ctx, tx, fileID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := events.Notify(ctx, tx, events.JobCreated, fileID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	response := &models.UploadResponse{
+		FileID:        fileID,
+		NumPages:      numPages,
+		TotalCost:     totalCost,
+		QueuePosition: queuePosition,
+		PaymentMethod: job.PaymentMethod,
+
+		PriceCardVersion: priceCardVersion,
+	}
+
+	if job.PrintType == "private" {
+		response.Code = uniqueCode
+	}
+	return response, nil
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"backend/internal/database"
+	"backend/internal/database/dbtest"
+)
+
+// upload posts a document with form fields to UploadFile as a customer
+func upload(customer int, document []byte, fields map[string]string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "notes.pdf")
+	part.Write(document)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	form.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	UploadFile(w, as(r, customer, "customer"))
+	return w
+}
+
+// TestUploadTarget checks that an upload names a print type and, for a
+// queue print, a shop. None of these reach the database.
+func TestUploadTarget(t *testing.T) {
+	tests := map[string]map[string]string{
+		"unknown print type":    {"print_type": "express"},
+		"queue without shop":    {"print_type": "queue"},
+		"queue with a bad shop": {"print_type": "queue", "shop_id": "two"},
+		"queue with wallet":     {"print_type": "queue", "shop_id": "", "payment_method": "wallet"},
+	}
+	for name, fields := range tests {
+		t.Run(name, func(t *testing.T) {
+			if w := upload(1, testPDF(t, 1), fields); w.Code != http.StatusBadRequest {
+				t.Errorf("%d %s, want 400", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestUploadToInactiveShop(t *testing.T) {
+	setup(t)
+	customer := dbtest.CreateUser(t, "customer")
+	suspended := dbtest.CreateShop(t, 12.97, 77.59)
+	if _, err := database.DB.Exec(context.Background(),
+		"UPDATE users SET suspended_at = NOW() WHERE id = $1", suspended); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, shopID := range map[string]int{"missing": suspended + 1000, "suspended": suspended, "customer": customer} {
+		t.Run(name, func(t *testing.T) {
+			w := upload(customer, testPDF(t, 1), map[string]string{
+				"print_type": "queue", "shop_id": strconv.Itoa(shopID), "payment_method": "wallet"})
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("%d %s, want 400", w.Code, w.Body)
+			}
+			if n := countRows(t, "SELECT COUNT(*) FROM files WHERE user_id = $1", customer); n != 0 {
+				t.Errorf("%d jobs created", n)
+			}
+		})
+	}
+}
+
+// TestUnreadablePDF checks that a document whose pages cannot be counted is
+// refused rather than priced as one page. None of these reach the database.
+func TestUnreadablePDF(t *testing.T) {
+	handlers := map[string]http.HandlerFunc{
+		"upload":    UploadFile,
+		"quote":     GetQuote,
+		"recommend": RecommendShops,
+	}
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			var body bytes.Buffer
+			form := multipart.NewWriter(&body)
+			part, _ := form.CreateFormFile("file", "notes.pdf")
+			part.Write([]byte("%PDF-1.7 this is not really a PDF"))
+			form.WriteField("copies", "1")
+			form.Close()
+
+			r := httptest.NewRequest(http.MethodPost, "/", &body)
+			r.Header.Set("Content-Type", form.FormDataContentType())
+			w := httptest.NewRecorder()
+			handler(w, as(r, 1, "customer"))
+
+			if w.Code != http.StatusUnprocessableEntity {
+				t.Errorf("%d %s, want 422", w.Code, w.Body)
+			}
+			if !bytes.Contains(w.Body.Bytes(), []byte("PDF")) {
+				t.Errorf("response %q does not give the parse error", w.Body)
+			}
+		})
+	}
+}
+
+// TestCopiesLimit checks that more copies than the IPP printers advertise
+// are refused before the document is priced
+func TestCopiesLimit(t *testing.T) {
+	handlers := map[string]http.HandlerFunc{
+		"upload":    UploadFile,
+		"quote":     GetQuote,
+		"recommend": RecommendShops,
+	}
+	for name, handler := range handlers {
+		for _, copies := range []string{"1000", "99999999999999999999"} {
+			t.Run(name+"/"+copies, func(t *testing.T) {
+				var body bytes.Buffer
+				form := multipart.NewWriter(&body)
+				part, _ := form.CreateFormFile("file", "notes.pdf")
+				part.Write(testPDF(t, 1))
+				form.WriteField("print_type", "private")
+				form.WriteField("copies", copies)
+				form.Close()
+
+				r := httptest.NewRequest(http.MethodPost, "/", &body)
+				r.Header.Set("Content-Type", form.FormDataContentType())
+				w := httptest.NewRecorder()
+				handler(w, as(r, 1, "customer"))
+
+				if w.Code != http.StatusBadRequest {
+					t.Errorf("%d %s, want 400", w.Code, w.Body)
+				}
+			})
+		}
+	}
+}
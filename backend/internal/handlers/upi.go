@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/database"
+	"backend/internal/events"
+	"backend/internal/jobs"
+	"backend/internal/models"
+	"backend/internal/qr"
+	"backend/internal/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// upiQRScale is the size of one QR code module in pixels
+const upiQRScale = 8
+
+// loadUPIRequest builds the UPI payment request for the job in the {id} URL
+// parameter. Only the job's customer and its shop may see it. It writes an
+// error response and returns ok=false if there is nothing to pay by UPI.
+func loadUPIRequest(w http.ResponseWriter, r *http.Request) (req models.UPIRequest, ok bool) {
+	fileID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return req, false
+	}
+
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return req, false
+	}
+
+	var userID int
+	var shopID *int
+	var status, paymentMethod string
+	var paidAt *time.Time
+	var vpa, payee *string
+	err = database.DB.QueryRow(context.Background(),
+		`SELECT f.user_id, f.shop_id, f.status, f.payment_method, f.paid_at, f.unique_code, f.total_cost,
+		 s.upi_vpa, COALESCE(s.display_name, s.business_name)
+		 FROM files f
+		 LEFT JOIN shops s ON s.user_id = f.shop_id
+		 WHERE f.id = $1`, fileID).Scan(&userID, &shopID, &status, &paymentMethod, &paidAt,
+		&req.Note, &req.Amount, &vpa, &payee)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return req, false
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return req, false
+	}
+
+	if userID != claims.UserID && (shopID == nil || *shopID != claims.UserID) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return req, false
+	}
+
+	// Only jobs paid at the shop are paid by UPI, and only while they can still be printed
+	switch {
+	case paidAt != nil || paymentMethod != payCash:
+		http.Error(w, "Job is already paid", http.StatusConflict)
+		return req, false
+	case status == string(jobs.Cancelled) || status == string(jobs.Expired):
+		http.Error(w, "Job is "+status, http.StatusConflict)
+		return req, false
+	case shopID == nil:
+		http.Error(w, "Job has not been taken by a shop yet", http.StatusConflict)
+		return req, false
+	case vpa == nil:
+		http.Error(w, "Shop does not accept UPI", http.StatusNotFound)
+		return req, false
+	}
+
+	req.FileID = fileID
+	req.VPA = *vpa
+	req.Payee = *payee
+	req.URI = utils.UPIPaymentURI(req.VPA, req.Payee, req.Amount, req.Note)
+	return req, true
+}
+
+// GetUPIRequest returns the UPI payment link for a job paid at the shop
+func GetUPIRequest(w http.ResponseWriter, r *http.Request) {
+	req, ok := loadUPIRequest(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(req)
+}
+
+// GetUPIQRCode returns the UPI payment link for a job as a QR code PNG, for
+// the customer to scan with any UPI app
+func GetUPIQRCode(w http.ResponseWriter, r *http.Request) {
+	req, ok := loadUPIRequest(w, r)
+	if !ok {
+		return
+	}
+
+	code, err := qr.Encode(req.URI)
+	if err != nil {
+		http.Error(w, "Payment link too long", http.StatusInternalServerError)
+		return
+	}
+	img, err := code.PNG(upiQRScale)
+	if err != nil {
+		http.Error(w, "Could not render QR code", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(img)
+}
+
+// MarkQueuePaid records that the customer paid the shop for a job, by UPI
+// or in cash. The money never passes through the app, so only paid_at changes.
+func MarkQueuePaid(w http.ResponseWriter, r *http.Request) {
+	fileID, _, ok := shopJobFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var status, paymentMethod string
+	var paidAt *time.Time
+	err = tx.QueryRow(ctx,
+		"SELECT status, payment_method, paid_at FROM files WHERE id = $1 FOR UPDATE", fileID).Scan(&status, &paymentMethod, &paidAt)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if paidAt != nil || paymentMethod != payCash {
+		http.Error(w, "Job is already paid", http.StatusConflict)
+		return
+	}
+	if status == string(jobs.Cancelled) || status == string(jobs.Expired) {
+		http.Error(w, "Job is "+status, http.StatusConflict)
+		return
+	}
+
+	err = tx.QueryRow(ctx, "UPDATE files SET paid_at = NOW() WHERE id = $1 RETURNING paid_at", fileID).Scan(&paidAt)
+	if err == nil {
+		err = events.Notify(ctx, tx, events.JobUpdated, fileID)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Job marked paid", "paid_at": paidAt})
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/database"
+	"backend/internal/models"
+	"backend/internal/money"
+	"backend/internal/wallet"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	defaultWalletEntries = 50
+	maxWalletEntries     = 200
+
+	// maxTopUp is the most that can be added to a wallet at once
+	maxTopUp = 10000 * money.Rupee
+)
+
+// GetWallet returns the caller's wallet balance and statement, newest entry
+// first. Page back with limit and before (an entry ID). The balance and the
+// entries are read from one snapshot, so they always agree.
+func GetWallet(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(auth.UserKey).(*auth.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := defaultWalletEntries
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxWalletEntries)
+	}
+	var before *int64
+	if v := query.Get("before"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid before", http.StatusBadRequest)
+			return
+		}
+		before = &n
+	}
+
+	ctx := context.Background()
+	tx, err := database.DB.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// A user without an account yet has an empty wallet
+	result := models.Wallet{Entries: []models.WalletEntry{}}
+	err = tx.QueryRow(ctx,
+		"SELECT COALESCE((SELECT balance FROM wallet_accounts WHERE user_id = $1), 0)",
+		claims.UserID).Scan(&result.Balance)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := tx.Query(ctx,
+		`SELECT e.id, t.id, t.kind, e.amount, e.balance_after, t.file_id, t.memo, t.created_at
+		 FROM ledger_entries e
+		 JOIN ledger_transactions t ON t.id = e.transaction_id
+		 JOIN wallet_accounts a ON a.id = e.account_id
+		 WHERE a.user_id = $1 AND ($2::bigint IS NULL OR e.id < $2)
+		 ORDER BY e.id DESC
+		 LIMIT $3`, claims.UserID, before, limit)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.WalletEntry
+		if err := rows.Scan(&e.ID, &e.TransactionID, &e.Kind, &e.Amount, &e.BalanceAfter,
+			&e.FileID, &e.Memo, &e.CreatedAt); err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		result.Entries = append(result.Entries, e)
+	}
+	if rows.Err() != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if len(result.Entries) == limit {
+		result.NextBefore = &result.Entries[limit-1].ID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// TopUpWallet adds money a customer paid outside the app, such as cash at a
+// counter, to their wallet
+func TopUpWallet(w http.ResponseWriter, r *http.Request) {
+	userID, claims, ok := adminTarget(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.TopUpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Amounts with more than two decimal places are already rejected when decoding
+	amount := req.Amount
+	if amount <= 0 || amount > maxTopUp {
+		http.Error(w, "amount must be between 0.01 and 10000", http.StatusBadRequest)
+		return
+	}
+	note := strings.TrimSpace(req.Note)
+	if note == "" {
+		note = "top-up by admin"
+	}
+
+	ctx := context.Background()
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var role string
+	err = tx.QueryRow(ctx,
+		"SELECT role FROM users WHERE id = $1 AND deleted_at IS NULL", userID).Scan(&role)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if role != auth.RoleCustomer {
+		http.Error(w, "Only customer wallets can be topped up", http.StatusBadRequest)
+		return
+	}
+
+	err = wallet.AddFunds(ctx, tx, userID, amount, note, claims.UserID)
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Wallet topped up", "amount": amount})
+}
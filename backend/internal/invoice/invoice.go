@@ -0,0 +1,123 @@
+// Package invoice builds GST invoices for printed jobs and renders them as
+// PDF. Prices on a price card include GST, so an invoice never changes what
+// the customer paid: it splits each charge into its taxable value and tax.
+// CGST and SGST are each half the rate on the taxable value, rounded to the
+// nearest paisa, and the taxable value is what remains of the charge, so
+// the two taxes are always equal and the invoice adds up to what was paid.
+// Shops serve customers in person, so every supply is within the shop's own
+// state.
+package invoice
+
+import (
+	"context"
+	"fmt"
+
+	"backend/internal/models"
+	"backend/internal/money"
+	"backend/internal/utils"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SAC is the services accounting code for printing services
+const SAC = "998912"
+
+// Job is what an invoice needs to know about a job
+type Job struct {
+	Pages     int
+	Copies    int
+	PaperSize string
+	ColorMode string
+	PrintMode string
+	TotalCost money.Paise
+}
+
+// NextNumber takes the next invoice number of a shop. The per-shop counter
+// row stays locked until tx ends, so a number is only used up if the
+// invoice that took it is stored and numbers run without gaps.
+func NextNumber(ctx context.Context, tx pgx.Tx, shopID int) (int64, error) {
+	var number int64
+	err := tx.QueryRow(ctx,
+		`INSERT INTO shop_invoice_counters (shop_id, next_number) VALUES ($1, 1)
+		 ON CONFLICT (shop_id) DO UPDATE SET next_number = shop_invoice_counters.next_number + 1
+		 RETURNING next_number`, shopID).Scan(&number)
+	return number, err
+}
+
+// FormatNumber returns the printed form of an invoice number, e.g. "INV-000042"
+func FormatNumber(number int64) string {
+	return fmt.Sprintf("INV-%06d", number)
+}
+
+// Lines itemises the cost of a job from the price card that priced it: the
+// pages, the per-job fee and any top-up to the minimum order. If the card no
+// longer explains the cost exactly, the job is invoiced as a single line.
+func Lines(card *models.PriceCard, job Job) []models.InvoiceLine {
+	pages := job.Pages * job.Copies
+	printing := models.InvoiceLine{
+		Description: describe(job),
+		SAC:         SAC,
+		Quantity:    pages,
+	}
+
+	rate, ok := utils.FindRate(card, job.PaperSize, job.ColorMode, job.PrintMode)
+	if !ok {
+		printing.Amount = job.TotalCost
+		return []models.InvoiceLine{printing}
+	}
+	printing.Rate = rate
+	printing.Amount = money.Paise(pages) * rate
+
+	lines := []models.InvoiceLine{printing}
+	sum := printing.Amount
+	if card.PerJobFee > 0 {
+		lines = append(lines, models.InvoiceLine{
+			Description: "Per-job fee", SAC: SAC, Quantity: 1, Rate: card.PerJobFee, Amount: card.PerJobFee,
+		})
+		sum += card.PerJobFee
+	}
+	if sum < job.TotalCost && job.TotalCost == card.MinOrder {
+		lines = append(lines, models.InvoiceLine{
+			Description: "Minimum order top-up", SAC: SAC, Quantity: 1, Amount: job.TotalCost - sum,
+		})
+		sum = job.TotalCost
+	}
+
+	if sum != job.TotalCost {
+		printing.Rate = 0
+		printing.Amount = job.TotalCost
+		return []models.InvoiceLine{printing}
+	}
+	return lines
+}
+
+// describe names the printing service, e.g. "Printing, A4, colour, double-sided"
+func describe(job Job) string {
+	color := "B&W"
+	if job.ColorMode == "color" {
+		color = "colour"
+	}
+	sides := "single-sided"
+	if job.PrintMode == "double" {
+		sides = "double-sided"
+	}
+	return fmt.Sprintf("Printing, %s, %s, %s", job.PaperSize, color, sides)
+}
+
+// ApplyTax works out the taxable value of each line and the invoice's tax
+// totals at inv.GSTRate. CGST and SGST are equal and, with the taxable
+// value, add up to the total exactly.
+func ApplyTax(inv *models.Invoice) {
+	inv.Total, inv.TaxableValue, inv.CGST = 0, 0, 0
+	for i := range inv.Lines {
+		line := &inv.Lines[i]
+		// Half the rate on the taxable value Amount × 100 / (100 + rate),
+		// rounded once
+		half := line.Amount.MulRatio(int64(inv.GSTRate), int64(200+2*inv.GSTRate))
+		line.TaxableValue = line.Amount - 2*half
+		inv.Total += line.Amount
+		inv.TaxableValue += line.TaxableValue
+		inv.CGST += half
+	}
+	inv.SGST = inv.CGST
+}
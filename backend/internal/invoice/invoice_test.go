@@ -0,0 +1,50 @@
+package invoice
+
+import (
+	"testing"
+
+	"backend/internal/models"
+	"backend/internal/money"
+)
+
+func TestApplyTax(t *testing.T) {
+	tests := []struct {
+		rate          int
+		amounts       []money.Paise
+		taxable, cgst money.Paise
+	}{
+		{0, []money.Paise{2400}, 2400, 0},
+		{18, []money.Paise{11800}, 10000, 900},
+		{18, []money.Paise{100}, 84, 8}, // 84.75 taxable: 7.63 per head rounds to 8
+		{5, []money.Paise{1001, 500}, 1429, 36},
+	}
+	for _, tt := range tests {
+		inv := models.Invoice{GSTRate: tt.rate}
+		for _, amount := range tt.amounts {
+			inv.Lines = append(inv.Lines, models.InvoiceLine{Amount: amount})
+		}
+		ApplyTax(&inv)
+		if inv.TaxableValue != tt.taxable || inv.CGST != tt.cgst || inv.SGST != tt.cgst {
+			t.Errorf("%d%% of %v: taxable %d, CGST %d, SGST %d; want %d, %d, %d",
+				tt.rate, tt.amounts, inv.TaxableValue, inv.CGST, inv.SGST, tt.taxable, tt.cgst, tt.cgst)
+		}
+	}
+}
+
+// Every total is invoiced exactly, with equal CGST and SGST close to half
+// the rate on the taxable value
+func TestApplyTaxAddsUp(t *testing.T) {
+	for _, rate := range []int{0, 5, 12, 18, 28, 40} {
+		for total := money.Paise(1); total <= 20000; total++ {
+			inv := models.Invoice{GSTRate: rate, Lines: []models.InvoiceLine{{Amount: total}}}
+			ApplyTax(&inv)
+			if inv.CGST != inv.SGST || inv.TaxableValue+inv.CGST+inv.SGST != total || inv.Total != total {
+				t.Fatalf("%d%% of %d: taxable %d + CGST %d + SGST %d, total %d",
+					rate, total, inv.TaxableValue, inv.CGST, inv.SGST, inv.Total)
+			}
+			if diff := 2*inv.CGST - inv.TaxableValue.MulRatio(int64(rate), 100); diff < -2 || diff > 2 {
+				t.Fatalf("%d%% of %d: taxable %d has tax %d", rate, total, inv.TaxableValue, 2*inv.CGST)
+			}
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package invoice
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"backend/internal/models"
+	"backend/internal/money"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+// Page layout in points on A4 portrait, measured from the top left corner
+const (
+	marginX    = 40
+	pageWidth  = 515 // between the margins
+	lineHeight = 18  // table rows
+)
+
+// The parts of pdfcpu's JSON page description an invoice uses
+
+type pdfFont struct {
+	Name string `json:"name"`
+	Size int    `json:"size"`
+}
+
+type pdfText struct {
+	Value string     `json:"value"`
+	Pos   [2]float64 `json:"pos"`
+	Font  pdfFont    `json:"font"`
+}
+
+type pdfTableHeader struct {
+	Values     []string `json:"values"`
+	ColAnchors []string `json:"colAnchors"`
+	Font       pdfFont  `json:"font"`
+	BgCol      string   `json:"bgCol"`
+}
+
+type pdfTable struct {
+	Values     [][]string      `json:"values"`
+	Rows       int             `json:"rows"`
+	Cols       int             `json:"cols"`
+	Width      float64         `json:"width"`
+	ColWidths  []int           `json:"colWidths"` // percent of Width
+	ColAnchors []string        `json:"colAnchors"`
+	Header     *pdfTableHeader `json:"header,omitempty"`
+	Font       pdfFont         `json:"font"`
+	LHeight    int             `json:"lheight"`
+	Grid       bool            `json:"grid"`
+	Pos        [2]float64      `json:"pos"` // bottom left corner
+}
+
+var (
+	regular = pdfFont{Name: "Helvetica", Size: 10}
+	bold    = pdfFont{Name: "Helvetica-Bold", Size: 10}
+)
+
+// escape keeps pdfcpu from reading "%" in a value as a page number or
+// timestamp placeholder
+func escape(s string) string {
+	return strings.ReplaceAll(s, "%", "%%")
+}
+
+// rupees formats an amount for the PDF. The standard PDF fonts have no rupee sign.
+func rupees(p money.Paise) string {
+	if p < 0 {
+		return "-Rs. " + (-p).String()
+	}
+	return "Rs. " + p.String()
+}
+
+// halfRate formats half a GST rate, the CGST and SGST rates, e.g. "9" or "2.5"
+func halfRate(rate int) string {
+	if rate%2 == 0 {
+		return strconv.Itoa(rate / 2)
+	}
+	return fmt.Sprintf("%d.5", rate/2)
+}
+
+// table lays out rows below top with the given column widths and anchors
+func table(top float64, header []string, rows [][]string, widths []int, anchors []string) pdfTable {
+	t := pdfTable{
+		Values:     rows,
+		Rows:       len(rows),
+		Cols:       len(widths),
+		Width:      pageWidth,
+		ColWidths:  widths,
+		ColAnchors: anchors,
+		Font:       regular,
+		LHeight:    lineHeight,
+		Grid:       true,
+	}
+	height := len(rows) * lineHeight
+	if header != nil {
+		t.Header = &pdfTableHeader{Values: header, ColAnchors: anchors, Font: bold, BgCol: "#EEEEEE"}
+		height += lineHeight
+	}
+	t.Pos = [2]float64{marginX, top + float64(height)}
+	return t
+}
+
+// taxed reports whether the invoice charges GST, as opposed to being a bill of supply
+func taxed(inv *models.Invoice) bool {
+	return inv.SellerGSTIN != "" && inv.GSTRate > 0
+}
+
+// Render renders an invoice as a one page A4 PDF
+func Render(inv *models.Invoice) ([]byte, error) {
+	title := "BILL OF SUPPLY"
+	if taxed(inv) {
+		title = "TAX INVOICE"
+	}
+
+	buyer := []string{escape(inv.BuyerName)}
+	if inv.BuyerGSTIN != "" {
+		buyer = append(buyer, "GSTIN: "+inv.BuyerGSTIN)
+	}
+	seller := []string{escape(inv.SellerName)}
+	if inv.SellerAddress != "" {
+		seller = append(seller, escape(inv.SellerAddress))
+	}
+	if inv.SellerGSTIN != "" {
+		seller = append(seller, "GSTIN: "+inv.SellerGSTIN, "State code: "+inv.SellerGSTIN[:2])
+	}
+
+	texts := []pdfText{
+		{Value: title, Pos: [2]float64{marginX, 60}, Font: pdfFont{Name: "Helvetica-Bold", Size: 18}},
+		{Value: fmt.Sprintf("Invoice no.: %s\nDate: %s\nJob: #%d", inv.Number, inv.IssuedAt.Format("02 Jan 2006"), inv.FileID),
+			Pos: [2]float64{380, 50}, Font: regular},
+		{Value: "From", Pos: [2]float64{marginX, 110}, Font: bold},
+		{Value: strings.Join(seller, "\n"), Pos: [2]float64{marginX, 125}, Font: regular},
+		{Value: "Billed to", Pos: [2]float64{320, 110}, Font: bold},
+		{Value: strings.Join(buyer, "\n"), Pos: [2]float64{320, 125}, Font: regular},
+	}
+
+	// Charges
+	header := []string{"#", "Description", "SAC", "Qty", "Rate", "Amount"}
+	widths := []int{5, 45, 13, 9, 13, 15}
+	anchors := []string{"Center", "Left", "Center", "Right", "Right", "Right"}
+	if taxed(inv) {
+		header = []string{"#", "Description", "SAC", "Qty", "Rate", "Taxable value", "Amount"}
+		widths = []int{4, 40, 10, 6, 12, 14, 14}
+		anchors = []string{"Center", "Left", "Center", "Right", "Right", "Right", "Right"}
+	}
+	var rows [][]string
+	for i, line := range inv.Lines {
+		rate := ""
+		if line.Rate > 0 {
+			rate = rupees(line.Rate)
+		}
+		row := []string{strconv.Itoa(i + 1), line.Description, line.SAC, strconv.Itoa(line.Quantity), rate}
+		if taxed(inv) {
+			row = append(row, rupees(line.TaxableValue))
+		}
+		rows = append(rows, append(row, rupees(line.Amount)))
+	}
+	top := 210.0
+	charges := table(top, header, rows, widths, anchors)
+	top = charges.Pos[1] + 20
+
+	// Totals
+	var totals [][]string
+	if taxed(inv) {
+		totals = [][]string{
+			{"Taxable value", rupees(inv.TaxableValue)},
+			{"CGST @ " + halfRate(inv.GSTRate) + "%%", rupees(inv.CGST)},
+			{"SGST @ " + halfRate(inv.GSTRate) + "%%", rupees(inv.SGST)},
+		}
+	}
+	totals = append(totals, []string{"Total", rupees(inv.Total)})
+	summary := table(top, nil, totals, []int{70, 30}, []string{"Right", "Right"})
+	top = summary.Pos[1] + 30
+
+	note := "Supplier is not registered for GST. No tax is charged."
+	if taxed(inv) {
+		note = "Prices include GST. Place of supply: state code " + inv.SellerGSTIN[:2] + "."
+	} else if inv.SellerGSTIN != "" {
+		note = "No GST is charged on this supply."
+	}
+	texts = append(texts,
+		pdfText{Value: note + "\nThis is a computer-generated invoice and needs no signature.",
+			Pos: [2]float64{marginX, top}, Font: regular},
+		pdfText{Value: "For " + escape(inv.SellerName), Pos: [2]float64{380, top + 40}, Font: bold},
+	)
+
+	doc := map[string]any{
+		"paper":  "A4P",
+		"origin": "UpperLeft",
+		"pages": map[string]any{
+			"1": map[string]any{
+				"content": map[string]any{
+					"text":  texts,
+					"table": []pdfTable{charges, summary},
+				},
+			},
+		},
+	}
+	desc, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := api.Create(nil, bytes.NewReader(desc), &buf, nil); err != nil {
+		return nil, fmt.Errorf("render invoice %s: %w", inv.Number, err)
+	}
+	return buf.Bytes(), nil
+}
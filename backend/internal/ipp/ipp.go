@@ -0,0 +1,375 @@
+// Package ipp encodes and decodes Internet Printing Protocol messages
+// (RFC 8010) as used by the print agent and the IPP ingestion server.
+package ipp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Operation IDs
+const (
+	OpPrintJob             uint16 = 0x0002
+	OpValidateJob          uint16 = 0x0004
+	OpCancelJob            uint16 = 0x0008
+	OpGetJobAttributes     uint16 = 0x0009
+	OpGetJobs              uint16 = 0x000A
+	OpGetPrinterAttributes uint16 = 0x000B
+)
+
+// Status codes
+const (
+	StatusOK                        uint16 = 0x0000
+	StatusBadRequest                uint16 = 0x0400
+	StatusForbidden                 uint16 = 0x0401
+	StatusNotAuthenticated          uint16 = 0x0402
+	StatusNotPossible               uint16 = 0x0404
+	StatusNotFound                  uint16 = 0x0406
+	StatusRequestEntityTooLarge     uint16 = 0x0409
+	StatusDocumentFormatUnsupported uint16 = 0x040A
+	StatusAttributesNotSupported    uint16 = 0x040B
+	StatusDocumentFormatError       uint16 = 0x0411
+	StatusInternalError             uint16 = 0x0500
+	StatusOperationNotSupported     uint16 = 0x0501
+	StatusVersionNotSupported       uint16 = 0x0503
+)
+
+// Delimiter tags
+const (
+	TagOperation   byte = 0x01
+	TagJob         byte = 0x02
+	TagEnd         byte = 0x03
+	TagPrinter     byte = 0x04
+	TagUnsupported byte = 0x05
+)
+
+// Value tags
+const (
+	TagUnsupportedValue byte = 0x10
+	TagUnknown          byte = 0x12
+	TagNoValue          byte = 0x13
+	TagInteger          byte = 0x21
+	TagBoolean          byte = 0x22
+	TagEnum             byte = 0x23
+	TagOctetString      byte = 0x30
+	TagDateTime         byte = 0x31
+	TagResolution       byte = 0x32
+	TagRange            byte = 0x33
+	TagText             byte = 0x41
+	TagName             byte = 0x42
+	TagKeyword          byte = 0x44
+	TagURI              byte = 0x45
+	TagURIScheme        byte = 0x46
+	TagCharset          byte = 0x47
+	TagLanguage         byte = 0x48
+	TagMimeType         byte = 0x49
+)
+
+// Job states reported in the job-state attribute
+const (
+	JobPending           = 3
+	JobPendingHeld       = 4
+	JobProcessing        = 5
+	JobProcessingStopped = 6
+	JobCanceled          = 7
+	JobAborted           = 8
+	JobCompleted         = 9
+)
+
+// Value is one encoded attribute value
+type Value struct {
+	Tag  byte
+	Data []byte
+}
+
+// Attribute is a named attribute with one or more values
+type Attribute struct {
+	Name   string
+	Values []Value
+}
+
+// Group is an attribute group such as the operation or job attributes
+type Group struct {
+	Tag        byte
+	Attributes []Attribute
+}
+
+// Message is an IPP request or response. Code holds the operation ID for
+// requests and the status code for responses.
+type Message struct {
+	Major     byte
+	Minor     byte
+	Code      uint16
+	RequestID uint32
+	Groups    []Group
+}
+
+// NewRequest creates a request with the mandatory charset and language attributes
+func NewRequest(op uint16, requestID uint32) *Message {
+	m := &Message{Major: 2, Minor: 0, Code: op, RequestID: requestID}
+	m.Add(TagOperation, Charset("attributes-charset", "utf-8"), Language("attributes-natural-language", "en"))
+	return m
+}
+
+// NewResponse creates a response to req with the mandatory charset and language attributes
+func NewResponse(req *Message, status uint16) *Message {
+	m := NewRequest(status, req.RequestID)
+	m.Major, m.Minor = req.Major, req.Minor
+	return m
+}
+
+// Add appends attributes to the last group with the given tag, creating it if needed
+func (m *Message) Add(tag byte, attrs ...Attribute) {
+	if n := len(m.Groups); n > 0 && m.Groups[n-1].Tag == tag {
+		m.Groups[n-1].Attributes = append(m.Groups[n-1].Attributes, attrs...)
+		return
+	}
+	m.Groups = append(m.Groups, Group{Tag: tag, Attributes: attrs})
+}
+
+// Find returns the first attribute with the given name in a group with the given tag
+func (m *Message) Find(tag byte, name string) (Attribute, bool) {
+	for _, g := range m.Groups {
+		if g.Tag != tag {
+			continue
+		}
+		for _, a := range g.Attributes {
+			if a.Name == name {
+				return a, true
+			}
+		}
+	}
+	return Attribute{}, false
+}
+
+// String returns the first value of an attribute as a string, or "" if it is absent
+func (m *Message) String(tag byte, name string) string {
+	a, ok := m.Find(tag, name)
+	if !ok || len(a.Values) == 0 {
+		return ""
+	}
+	return string(a.Values[0].Data)
+}
+
+// Int returns the first value of an integer or enum attribute
+func (m *Message) Int(tag byte, name string) (int, bool) {
+	a, ok := m.Find(tag, name)
+	if !ok || len(a.Values) == 0 || len(a.Values[0].Data) != 4 {
+		return 0, false
+	}
+	return int(int32(binary.BigEndian.Uint32(a.Values[0].Data))), true
+}
+
+// Strings returns all values of an attribute as strings
+func (m *Message) Strings(tag byte, name string) []string {
+	a, _ := m.Find(tag, name)
+	var out []string
+	for _, v := range a.Values {
+		out = append(out, string(v.Data))
+	}
+	return out
+}
+
+func stringAttr(tag byte, name string, values []string) Attribute {
+	a := Attribute{Name: name}
+	for _, v := range values {
+		a.Values = append(a.Values, Value{Tag: tag, Data: []byte(v)})
+	}
+	return a
+}
+
+func intAttr(tag byte, name string, values []int) Attribute {
+	a := Attribute{Name: name}
+	for _, v := range values {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, uint32(int32(v)))
+		a.Values = append(a.Values, Value{Tag: tag, Data: b})
+	}
+	return a
+}
+
+// Keyword builds a keyword attribute
+func Keyword(name string, values ...string) Attribute { return stringAttr(TagKeyword, name, values) }
+
+// Text builds a textWithoutLanguage attribute
+func Text(name string, values ...string) Attribute { return stringAttr(TagText, name, values) }
+
+// Name builds a nameWithoutLanguage attribute
+func Name(name string, values ...string) Attribute { return stringAttr(TagName, name, values) }
+
+// URI builds a uri attribute
+func URI(name string, values ...string) Attribute { return stringAttr(TagURI, name, values) }
+
+// MimeType builds a mimeMediaType attribute
+func MimeType(name string, values ...string) Attribute { return stringAttr(TagMimeType, name, values) }
+
+// Integer builds an integer attribute
+func Integer(name string, values ...int) Attribute { return intAttr(TagInteger, name, values) }
+
+// Enum builds an enum attribute
+func Enum(name string, values ...int) Attribute { return intAttr(TagEnum, name, values) }
+
+// Range builds a rangeOfInteger attribute
+func Range(name string, lower, upper int) Attribute {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint32(b[:4], uint32(int32(lower)))
+	binary.BigEndian.PutUint32(b[4:], uint32(int32(upper)))
+	return Attribute{Name: name, Values: []Value{{Tag: TagRange, Data: b}}}
+}
+
+// Charset builds a charset attribute
+func Charset(name string, values ...string) Attribute { return stringAttr(TagCharset, name, values) }
+
+// Language builds a naturalLanguage attribute
+func Language(name string, values ...string) Attribute { return stringAttr(TagLanguage, name, values) }
+
+// Boolean builds a boolean attribute
+func Boolean(name string, value bool) Attribute {
+	b := byte(0)
+	if value {
+		b = 1
+	}
+	return Attribute{Name: name, Values: []Value{{Tag: TagBoolean, Data: []byte{b}}}}
+}
+
+// Encode writes the message. Document data, if any, follows it directly.
+func (m *Message) Encode(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.Write([]byte{m.Major, m.Minor})
+	binary.Write(bw, binary.BigEndian, m.Code)
+	binary.Write(bw, binary.BigEndian, m.RequestID)
+
+	for _, g := range m.Groups {
+		bw.WriteByte(g.Tag)
+		for _, a := range g.Attributes {
+			for i, v := range a.Values {
+				name := a.Name
+				if i > 0 {
+					name = ""
+				}
+				bw.WriteByte(v.Tag)
+				binary.Write(bw, binary.BigEndian, uint16(len(name)))
+				bw.WriteString(name)
+				binary.Write(bw, binary.BigEndian, uint16(len(v.Data)))
+				bw.Write(v.Data)
+			}
+		}
+	}
+	bw.WriteByte(TagEnd)
+	return bw.Flush()
+}
+
+// ErrMalformed is returned when a message cannot be decoded
+var ErrMalformed = errors.New("malformed IPP message")
+
+// Decode reads a message from r. After it returns, r is positioned at the
+// start of any document data.
+func Decode(r io.Reader) (*Message, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrMalformed
+	}
+
+	m := &Message{
+		Major:     header[0],
+		Minor:     header[1],
+		Code:      binary.BigEndian.Uint16(header[2:4]),
+		RequestID: binary.BigEndian.Uint32(header[4:8]),
+	}
+
+	tag := make([]byte, 1)
+	var group *Group
+	for {
+		if _, err := io.ReadFull(r, tag); err != nil {
+			return nil, ErrMalformed
+		}
+
+		switch {
+		case tag[0] == TagEnd:
+			return m, nil
+		case tag[0] < 0x10:
+			m.Groups = append(m.Groups, Group{Tag: tag[0]})
+			group = &m.Groups[len(m.Groups)-1]
+			continue
+		case group == nil:
+			return nil, ErrMalformed
+		}
+
+		name, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		data, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+
+		value := Value{Tag: tag[0], Data: []byte(data)}
+		if name == "" {
+			// Additional value of the previous attribute
+			if len(group.Attributes) == 0 {
+				return nil, ErrMalformed
+			}
+			last := &group.Attributes[len(group.Attributes)-1]
+			last.Values = append(last.Values, value)
+			continue
+		}
+		group.Attributes = append(group.Attributes, Attribute{Name: name, Values: []Value{value}})
+	}
+}
+
+func readString(r io.Reader) (string, error) {
+	var n uint16
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return "", ErrMalformed
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", ErrMalformed
+	}
+	return string(b), nil
+}
+
+// StatusError is returned by clients when a response carries a non-successful status
+type StatusError struct {
+	Code    uint16
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("IPP status 0x%04x: %s", e.Code, e.Message)
+	}
+	return fmt.Sprintf("IPP status 0x%04x", e.Code)
+}
+
+// MediaName maps a Qprint paper size to its IPP media keyword (PWG 5101.1)
+func MediaName(paperSize string) string {
+	switch paperSize {
+	case "A3":
+		return "iso_a3_297x420mm"
+	case "Letter":
+		return "na_letter_8.5x11in"
+	case "Legal":
+		return "na_legal_8.5x14in"
+	default:
+		return "iso_a4_210x297mm"
+	}
+}
+
+// PaperSize maps an IPP media keyword back to a Qprint paper size
+func PaperSize(media string) string {
+	switch media {
+	case "iso_a3_297x420mm":
+		return "A3"
+	case "na_letter_8.5x11in":
+		return "Letter"
+	case "na_legal_8.5x14in":
+		return "Legal"
+	default:
+		return "A4"
+	}
+}
@@ -0,0 +1,103 @@
+package ipp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	m := NewRequest(OpPrintJob, 42)
+	m.Major, m.Minor = 1, 1
+	m.Add(TagOperation,
+		URI("printer-uri", "ipp://localhost:8080/ipp/shops/2"),
+		Name("job-name", "notes.pdf"),
+		MimeType("document-format", "application/pdf"))
+	m.Add(TagJob,
+		Integer("copies", 3),
+		Integer("job-priority", -1),
+		Keyword("sides", "two-sided-long-edge"),
+		Keyword("media-supported", "iso_a4_210x297mm", "iso_a3_297x420mm", "na_letter_8.5x11in"),
+		Enum("job-state", JobProcessing),
+		Range("copies-supported", 1, 999),
+		Boolean("color-supported", true),
+		Boolean("page-ranges-supported", false),
+		Text("job-state-message", "Sent to printer"))
+	// A second job group stays separate from the first
+	m.Groups = append(m.Groups, Group{Tag: TagJob, Attributes: []Attribute{Integer("job-id", 7)}})
+	m.Add(TagPrinter)
+
+	var buf bytes.Buffer
+	if err := m.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	document := []byte("%PDF-1.7 document data")
+	buf.Write(document)
+
+	got, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("decoded\n%+v\nwant\n%+v", got, m)
+	}
+	if rest, _ := io.ReadAll(&buf); !bytes.Equal(rest, document) {
+		t.Errorf("document data after the message: %q", rest)
+	}
+
+	if got.String(TagOperation, "job-name") != "notes.pdf" {
+		t.Errorf("job-name %q", got.String(TagOperation, "job-name"))
+	}
+	if n, ok := got.Int(TagJob, "job-priority"); !ok || n != -1 {
+		t.Errorf("job-priority %d, %v", n, ok)
+	}
+	if media := got.Strings(TagJob, "media-supported"); len(media) != 3 || media[2] != "na_letter_8.5x11in" {
+		t.Errorf("media-supported %q", media)
+	}
+	if id, ok := got.Int(TagJob, "job-id"); !ok || id != 7 {
+		t.Errorf("job-id %d, %v from the second job group", id, ok)
+	}
+	if _, ok := got.Find(TagPrinter, "printer-name"); ok {
+		t.Error("found an attribute in an empty group")
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	header := []byte{2, 0, 0, 2, 0, 0, 0, 1}
+	attr := func(tag byte, name, value string) []byte {
+		b := []byte{tag, 0, byte(len(name))}
+		b = append(b, name...)
+		b = append(b, 0, byte(len(value)))
+		return append(b, value...)
+	}
+	cat := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+	tests := map[string][]byte{
+		"empty":                  {},
+		"short header":           header[:5],
+		"no end tag":             cat(header, []byte{TagOperation}),
+		"value outside a group":  cat(header, attr(TagKeyword, "sides", "one-sided"), []byte{TagEnd}),
+		"additional value first": cat(header, []byte{TagOperation}, attr(TagKeyword, "", "one-sided"), []byte{TagEnd}),
+		"truncated name":         cat(header, []byte{TagOperation, TagKeyword, 0, 10, 's'}),
+		"truncated value":        cat(header, []byte{TagOperation}, attr(TagKeyword, "sides", "one-sided")[:12]),
+		"missing value length":   cat(header, []byte{TagOperation, TagKeyword, 0, 1, 'x'}),
+	}
+	for name, data := range tests {
+		if _, err := Decode(bytes.NewReader(data)); !errors.Is(err, ErrMalformed) {
+			t.Errorf("%s: %v, want ErrMalformed", name, err)
+		}
+	}
+}
+
+func TestMedia(t *testing.T) {
+	for _, size := range []string{"A4", "A3", "Letter", "Legal"} {
+		if got := PaperSize(MediaName(size)); got != size {
+			t.Errorf("%s round-trips to %s", size, got)
+		}
+	}
+	if got := PaperSize("iso_a5_148x210mm"); got != "A4" {
+		t.Errorf("unknown media is %s, want A4", got)
+	}
+}
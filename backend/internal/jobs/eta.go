@@ -0,0 +1,242 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Printing speeds assumed for a shop until it has printed enough jobs to
+// learn its own, in pages per minute
+const (
+	DefaultBWPagesPerMinute    = 10
+	DefaultColorPagesPerMinute = 4
+)
+
+const (
+	// throughputWindow is how far back completed jobs are used to learn a shop's speed
+	throughputWindow = "30 days"
+	// minThroughputSamples is how many completed jobs of a color mode are
+	// needed before the learned speed replaces the default
+	minThroughputSamples = 5
+	// maxServiceMinutes drops jobs that took longer than this to print from
+	// the sample, such as a job left waiting while the shop was closed
+	maxServiceMinutes = 60
+)
+
+// Querier runs queries; *pgxpool.Pool and pgx.Tx both satisfy it
+type Querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// Throughput is how fast a shop prints, in pages per minute
+type Throughput struct {
+	BW    float64
+	Color float64
+}
+
+// PagesPerMinute returns the speed for jobs in the given color mode
+func (t Throughput) PagesPerMinute(colorMode string) float64 {
+	if colorMode == "color" {
+		return t.Color
+	}
+	return t.BW
+}
+
+// LoadThroughput learns the printing speed of each shop from its recently
+// completed queue jobs. A job's print time runs from when it could start,
+// the later of entering the queue and the shop finishing its previous job,
+// to when it was marked printed. Shops or color modes with too few jobs
+// use the default speeds.
+func LoadThroughput(ctx context.Context, db Querier, shopIDs []int) (map[int]Throughput, error) {
+	rows, err := db.Query(ctx,
+		`WITH done AS (
+		   SELECT f.shop_id, f.color_mode, GREATEST(f.num_pages, 1) * f.copies AS pages, p.changed_at AS printed_at,
+		     (SELECT MIN(h.changed_at) FROM file_status_history h
+		      WHERE h.file_id = f.id AND h.to_status = 'queued') AS queued_at
+		   FROM files f
+		   JOIN file_status_history p ON p.file_id = f.id AND p.to_status = 'printed'
+		   WHERE f.print_type = 'queue' AND f.shop_id = ANY($1)
+		     AND p.changed_at > NOW() - $2::interval
+		 ), timed AS (
+		   SELECT shop_id, color_mode, pages,
+		     EXTRACT(EPOCH FROM printed_at - GREATEST(queued_at,
+		       LAG(printed_at) OVER (PARTITION BY shop_id ORDER BY printed_at))) / 60 AS minutes
+		   FROM done
+		 )
+		 SELECT shop_id, color_mode, SUM(pages)::float8, SUM(minutes)::float8, COUNT(*)
+		 FROM timed
+		 WHERE minutes > 0 AND minutes <= $3
+		 GROUP BY shop_id, color_mode`,
+		shopIDs, throughputWindow, maxServiceMinutes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	speeds := make(map[int]Throughput, len(shopIDs))
+	for _, id := range shopIDs {
+		speeds[id] = Throughput{BW: DefaultBWPagesPerMinute, Color: DefaultColorPagesPerMinute}
+	}
+	for rows.Next() {
+		var shopID, samples int
+		var colorMode string
+		var pages, minutes float64
+		if err := rows.Scan(&shopID, &colorMode, &pages, &minutes, &samples); err != nil {
+			return nil, err
+		}
+		if samples < minThroughputSamples || minutes <= 0 {
+			continue
+		}
+		speed := speeds[shopID]
+		if colorMode == "color" {
+			speed.Color = pages / minutes
+		} else {
+			speed.BW = pages / minutes
+		}
+		speeds[shopID] = speed
+	}
+	return speeds, rows.Err()
+}
+
+// QueuedJob is a job holding a queue position, as needed to estimate when it
+// will be printed
+type QueuedJob struct {
+	FileID    int
+	Status    Status
+	ColorMode string
+	Pages     int           // pages × copies
+	Elapsed   time.Duration // time since printing started, for jobs already printing
+}
+
+// ETA is when a job is expected to start and finish printing
+type ETA struct {
+	Start      time.Time
+	Completion time.Time
+}
+
+// Estimate walks a shop queue in order and estimates when each job starts
+// and finishes, assuming the shop prints one job after another at speed
+// while it is open. A job that would run past closing time finishes after
+// the shop opens again. Jobs already printing must come first. One printing
+// longer than expected is assumed to finish now.
+func Estimate(now time.Time, queue []QueuedJob, speed Throughput, hours *Hours) map[int]ETA {
+	etas := make(map[int]ETA, len(queue))
+	next := now
+	for _, job := range queue {
+		perMinute := speed.PagesPerMinute(job.ColorMode)
+		duration := time.Duration(float64(job.Pages) / perMinute * float64(time.Minute))
+
+		var start, completion time.Time
+		if job.Status == Printing {
+			start = now.Add(-job.Elapsed)
+			completion = now
+			if remaining := duration - job.Elapsed; remaining > 0 {
+				completion = hours.Finish(now, remaining)
+			}
+		} else {
+			start = hours.NextOpen(next)
+			completion = hours.Finish(start, duration)
+		}
+
+		etas[job.FileID] = ETA{Start: start, Completion: completion}
+		if completion.After(next) {
+			next = completion
+		}
+	}
+	return etas
+}
+
+// loadQueues returns the jobs holding a queue position at each of the given
+// shops, jobs already printing first and then the rest in queue order. Held
+// jobs hold no position and are left out.
+func loadQueues(ctx context.Context, db Querier, shopIDs []int) (map[int][]QueuedJob, error) {
+	rows, err := db.Query(ctx,
+		`SELECT q.shop_id, q.file_id, f.status, f.color_mode, GREATEST(f.num_pages, 1) * f.copies,
+		   COALESCE(EXTRACT(EPOCH FROM NOW() - (SELECT MAX(h.changed_at) FROM file_status_history h
+		     WHERE h.file_id = f.id AND h.to_status = 'printing')), 0)::float8
+		 FROM queue_positions q JOIN files f ON f.id = q.file_id
+		 WHERE q.shop_id = ANY($1)
+		 ORDER BY q.shop_id, f.status = 'printing' DESC, q.queue_position`, shopIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	queues := make(map[int][]QueuedJob)
+	for rows.Next() {
+		var shopID int
+		var job QueuedJob
+		var status string
+		var elapsed float64
+		if err := rows.Scan(&shopID, &job.FileID, &status, &job.ColorMode, &job.Pages, &elapsed); err != nil {
+			return nil, err
+		}
+		job.Status = Status(status)
+		job.Elapsed = time.Duration(elapsed * float64(time.Second))
+		queues[shopID] = append(queues[shopID], job)
+	}
+	return queues, rows.Err()
+}
+
+// LoadETAs estimates when every job holding a queue position at the given
+// shops starts and finishes printing, keyed by file ID. Held jobs get no
+// estimate.
+func LoadETAs(ctx context.Context, db Querier, shopIDs []int) (map[int]ETA, error) {
+	queues, err := loadQueues(ctx, db, shopIDs)
+	if err != nil {
+		return nil, err
+	}
+	speeds, err := LoadThroughput(ctx, db, shopIDs)
+	if err != nil {
+		return nil, err
+	}
+	hours, err := LoadHours(ctx, db, shopIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	etas := make(map[int]ETA)
+	for shopID, queue := range queues {
+		for fileID, eta := range Estimate(now, queue, speeds[shopID], hours[shopID]) {
+			etas[fileID] = eta
+		}
+	}
+	return etas, nil
+}
+
+// LoadQueueClear estimates when each of the given shops could start a job
+// submitted now: when it finishes every job in its queue, or for an empty
+// queue when it next opens. Shops with an empty queue that are open now are
+// left out.
+func LoadQueueClear(ctx context.Context, db Querier, shopIDs []int) (map[int]time.Time, error) {
+	queues, err := loadQueues(ctx, db, shopIDs)
+	if err != nil {
+		return nil, err
+	}
+	speeds, err := LoadThroughput(ctx, db, shopIDs)
+	if err != nil {
+		return nil, err
+	}
+	hours, err := LoadHours(ctx, db, shopIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	clearsAt := make(map[int]time.Time, len(shopIDs))
+	for _, shopID := range shopIDs {
+		queue := queues[shopID]
+		if len(queue) == 0 {
+			if opens := hours[shopID].NextOpen(now); opens.After(now) {
+				clearsAt[shopID] = opens
+			}
+			continue
+		}
+		last := queue[len(queue)-1]
+		clearsAt[shopID] = Estimate(now, queue, speeds[shopID], hours[shopID])[last.FileID].Completion
+	}
+	return clearsAt, nil
+}
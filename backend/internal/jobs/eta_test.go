@@ -0,0 +1,141 @@
+package jobs_test
+
+import (
+	"testing"
+	"time"
+
+	"backend/internal/jobs"
+	"backend/internal/models"
+)
+
+func TestEstimate(t *testing.T) {
+	ist, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// at returns a time in October 2026; the 12th is a Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.October, day, hour, minute, 0, 0, ist)
+	}
+
+	var weekdays []models.OpeningHours
+	for _, day := range []string{"mon", "tue", "wed", "thu", "fri"} {
+		weekdays = append(weekdays, models.OpeningHours{Day: day, Open: "09:00", Close: "18:00"})
+	}
+	office := &jobs.Hours{Location: ist, Weekly: weekdays, Holidays: []string{"2026-10-13"}}
+	lateNight := &jobs.Hours{Location: ist, Weekly: []models.OpeningHours{
+		{Day: "sat", Open: "20:00", Close: "24:00"},
+		{Day: "sun", Open: "00:00", Close: "02:00"},
+	}}
+
+	defaults := jobs.Throughput{BW: jobs.DefaultBWPagesPerMinute, Color: jobs.DefaultColorPagesPerMinute}
+	learned := jobs.Throughput{BW: 20, Color: 5}
+	queued := func(id, pages int, colorMode string) jobs.QueuedJob {
+		return jobs.QueuedJob{FileID: id, Status: jobs.Queued, ColorMode: colorMode, Pages: pages}
+	}
+
+	tests := []struct {
+		name  string
+		now   time.Time
+		hours *jobs.Hours
+		speed jobs.Throughput
+		queue []jobs.QueuedJob
+		want  map[int]jobs.ETA
+	}{
+		{
+			name: "empty queue", now: at(12, 10, 0), hours: office, speed: defaults,
+			want: map[int]jobs.ETA{},
+		},
+		{
+			name: "default rate", now: at(12, 10, 0), hours: office, speed: defaults,
+			queue: []jobs.QueuedJob{queued(1, 20, "bw"), queued(2, 20, "color")},
+			want: map[int]jobs.ETA{
+				1: {Start: at(12, 10, 0), Completion: at(12, 10, 2)},
+				2: {Start: at(12, 10, 2), Completion: at(12, 10, 7)},
+			},
+		},
+		{
+			name: "learned rate", now: at(12, 10, 0), hours: office, speed: learned,
+			queue: []jobs.QueuedJob{queued(1, 20, "bw"), queued(2, 20, "color")},
+			want: map[int]jobs.ETA{
+				1: {Start: at(12, 10, 0), Completion: at(12, 10, 1)},
+				2: {Start: at(12, 10, 1), Completion: at(12, 10, 5)},
+			},
+		},
+		{
+			name: "job already printing", now: at(12, 10, 0), hours: office, speed: defaults,
+			queue: []jobs.QueuedJob{
+				{FileID: 1, Status: jobs.Printing, ColorMode: "bw", Pages: 20, Elapsed: time.Minute},
+				{FileID: 2, Status: jobs.Printing, ColorMode: "bw", Pages: 10, Elapsed: 5 * time.Minute},
+				queued(3, 10, "bw"),
+			},
+			want: map[int]jobs.ETA{
+				1: {Start: at(12, 9, 59), Completion: at(12, 10, 1)},
+				// Printing for longer than expected: assumed to finish now
+				2: {Start: at(12, 9, 55), Completion: at(12, 10, 0)},
+				3: {Start: at(12, 10, 1), Completion: at(12, 10, 2)},
+			},
+		},
+		{
+			// Tuesday is a holiday, so the rest of the work waits for Wednesday
+			name: "queue running past closing time", now: at(12, 17, 55), hours: office, speed: defaults,
+			queue: []jobs.QueuedJob{queued(1, 30, "bw"), queued(2, 100, "bw"), queued(3, 10, "bw")},
+			want: map[int]jobs.ETA{
+				1: {Start: at(12, 17, 55), Completion: at(12, 17, 58)},
+				2: {Start: at(12, 17, 58), Completion: at(14, 9, 8)},
+				3: {Start: at(14, 9, 8), Completion: at(14, 9, 9)},
+			},
+		},
+		{
+			name: "job finishing at closing time", now: at(12, 17, 50), hours: office, speed: defaults,
+			queue: []jobs.QueuedJob{queued(1, 100, "bw"), queued(2, 10, "bw")},
+			want: map[int]jobs.ETA{
+				1: {Start: at(12, 17, 50), Completion: at(12, 18, 0)},
+				2: {Start: at(14, 9, 0), Completion: at(14, 9, 1)},
+			},
+		},
+		{
+			name: "shop closed for the weekend", now: at(17, 10, 0), hours: office, speed: defaults,
+			queue: []jobs.QueuedJob{queued(1, 20, "bw")},
+			want: map[int]jobs.ETA{
+				1: {Start: at(19, 9, 0), Completion: at(19, 9, 2)},
+			},
+		},
+		{
+			name: "printing job paused overnight", now: at(12, 17, 59), hours: office, speed: defaults,
+			queue: []jobs.QueuedJob{{FileID: 1, Status: jobs.Printing, ColorMode: "bw", Pages: 50, Elapsed: time.Minute}},
+			want: map[int]jobs.ETA{
+				1: {Start: at(12, 17, 58), Completion: at(14, 9, 3)},
+			},
+		},
+		{
+			name: "open past midnight", now: at(17, 23, 55), hours: lateNight, speed: defaults,
+			queue: []jobs.QueuedJob{queued(1, 100, "bw")},
+			want: map[int]jobs.ETA{
+				1: {Start: at(17, 23, 55), Completion: at(18, 0, 5)},
+			},
+		},
+		{
+			name: "no opening hours", now: at(17, 23, 55), hours: nil, speed: defaults,
+			queue: []jobs.QueuedJob{queued(1, 100, "bw")},
+			want: map[int]jobs.ETA{
+				1: {Start: at(17, 23, 55), Completion: at(18, 0, 5)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := jobs.Estimate(tt.now, tt.queue, tt.speed, tt.hours)
+			if len(got) != len(tt.want) {
+				t.Errorf("%d estimates, want %d", len(got), len(tt.want))
+			}
+			for id, want := range tt.want {
+				if eta := got[id]; !eta.Start.Equal(want.Start) || !eta.Completion.Equal(want.Completion) {
+					t.Errorf("job %d: %s to %s, want %s to %s", id,
+						eta.Start.In(ist).Format(time.DateTime), eta.Completion.In(ist).Format(time.DateTime),
+						want.Start.Format(time.DateTime), want.Completion.Format(time.DateTime))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package jobs
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"backend/internal/models"
+)
+
+// maxClosedDays is how far ahead Hours looks for the shop to open again. A
+// shop with no opening in that time is treated as always open rather than
+// pushing its estimates out indefinitely.
+const maxClosedDays = 366
+
+// Hours are when a shop is open, from its profile. A nil *Hours is always
+// open, as is a shop without weekly opening hours except on its holidays.
+type Hours struct {
+	Location *time.Location
+	Weekly   []models.OpeningHours
+	Holidays []string // "2006-01-02" in Location
+}
+
+// period is one stretch of time the shop is open
+type period struct {
+	start, end time.Time
+}
+
+// periods returns the opening periods on the local day starting at midnight
+func (h *Hours) periods(midnight time.Time) []period {
+	if slices.Contains(h.Holidays, midnight.Format("2006-01-02")) {
+		return nil
+	}
+	y, m, d := midnight.Date()
+	if len(h.Weekly) == 0 {
+		return []period{{midnight, time.Date(y, m, d+1, 0, 0, 0, 0, h.Location)}}
+	}
+
+	day := strings.ToLower(midnight.Weekday().String()[:3])
+	var open []period
+	for _, oh := range h.Weekly {
+		if oh.Day != day {
+			continue
+		}
+		start, err1 := time.Parse("15:04", oh.Open)
+		end, err2 := time.Parse("15:04", strings.Replace(oh.Close, "24:00", "00:00", 1))
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		endDay := d
+		if oh.Close == "24:00" {
+			endDay++
+		}
+		open = append(open, period{
+			time.Date(y, m, d, start.Hour(), start.Minute(), 0, 0, h.Location),
+			time.Date(y, m, endDay, end.Hour(), end.Minute(), 0, 0, h.Location),
+		})
+	}
+	slices.SortFunc(open, func(a, b period) int { return a.start.Compare(b.start) })
+	return open
+}
+
+// next returns the opening period that contains t or, if the shop is
+// closed at t, the next one to start. ok is false if the shop does not open
+// within maxClosedDays.
+func (h *Hours) next(t time.Time) (period, bool) {
+	local := t.In(h.Location)
+	y, m, d := local.Date()
+	for i := 0; i <= maxClosedDays; i++ {
+		for _, p := range h.periods(time.Date(y, m, d+i, 0, 0, 0, 0, h.Location)) {
+			if p.end.After(t) {
+				if p.start.Before(t) {
+					p.start = t
+				}
+				return p, true
+			}
+		}
+	}
+	return period{}, false
+}
+
+// NextOpen returns t if the shop is open at t, and otherwise when it next opens
+func (h *Hours) NextOpen(t time.Time) time.Time {
+	if h == nil {
+		return t
+	}
+	p, ok := h.next(t)
+	if !ok {
+		return t
+	}
+	return p.start
+}
+
+// Finish returns when work needing d of open time, started at from, is
+// done. Time the shop is closed does not count.
+func (h *Hours) Finish(from time.Time, d time.Duration) time.Time {
+	if h == nil {
+		return from.Add(d)
+	}
+	t := from
+	for {
+		p, ok := h.next(t)
+		if !ok {
+			return t.Add(d)
+		}
+		open := p.end.Sub(p.start)
+		if d <= open {
+			return p.start.Add(d)
+		}
+		d -= open
+		t = p.end
+	}
+}
+
+// LoadHours returns the opening hours and upcoming holidays of the given
+// shops, keyed by shop ID
+func LoadHours(ctx context.Context, db Querier, shopIDs []int) (map[int]*Hours, error) {
+	rows, err := db.Query(ctx,
+		`SELECT s.user_id, s.timezone, s.opening_hours,
+		   ARRAY(SELECT h.day::text FROM shop_holidays h WHERE h.shop_id = s.user_id AND h.day >= CURRENT_DATE - 1)
+		 FROM shops s WHERE s.user_id = ANY($1)`, shopIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hours := make(map[int]*Hours, len(shopIDs))
+	for rows.Next() {
+		var shopID int
+		var timezone string
+		h := &Hours{}
+		if err := rows.Scan(&shopID, &timezone, &h.Weekly, &h.Holidays); err != nil {
+			return nil, err
+		}
+		h.Location, err = time.LoadLocation(timezone)
+		if err != nil {
+			h.Location = time.UTC
+		}
+		hours[shopID] = h
+	}
+	return hours, rows.Err()
+}
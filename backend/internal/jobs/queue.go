@@ -0,0 +1,147 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Enqueue reserves the next queue slot for a shop and returns its sequence
+// number, which orders the job within the shop queue. The per-shop counter
+// row stays locked until tx ends, so concurrent uploads and reorderings of
+// the same shop are serialised and uploads always receive distinct,
+// increasing sequence numbers.
+func Enqueue(ctx context.Context, tx pgx.Tx, shopID int) (int64, error) {
+	var seq int64
+	err := tx.QueryRow(ctx,
+		`INSERT INTO shop_queue_counters (shop_id, next_seq) VALUES ($1, 1)
+		 ON CONFLICT (shop_id) DO UPDATE SET next_seq = shop_queue_counters.next_seq + 1
+		 RETURNING next_seq`, shopID).Scan(&seq)
+	return seq, err
+}
+
+// Position returns the current 1-based position of a job in its shop queue,
+// or nil if the job is not waiting in a queue. Positions are computed on read
+// by the queue_positions view, so they never need to be shifted when a job
+// leaves the queue.
+func Position(ctx context.Context, tx pgx.Tx, fileID int) (*int, error) {
+	var position int
+	err := tx.QueryRow(ctx,
+		"SELECT queue_position FROM queue_positions WHERE file_id = $1", fileID).Scan(&position)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &position, nil
+}
+
+var (
+	// ErrNotQueued is returned when a queue operation targets a job that is not waiting in the queue
+	ErrNotQueued = errors.New("job is not waiting in the queue")
+	// ErrQueueEdge is returned when a job cannot move further in the requested direction
+	ErrQueueEdge = errors.New("job cannot move further in that direction")
+)
+
+// LockQueue locks a shop queue until tx ends. Every reordering of a shop
+// queue takes this lock, as does Enqueue, so readers never observe a half-applied change.
+func LockQueue(ctx context.Context, tx pgx.Tx, shopID int) error {
+	_, err := tx.Exec(ctx,
+		`INSERT INTO shop_queue_counters (shop_id, next_seq) VALUES ($1, 0)
+		 ON CONFLICT (shop_id) DO UPDATE SET next_seq = shop_queue_counters.next_seq`, shopID)
+	return err
+}
+
+type queuedJob struct {
+	seq      int64
+	priority bool
+	onHold   bool
+}
+
+// lockQueuedJob locks the shop queue and loads a queued job belonging to it
+func lockQueuedJob(ctx context.Context, tx pgx.Tx, shopID, fileID int) (*queuedJob, error) {
+	if err := LockQueue(ctx, tx, shopID); err != nil {
+		return nil, err
+	}
+
+	var job queuedJob
+	var seq *int64
+	var status string
+	err := tx.QueryRow(ctx,
+		`SELECT queue_seq, queue_priority, on_hold, status FROM files
+		 WHERE id = $1 AND shop_id = $2 AND print_type = 'queue'`, fileID, shopID).Scan(&seq, &job.priority, &job.onHold, &status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotQueued
+	}
+	if err != nil {
+		return nil, err
+	}
+	if seq == nil || Status(status) != Queued {
+		return nil, ErrNotQueued
+	}
+	job.seq = *seq
+	return &job, nil
+}
+
+// Move swaps a queued job with its neighbour, towards the front of the
+// queue if up is true. Jobs only move within their group: pinned jobs among
+// pinned jobs and normal jobs among normal jobs. Held jobs and jobs that are
+// already printing are skipped.
+func Move(ctx context.Context, tx pgx.Tx, shopID, fileID int, up bool) error {
+	job, err := lockQueuedJob(ctx, tx, shopID, fileID)
+	if err != nil {
+		return err
+	}
+	if job.onHold {
+		return ErrNotQueued
+	}
+
+	query := `SELECT id, queue_seq FROM files
+		 WHERE shop_id = $1 AND print_type = 'queue' AND status = 'queued'
+		 AND NOT on_hold AND queue_priority = $2 AND queue_seq > $3
+		 ORDER BY queue_seq ASC LIMIT 1`
+	if up {
+		query = `SELECT id, queue_seq FROM files
+		 WHERE shop_id = $1 AND print_type = 'queue' AND status = 'queued'
+		 AND NOT on_hold AND queue_priority = $2 AND queue_seq < $3
+		 ORDER BY queue_seq DESC LIMIT 1`
+	}
+
+	var neighbourID int
+	var neighbourSeq int64
+	err = tx.QueryRow(ctx, query, shopID, job.priority, job.seq).Scan(&neighbourID, &neighbourSeq)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrQueueEdge
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE files SET queue_seq = $1 WHERE id = $2", neighbourSeq, fileID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, "UPDATE files SET queue_seq = $1 WHERE id = $2", job.seq, neighbourID)
+	return err
+}
+
+// SetPriority pins a queued job ahead of all normal jobs, or unpins it.
+// Pinned jobs keep their relative order by sequence number.
+func SetPriority(ctx context.Context, tx pgx.Tx, shopID, fileID int, priority bool) error {
+	if _, err := lockQueuedJob(ctx, tx, shopID, fileID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, "UPDATE files SET queue_priority = $1 WHERE id = $2", priority, fileID)
+	return err
+}
+
+// SetHold puts a queued job on hold or resumes it. Held jobs give up their
+// queue position; a resumed job returns to the place its sequence number gives it.
+func SetHold(ctx context.Context, tx pgx.Tx, shopID, fileID int, onHold bool) error {
+	if _, err := lockQueuedJob(ctx, tx, shopID, fileID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, "UPDATE files SET on_hold = $1 WHERE id = $2", onHold, fileID)
+	return err
+}
@@ -0,0 +1,92 @@
+package jobs_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"backend/internal/database"
+	"backend/internal/database/dbtest"
+	"backend/internal/jobs"
+)
+
+// TestEnqueueConcurrent uploads to one shop from many goroutines at once and
+// checks that every job gets its own slot and the queue has no gaps
+func TestEnqueueConcurrent(t *testing.T) {
+	dbtest.Setup(t)
+	ctx := context.Background()
+	customer := dbtest.CreateUser(t, "customer")
+	shop := dbtest.CreateShop(t, 12.97, 77.59)
+
+	const uploads = 64
+	var wg sync.WaitGroup
+	errs := make(chan error, uploads)
+	for i := range uploads {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- enqueue(ctx, customer, shop, i)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows, err := database.DB.Query(ctx,
+		`SELECT f.queue_seq, q.queue_position FROM files f
+		 JOIN queue_positions q ON q.file_id = f.id
+		 WHERE f.shop_id = $1 ORDER BY f.queue_seq`, shop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		var seq int64
+		var position int
+		if err := rows.Scan(&seq, &position); err != nil {
+			t.Fatal(err)
+		}
+		n++
+		// Sequence numbers start at 1 and positions follow them exactly, so
+		// neither repeats nor skips
+		if seq != int64(n) || position != n {
+			t.Errorf("job %d has queue_seq %d and position %d", n, seq, position)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n != uploads {
+		t.Errorf("%d jobs in the queue, want %d", n, uploads)
+	}
+}
+
+// enqueue queues a job as an upload does: the slot is reserved and the job
+// stored in one transaction
+func enqueue(ctx context.Context, customer, shop, i int) error {
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	seq, err := jobs.Enqueue(ctx, tx, shop)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx,
+		`INSERT INTO files (user_id, storage_key, unique_code, status, print_type, shop_id, queue_seq)
+		 VALUES ($1, $2, $3, $4, 'queue', $5, $6)`,
+		customer, fmt.Sprintf("test/%d.pdf", i), fmt.Sprintf("Q%05d", i), jobs.Queued, shop, seq)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,82 @@
+package jobs
+
+import "fmt"
+
+// Status is the lifecycle state of a print job stored in files.status
+type Status string
+
+const (
+	PendingPayment Status = "pending_payment" // queue job waiting for its online payment
+
+	Uploaded  Status = "uploaded"  // private job waiting to be redeemed by code
+	Queued    Status = "queued"    // job waiting in a shop queue
+	Printing  Status = "printing"  // shop has started printing the job
+	Printed   Status = "printed"   // printing finished, waiting for pickup
+	Collected Status = "collected" // customer has the prints
+	Cancelled Status = "cancelled" // withdrawn before printing started
+	Expired   Status = "expired"   // never printed or never collected, or stuck and expired by an admin
+	Failed    Status = "failed"    // printing failed
+)
+
+// transitions lists the statuses each status may move to
+var transitions = map[Status][]Status{
+	PendingPayment: {Queued, Cancelled, Expired},
+	Uploaded:       {Queued, Printing, Cancelled, Expired, Failed},
+	Queued:         {Printing, Cancelled, Expired, Failed},
+	Printing:       {Printed, Failed, Expired},
+	Printed:        {Collected, Expired},
+	Failed:         {Queued, Expired},
+	Collected:      {},
+	Cancelled:      {},
+	Expired:        {},
+}
+
+// Parse converts a stored status string into a Status
+func Parse(s string) (Status, error) {
+	status := Status(s)
+	if _, ok := transitions[status]; !ok {
+		return "", fmt.Errorf("unknown job status %q", s)
+	}
+	return status, nil
+}
+
+// CanTransitionTo reports whether a job may move from s to next
+func (s Status) CanTransitionTo(next Status) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTerminal reports whether no further transitions are possible from s
+func (s Status) IsTerminal() bool {
+	return len(transitions[s]) == 0
+}
+
+// InQueue reports whether a job in status s holds a position in a shop queue
+func (s Status) InQueue() bool {
+	return s == Queued || s == Printing
+}
+
+// QueueStatuses returns the statuses that hold a queue position, for use in
+// SQL queries as "status = ANY($n)"
+func QueueStatuses() []string {
+	return []string{string(Queued), string(Printing)}
+}
+
+// DoneStatuses returns the statuses of jobs a shop has finished printing
+func DoneStatuses() []string {
+	return []string{string(Printed), string(Collected)}
+}
+
+// IllegalTransitionError is returned when a job cannot move to the requested status
+type IllegalTransitionError struct {
+	From Status
+	To   Status
+}
+
+func (e *IllegalTransitionError) Error() string {
+	return fmt.Sprintf("cannot move job from %s to %s", e.From, e.To)
+}
@@ -0,0 +1,89 @@
+package jobs
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// forward is the normal progress of a job, used by Advance
+var forward = map[Status]Status{
+	Uploaded: Printing,
+	Queued:   Printing,
+	Printing: Printed,
+	Printed:  Collected,
+}
+
+// Record inserts a history row for a newly created job
+func Record(ctx context.Context, tx pgx.Tx, fileID int, status Status, changedBy int, note string) error {
+	_, err := tx.Exec(ctx,
+		`INSERT INTO file_status_history (file_id, from_status, to_status, changed_by, note)
+		 VALUES ($1, NULL, $2, $3, $4)`, fileID, status, changedBy, note)
+	return err
+}
+
+// Transition moves a job to the given status, recording the change in
+// file_status_history. The file row stays locked until tx ends, so concurrent
+// transitions of the same job are serialised. It returns the status the job
+// had before the change, or an *IllegalTransitionError if the move is not allowed.
+func Transition(ctx context.Context, tx pgx.Tx, fileID int, changedBy int, note string, to Status) (Status, error) {
+	from, err := lock(ctx, tx, fileID)
+	if err != nil {
+		return "", err
+	}
+
+	if !from.CanTransitionTo(to) {
+		return from, &IllegalTransitionError{From: from, To: to}
+	}
+	return from, apply(ctx, tx, fileID, changedBy, note, from, []Status{to})
+}
+
+// Advance moves a job forward through its normal lifecycle until it reaches
+// target, recording every intermediate status. For example confirming a
+// queued job as printed records queued → printing → printed.
+func Advance(ctx context.Context, tx pgx.Tx, fileID int, changedBy int, note string, target Status) (Status, error) {
+	from, err := lock(ctx, tx, fileID)
+	if err != nil {
+		return "", err
+	}
+
+	var steps []Status
+	for status := from; status != target; {
+		next, ok := forward[status]
+		if !ok {
+			return from, &IllegalTransitionError{From: from, To: target}
+		}
+		steps = append(steps, next)
+		status = next
+	}
+	if len(steps) == 0 {
+		return from, &IllegalTransitionError{From: from, To: target}
+	}
+	return from, apply(ctx, tx, fileID, changedBy, note, from, steps)
+}
+
+// lock reads and locks the current status of a job
+func lock(ctx context.Context, tx pgx.Tx, fileID int) (Status, error) {
+	var current string
+	err := tx.QueryRow(ctx,
+		"SELECT status FROM files WHERE id = $1 FOR UPDATE", fileID).Scan(&current)
+	if err != nil {
+		return "", err
+	}
+	return Parse(current)
+}
+
+func apply(ctx context.Context, tx pgx.Tx, fileID int, changedBy int, note string, from Status, steps []Status) error {
+	status := from
+	for _, next := range steps {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO file_status_history (file_id, from_status, to_status, changed_by, note)
+			 VALUES ($1, $2, $3, $4, $5)`, fileID, status, next, changedBy, note); err != nil {
+			return err
+		}
+		status = next
+	}
+
+	_, err := tx.Exec(ctx, "UPDATE files SET status = $1 WHERE id = $2", status, fileID)
+	return err
+}
@@ -1,82 +1,427 @@
-package models
-
-import "time"
-
-type User struct {
-	ID           int     `json:"id"`
-	Username     string  `json:"username"`
-	PasswordHash string  `json:"-"`
-	Role         string  `json:"role"` // 'customer' or 'shopkeeper'
-	Lat          float64 `json:"lat,omitempty"`
-	Long         float64 `json:"long,omitempty"`
-	Address      string  `json:"address,omitempty"`
-}
-
-type File struct {
-	ID            int       `json:"id"`
-	UserID        int       `json:"user_id"`
-	FilePath      string    `json:"file_path"`
-	UniqueCode    string    `json:"unique_code"`
-	Status        string    `json:"status"`
-	CreatedAt     time.Time `json:"created_at"`
-	PrintType     string    `json:"print_type"`
-	Copies        int       `json:"copies"`
-	PrintMode     string    `json:"print_mode"`
-	ColorMode     string    `json:"color_mode"`
-	PaperSize     string    `json:"paper_size"`
-	NumPages      int       `json:"num_pages"`
-	TotalCost     float64   `json:"total_cost"`
-	ShopID        *int      `json:"shop_id,omitempty"`
-	QueuePosition *int      `json:"queue_position,omitempty"`
-}
-
-type LoginRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
-}
-
-type RegisterRequest struct {
-	Username string   `json:"username"`
-	Password string   `json:"password"`
-	Role     string   `json:"role"`
-	Lat      *float64 `json:"lat"`
-	Long     *float64 `json:"long"`
-	Address  string   `json:"address,omitempty"`
-}
-
-type LoginResponse struct {
-	Token    string `json:"token"`
-	Role     string `json:"role"`
-	Username string `json:"username"`
-}
-
-type UploadRequest struct {
-	PrintType string `json:"print_type"` // "private" or "queue"
-	Copies    int    `json:"copies"`
-	PrintMode string `json:"print_mode"` // "single" or "double"
-	ColorMode string `json:"color_mode"` // "bw" or "color"
-	PaperSize string `json:"paper_size"` // "A4", "Letter", etc.
-	ShopID    *int   `json:"shop_id,omitempty"`
-}
-
-type UploadResponse struct {
-	Code          string  `json:"code,omitempty"`
-	FileID        int     `json:"file_id"`
-	NumPages      int     `json:"num_pages"`
-	TotalCost     float64 `json:"total_cost"`
-	QueuePosition *int    `json:"queue_position,omitempty"`
-}
-
-type QueueFile struct {
-	ID            int       `json:"id"`
-	CustomerName  string    `json:"customer_name"`
-	Filename      string    `json:"filename"`
-	Copies        int       `json:"copies"`
-	PrintMode     string    `json:"print_mode"`
-	ColorMode     string    `json:"color_mode"`
-	PaperSize     string    `json:"paper_size"`
-	NumPages      int       `json:"num_pages"`
-	TotalCost     float64   `json:"total_cost"`
-	QueuePosition int       `json:"queue_position"`
-	CreatedAt     time.Time `json:"created_at"`
-}
+package models
+
+import (
+	"time"
+
+	"backend/internal/money"
+)
+
+type User struct {
+	ID           int     `json:"id"`
+	Username     string  `json:"username"`
+	PasswordHash string  `json:"-"`
+	Role         string  `json:"role"` // 'customer', 'shopkeeper' or 'admin'
+	Lat          float64 `json:"lat,omitempty"`
+	Long         float64 `json:"long,omitempty"`
+	Address      string  `json:"address,omitempty"`
+}
+
+type File struct {
+	ID            int         `json:"id"`
+	UserID        int         `json:"user_id"`
+	StorageKey    string      `json:"storage_key"`
+	UniqueCode    string      `json:"unique_code"`
+	Status        string      `json:"status"`
+	CreatedAt     time.Time   `json:"created_at"`
+	PrintType     string      `json:"print_type"`
+	Copies        int         `json:"copies"`
+	PrintMode     string      `json:"print_mode"`
+	ColorMode     string      `json:"color_mode"`
+	PaperSize     string      `json:"paper_size"`
+	NumPages      int         `json:"num_pages"`
+	TotalCost     money.Paise `json:"total_cost"`
+	ShopID        *int        `json:"shop_id,omitempty"`
+	QueuePosition *int        `json:"queue_position,omitempty"`
+	// PriceCardVersion is the shop price card version used to compute TotalCost.
+	// Nil when the job was priced with the default card.
+	PriceCardVersion *int `json:"price_card_version,omitempty"`
+
+	PaymentMethod string     `json:"payment_method"` // "cash", "wallet" or "online"
+	PaidAt        *time.Time `json:"paid_at,omitempty"`
+}
+
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type RegisterRequest struct {
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	Role     string   `json:"role"`
+	Lat      *float64 `json:"lat"`
+	Long     *float64 `json:"long"`
+	Address  string   `json:"address,omitempty"`
+	// Shop holds the business details of a shopkeeper registration
+	Shop *ShopDetails `json:"shop,omitempty"`
+}
+
+type LoginResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // access token lifetime in seconds
+	Role         string `json:"role"`
+	Username     string `json:"username"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token,omitempty"`
+	All          bool   `json:"all,omitempty"` // revoke every refresh token of the user
+}
+
+type UploadRequest struct {
+	PrintType string `json:"print_type"` // "private" or "queue"
+	Copies    int    `json:"copies"`
+	PrintMode string `json:"print_mode"` // "single" or "double"
+	ColorMode string `json:"color_mode"` // "bw" or "color"
+	PaperSize string `json:"paper_size"` // "A4", "Letter", etc.
+	ShopID    *int   `json:"shop_id,omitempty"`
+}
+
+type UploadResponse struct {
+	Code          string      `json:"code,omitempty"`
+	FileID        int         `json:"file_id"`
+	NumPages      int         `json:"num_pages"`
+	TotalCost     money.Paise `json:"total_cost"`
+	QueuePosition *int        `json:"queue_position,omitempty"`
+	PaymentMethod string      `json:"payment_method"`
+
+	PriceCardVersion *int `json:"price_card_version,omitempty"`
+
+	// Payment is the online payment to complete before a queue job enters the queue
+	Payment *PaymentIntent `json:"payment,omitempty"`
+}
+
+type QueueFile struct {
+	ID            int         `json:"id"`
+	CustomerName  string      `json:"customer_name"`
+	Filename      string      `json:"filename"`
+	Copies        int         `json:"copies"`
+	PrintMode     string      `json:"print_mode"`
+	ColorMode     string      `json:"color_mode"`
+	PaperSize     string      `json:"paper_size"`
+	NumPages      int         `json:"num_pages"`
+	TotalCost     money.Paise `json:"total_cost"`
+	QueuePosition *int        `json:"queue_position"` // nil while the job is on hold
+	Status        string      `json:"status"`
+	Priority      bool        `json:"priority"`
+	OnHold        bool        `json:"on_hold"`
+	Progress      string      `json:"progress,omitempty"` // last message reported while printing
+	CreatedAt     time.Time   `json:"created_at"`
+
+	PaymentMethod string     `json:"payment_method"`
+	PaidAt        *time.Time `json:"paid_at"` // nil until paid; cash jobs are marked paid by the shop
+
+	// Estimated print times, nil while the job is on hold
+	EstimatedStart      *time.Time `json:"estimated_start,omitempty"`
+	EstimatedCompletion *time.Time `json:"estimated_completion,omitempty"`
+}
+
+// PriceRate is the per-page rate for one combination of paper size,
+// colour mode and print mode ("single" or "double").
+type PriceRate struct {
+	PaperSize string      `json:"paper_size"`
+	ColorMode string      `json:"color_mode"`
+	PrintMode string      `json:"print_mode"`
+	PerPage   money.Paise `json:"per_page"`
+}
+
+// PriceCard is a shop's published pricing. Every change is stored as a new
+// version so that existing jobs keep a reference to the card they were priced with.
+type PriceCard struct {
+	ID        int         `json:"id,omitempty"`
+	ShopID    int         `json:"shop_id"`
+	Version   int         `json:"version"`
+	Rates     []PriceRate `json:"rates"`
+	MinOrder  money.Paise `json:"min_order"`
+	PerJobFee money.Paise `json:"per_job_fee"`
+	GSTRate   int         `json:"gst_rate"` // GST in percent, included in every price
+	CreatedAt time.Time   `json:"created_at,omitempty"`
+}
+
+type PriceCardRequest struct {
+	Rates     []PriceRate `json:"rates"`
+	MinOrder  money.Paise `json:"min_order"`
+	PerJobFee money.Paise `json:"per_job_fee"`
+	GSTRate   int         `json:"gst_rate"`
+}
+
+// ShopQuote is the price of a job at one shop
+type ShopQuote struct {
+	ShopID           int         `json:"shop_id"`
+	ShopName         string      `json:"shop_name"`
+	Distance         float64     `json:"distance"`
+	Available        bool        `json:"available"`
+	Open             bool        `json:"open"` // shop is open right now
+	TotalCost        money.Paise `json:"total_cost,omitempty"`
+	PriceCardVersion int         `json:"price_card_version"`
+	Reason           string      `json:"reason,omitempty"` // why the shop cannot print the job
+}
+
+type QuoteResponse struct {
+	StagedID  string      `json:"staged_id,omitempty"`
+	NumPages  int         `json:"num_pages"`
+	Copies    int         `json:"copies"`
+	PrintMode string      `json:"print_mode"`
+	ColorMode string      `json:"color_mode"`
+	PaperSize string      `json:"paper_size"`
+	Quotes    []ShopQuote `json:"quotes"`
+}
+
+// ScoreFactor is one part of a shop recommendation score
+type ScoreFactor struct {
+	Factor string  `json:"factor"` // "distance", "queue", "wait", "price" or "open"
+	Value  float64 `json:"value"`  // km, jobs ahead, minutes, rupees, or 1 if open
+	Score  float64 `json:"score"`  // 0 (worst) to 1 (best)
+	Weight float64 `json:"weight"`
+	Points float64 `json:"points"` // score × weight × 100
+}
+
+// ShopRecommendation is a shop's quote for a job, ranked by how good a
+// choice the shop is
+type ShopRecommendation struct {
+	ShopQuote
+	Rank                 int           `json:"rank,omitempty"` // 1 is best; omitted if the shop cannot print the job
+	QueueJobs            int           `json:"queue_jobs"`     // jobs waiting ahead of a new job
+	QueuePages           int           `json:"queue_pages"`    // pages (× copies) in those jobs
+	EstimatedWaitMinutes int           `json:"estimated_wait_minutes"`
+	Score                float64       `json:"score"` // 0 to 100, the sum of the breakdown points
+	Breakdown            []ScoreFactor `json:"breakdown,omitempty"`
+}
+
+type RecommendResponse struct {
+	StagedID        string               `json:"staged_id,omitempty"`
+	NumPages        int                  `json:"num_pages"`
+	Copies          int                  `json:"copies"`
+	PrintMode       string               `json:"print_mode"`
+	ColorMode       string               `json:"color_mode"`
+	PaperSize       string               `json:"paper_size"`
+	Recommendations []ShopRecommendation `json:"recommendations"`
+}
+
+// Refund records money owed back to a customer for a cancelled job
+type Refund struct {
+	ID        int         `json:"id"`
+	FileID    int         `json:"file_id"`
+	UserID    int         `json:"user_id"`
+	Amount    money.Paise `json:"amount"`
+	Reason    string      `json:"reason"`
+	Status    string      `json:"status"` // "pending", "paid", or "credited" back to the wallet
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// UserSummary is a user account as listed to admins
+type UserSummary struct {
+	ID                  int        `json:"id"`
+	Username            string     `json:"username"`
+	Role                string     `json:"role"`
+	Address             *string    `json:"address,omitempty"`
+	Lat                 *float64   `json:"lat,omitempty"`
+	Long                *float64   `json:"long,omitempty"`
+	ShopStatus          *string    `json:"shop_status,omitempty"` // shopkeepers only: "pending", "approved" or "rejected"
+	ShopRejectionReason *string    `json:"shop_rejection_reason,omitempty"`
+	SuspendedAt         *time.Time `json:"suspended_at,omitempty"`
+	SuspensionReason    *string    `json:"suspension_reason,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+}
+
+// ShopCapabilities describe what a shop's printers can print
+type ShopCapabilities struct {
+	Color      bool     `json:"color"`       // can print in color
+	Duplex     bool     `json:"duplex"`      // can print double-sided
+	PaperSizes []string `json:"paper_sizes"` // e.g. "A4", "A3"
+}
+
+// ShopDetails are the business details a shopkeeper submits for review
+type ShopDetails struct {
+	BusinessName string `json:"business_name"`
+	ContactPhone string `json:"contact_phone"`
+	ContactEmail string `json:"contact_email,omitempty"`
+	ShopCapabilities
+}
+
+// ShopApplicationRequest is a shopkeeper's re-submission of their application
+type ShopApplicationRequest struct {
+	ShopDetails
+	Address string   `json:"address"`
+	Lat     *float64 `json:"lat"`
+	Long    *float64 `json:"long"`
+}
+
+// ShopApplication is a shop registration together with its review state
+type ShopApplication struct {
+	ShopID   int    `json:"shop_id"`
+	Username string `json:"username"`
+	ShopDetails
+	Address         *string    `json:"address"`
+	Lat             *float64   `json:"lat"`
+	Long            *float64   `json:"long"`
+	Status          string     `json:"status"` // "pending", "approved" or "rejected"
+	RejectionReason *string    `json:"rejection_reason,omitempty"`
+	SubmittedAt     time.Time  `json:"submitted_at"`
+	ReviewedAt      *time.Time `json:"reviewed_at,omitempty"`
+}
+
+// OpeningHours is one period a shop is open on a day of the week.
+// Times are "HH:MM" in the shop's timezone; Close may be "24:00".
+type OpeningHours struct {
+	Day   string `json:"day"` // "mon" … "sun"
+	Open  string `json:"open"`
+	Close string `json:"close"`
+}
+
+// Holiday is a date on which a shop is closed all day
+type Holiday struct {
+	Date string `json:"date"` // "2006-01-02"
+	Note string `json:"note,omitempty"`
+}
+
+// ShopProfile is what customers see about a shop. A shop without opening
+// hours is treated as always open.
+type ShopProfile struct {
+	ShopID      int    `json:"shop_id"`
+	DisplayName string `json:"display_name"`
+	ShopCapabilities
+	Timezone     string         `json:"timezone"` // IANA name, e.g. "Asia/Kolkata"
+	OpeningHours []OpeningHours `json:"opening_hours"`
+	Holidays     []Holiday      `json:"holidays"`
+	Open         bool           `json:"open"`              // open right now
+	UPIVPA       string         `json:"upi_vpa,omitempty"` // UPI ID customers pay the shop at
+	GSTIN        string         `json:"gstin,omitempty"`   // GST registration printed on invoices
+}
+
+type ShopProfileRequest struct {
+	DisplayName string `json:"display_name"`
+	ShopCapabilities
+	Timezone     string         `json:"timezone"`
+	OpeningHours []OpeningHours `json:"opening_hours"`
+	Holidays     []Holiday      `json:"holidays"`
+	UPIVPA       string         `json:"upi_vpa"`
+	GSTIN        string         `json:"gstin"`
+}
+
+// ReasonRequest carries the reason for an admin action
+type ReasonRequest struct {
+	Reason string `json:"reason"`
+}
+
+// StatusChange is one row of a job's status history
+type StatusChange struct {
+	FromStatus *string   `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	ChangedBy  *int      `json:"changed_by"`
+	Note       *string   `json:"note,omitempty"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+// JobDetail is a job with its full status history, as shown to admins
+type JobDetail struct {
+	File
+	Customer string         `json:"customer"`
+	Shop     *string        `json:"shop,omitempty"`
+	Progress *string        `json:"progress,omitempty"`
+	History  []StatusChange `json:"history"`
+}
+
+// PlatformStats summarises the whole platform for admins
+type PlatformStats struct {
+	UsersByRole     map[string]int `json:"users_by_role"`
+	ShopsByStatus   map[string]int `json:"shops_by_status"`
+	SuspendedUsers  int            `json:"suspended_users"`
+	JobsByStatus    map[string]int `json:"jobs_by_status"`
+	JobsLast24h     int            `json:"jobs_last_24h"`
+	PagesPrinted    int            `json:"pages_printed"`
+	Revenue         money.Paise    `json:"revenue"`         // total_cost of printed and collected jobs
+	PendingRefunds  money.Paise    `json:"pending_refunds"` // sum of refunds not yet paid
+	ActiveQueueJobs int            `json:"active_queue_jobs"`
+}
+
+// WalletEntry is one line of a wallet statement
+type WalletEntry struct {
+	ID            int64       `json:"id"`
+	TransactionID int64       `json:"transaction_id"`
+	Kind          string      `json:"kind"`   // "topup", "job_payment", "job_settlement" or "job_refund"
+	Amount        money.Paise `json:"amount"` // positive for money in, negative for money out
+	BalanceAfter  money.Paise `json:"balance_after"`
+	FileID        *int        `json:"file_id,omitempty"`
+	Memo          *string     `json:"memo,omitempty"`
+	CreatedAt     time.Time   `json:"created_at"`
+}
+
+// Wallet is a wallet balance with the latest page of its statement
+type Wallet struct {
+	Balance    money.Paise   `json:"balance"`
+	Entries    []WalletEntry `json:"entries"`
+	NextBefore *int64        `json:"next_before,omitempty"` // pass as before= for the next page
+}
+
+// TopUpRequest adds money received outside the app to a customer wallet
+type TopUpRequest struct {
+	Amount money.Paise `json:"amount"`
+	Note   string      `json:"note"`
+}
+
+// PaymentIntent is an online payment for a job at the payment gateway
+type PaymentIntent struct {
+	ID                int         `json:"id"`
+	FileID            int         `json:"file_id"`
+	ProviderPaymentID string      `json:"provider_payment_id"`
+	Amount            money.Paise `json:"amount"`
+	Currency          string      `json:"currency"`
+	Status            string      `json:"status"` // "created", "succeeded", "failed" or "expired"
+	CheckoutURL       string      `json:"checkout_url,omitempty"`
+	CreatedAt         time.Time   `json:"created_at"`
+	CompletedAt       *time.Time  `json:"completed_at,omitempty"`
+}
+
+// UPIRequest asks a customer to pay for a job over UPI
+type UPIRequest struct {
+	FileID int         `json:"file_id"`
+	Payee  string      `json:"payee"`
+	VPA    string      `json:"upi_vpa"`
+	Amount money.Paise `json:"amount"`
+	Note   string      `json:"note"` // the job's unique code
+	URI    string      `json:"uri"`  // upi://pay link
+}
+
+// InvoiceLine is one charge on an invoice. Amount includes GST; TaxableValue
+// is the part of it that GST is charged on.
+type InvoiceLine struct {
+	Description  string      `json:"description"`
+	SAC          string      `json:"sac"` // services accounting code
+	Quantity     int         `json:"quantity"`
+	Rate         money.Paise `json:"rate,omitempty"`
+	Amount       money.Paise `json:"amount"`
+	TaxableValue money.Paise `json:"taxable_value"`
+}
+
+// Invoice is the tax invoice for a printed job, or a bill of supply if the
+// shop has no GSTIN. GST is split equally between CGST and SGST.
+type Invoice struct {
+	Number        string        `json:"number"`
+	ShopID        int           `json:"shop_id"`
+	FileID        int           `json:"file_id"`
+	IssuedAt      time.Time     `json:"issued_at"`
+	SellerName    string        `json:"seller_name"`
+	SellerAddress string        `json:"seller_address,omitempty"`
+	SellerGSTIN   string        `json:"seller_gstin,omitempty"`
+	BuyerName     string        `json:"buyer_name"`
+	BuyerGSTIN    string        `json:"buyer_gstin,omitempty"`
+	GSTRate       int           `json:"gst_rate"`
+	Lines         []InvoiceLine `json:"lines"`
+	TaxableValue  money.Paise   `json:"taxable_value"`
+	CGST          money.Paise   `json:"cgst"`
+	SGST          money.Paise   `json:"sgst"`
+	Total         money.Paise   `json:"total"`
+}
+
+// BillingDetails are printed on a customer's invoices. With no name the
+// invoice is made out to the username.
+type BillingDetails struct {
+	Name  string `json:"name"`
+	GSTIN string `json:"gstin"`
+}
@@ -0,0 +1,158 @@
+// Package money represents rupee amounts exactly, as whole paise.
+//
+// Amounts are stored in DECIMAL(10,2) columns and written to JSON as numbers
+// with two decimal places, so neither the database nor the API ever sees a
+// binary floating point value. Sums and multiples by whole numbers are
+// exact. The only rounding happens in MulRatio, used for percentages such as
+// discounts and tax, which rounds half away from zero to the nearest paisa.
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Paise is an amount of money in paise (1/100 of a rupee)
+type Paise int64
+
+// Rupee is one rupee
+const Rupee Paise = 100
+
+// MaxAmount is the largest amount a DECIMAL(10,2) column holds, ₹99,999,999.99
+const MaxAmount Paise = 99_999_999_99
+
+// ErrInvalid is returned for amounts that are malformed, have more than two
+// decimal places or lie outside ±MaxAmount
+var ErrInvalid = errors.New("invalid amount: use rupees with at most two decimal places, up to 99999999.99")
+
+// Rupees returns a whole number of rupees
+func Rupees(n int64) Paise {
+	return Paise(n) * Rupee
+}
+
+// Parse reads a decimal rupee amount such as "12", "12.5" or "-0.75".
+// Amounts with more than two decimal places are rejected rather than rounded,
+// as are amounts too large for a DECIMAL(10,2) column.
+func Parse(s string) (Paise, error) {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, frac, _ := strings.Cut(s, ".")
+	// Postgres may pad DECIMAL values with trailing zeros
+	frac = strings.TrimRight(frac, "0")
+	if whole == "" || len(frac) > 2 || strings.ContainsAny(whole+frac, "+-") {
+		return 0, ErrInvalid
+	}
+	rupees, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || rupees > int64(MaxAmount/Rupee) {
+		return 0, ErrInvalid
+	}
+	var paise int64
+	if frac != "" {
+		paise, err = strconv.ParseInt((frac + "0")[:2], 10, 64)
+		if err != nil {
+			return 0, ErrInvalid
+		}
+	}
+
+	p := Paise(rupees)*Rupee + Paise(paise)
+	if neg {
+		p = -p
+	}
+	return p, nil
+}
+
+// InRupees returns p as a floating point number of rupees, for scoring and
+// other approximate uses. Never use it to compute an amount.
+func (p Paise) InRupees() float64 {
+	return float64(p) / float64(Rupee)
+}
+
+// MulRatio returns p × num / den, rounded half away from zero to the
+// nearest paisa. 18% of p is p.MulRatio(18, 100).
+func (p Paise) MulRatio(num, den int64) Paise {
+	n := int64(p) * num
+	q, r := n/den, n%den
+	if 2*abs(r) >= abs(den) {
+		if (n < 0) != (den < 0) {
+			q--
+		} else {
+			q++
+		}
+	}
+	return Paise(q)
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// String formats p in rupees with two decimal places, e.g. "12.50"
+func (p Paise) String() string {
+	sign := ""
+	n := int64(p)
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, n/100, n%100)
+}
+
+// Format formats p for display, e.g. "₹12.50"
+func (p Paise) Format() string {
+	if p < 0 {
+		return "-₹" + (-p).String()
+	}
+	return "₹" + p.String()
+}
+
+// MarshalJSON writes p as a JSON number of rupees with two decimal places
+func (p Paise) MarshalJSON() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalJSON reads a JSON number (or numeric string) of rupees
+func (p *Paise) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" {
+		return nil
+	}
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*p = v
+	return nil
+}
+
+// Scan reads a DECIMAL column. pgx passes numeric values as text, which is parsed exactly.
+func (p *Paise) Scan(src any) error {
+	switch v := src.(type) {
+	case string:
+		parsed, err := Parse(v)
+		if err != nil {
+			return fmt.Errorf("scan money %q: %w", v, err)
+		}
+		*p = parsed
+	case []byte:
+		return p.Scan(string(v))
+	case int64:
+		*p = Rupees(v)
+	case nil:
+		*p = 0
+	default:
+		return fmt.Errorf("scan money: unsupported type %T", src)
+	}
+	return nil
+}
+
+// Value writes p as decimal text for DECIMAL columns
+func (p Paise) Value() (driver.Value, error) {
+	return p.String(), nil
+}
@@ -0,0 +1,121 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Paise
+		err  error
+	}{
+		{"12", 1200, nil},
+		{"12.5", 1250, nil},
+		{"12.50", 1250, nil},
+		{"12.500000", 1250, nil},
+		{"0.05", 5, nil},
+		{"-0.75", -75, nil},
+		{" 3.10 ", 310, nil},
+		{"99999999.99", MaxAmount, nil},
+		{"-99999999.99", -MaxAmount, nil},
+		{"100000000", 0, ErrInvalid},
+		{"-100000000.00", 0, ErrInvalid},
+		{"92233720368547758.07", 0, ErrInvalid},
+		{"99999999999999999999", 0, ErrInvalid},
+		{"12.345", 0, ErrInvalid},
+		{"", 0, ErrInvalid},
+		{".5", 0, ErrInvalid},
+		{"--1", 0, ErrInvalid},
+		{"+1", 0, ErrInvalid},
+		{"1.-5", 0, ErrInvalid},
+		{"1e3", 0, ErrInvalid},
+		{"abc", 0, ErrInvalid},
+	}
+	for _, test := range tests {
+		got, err := Parse(test.in)
+		if got != test.want || !errors.Is(err, test.err) {
+			t.Errorf("Parse(%q) = %d, %v; want %d, %v", test.in, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := map[Paise]string{
+		0:          "0.00",
+		5:          "0.05",
+		1250:       "12.50",
+		-75:        "-0.75",
+		-1200:      "-12.00",
+		MaxAmount:  "99999999.99",
+		-MaxAmount: "-99999999.99",
+	}
+	for p, want := range tests {
+		if got := p.String(); got != want {
+			t.Errorf("Paise(%d).String() = %q, want %q", int64(p), got, want)
+		}
+	}
+	if got := Paise(-75).Format(); got != "-₹0.75" {
+		t.Errorf("Format = %q", got)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	type body struct {
+		Amount Paise  `json:"amount"`
+		Fee    *Paise `json:"fee"`
+	}
+
+	data, err := json.Marshal(body{Amount: -1250})
+	if err != nil || string(data) != `{"amount":-12.50,"fee":null}` {
+		t.Errorf("Marshal = %s, %v", data, err)
+	}
+
+	tests := []struct {
+		in   string
+		want Paise
+		ok   bool
+	}{
+		{`{"amount": 12.5}`, 1250, true},
+		{`{"amount": "12.50"}`, 1250, true},
+		{`{"amount": -0.75}`, -75, true},
+		{`{"amount": null}`, 0, true},
+		{`{"amount": 12.345}`, 0, false},
+		{`{"amount": 1e3}`, 0, false},
+		{`{"amount": 100000000}`, 0, false},
+	}
+	for _, test := range tests {
+		var b body
+		err := json.Unmarshal([]byte(test.in), &b)
+		if (err == nil) != test.ok || b.Amount != test.want {
+			t.Errorf("Unmarshal(%s) = %d, %v", test.in, b.Amount, err)
+		}
+	}
+}
+
+func TestMulRatio(t *testing.T) {
+	tests := []struct {
+		p        Paise
+		num, den int64
+		want     Paise
+	}{
+		{1000, 18, 100, 180},
+		{1000, 18, 118, 153}, // 152.54
+		{25, 1, 2, 13},       // 12.5 rounds up
+		{-25, 1, 2, -13},     // -12.5 rounds away from zero
+		{25, -1, 2, -13},     // a negative ratio rounds the same way
+		{-25, -1, 2, 13},
+		{15, 1, 10, 2}, // 1.5
+		{14, 1, 10, 1}, // 1.4
+		{-14, 1, 10, -1},
+		{0, 18, 100, 0},
+		{MaxAmount, 28, 128, 2187500000}, // 2187499999.78 rounds up
+	}
+	for _, test := range tests {
+		if got := test.p.MulRatio(test.num, test.den); got != test.want {
+			t.Errorf("Paise(%d).MulRatio(%d, %d) = %d, want %d", int64(test.p), test.num, test.den, int64(got), int64(test.want))
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// HTTPProvider talks to a payment gateway over its REST API:
+//
+//	POST /v1/payments       {"amount", "currency", "reference"} → Payment
+//	GET  /v1/payments/{id}  → Payment
+//
+// Requests are authenticated with "Authorization: Bearer <API key>". The
+// mock gateway in package mock serves the same API.
+type HTTPProvider struct {
+	BaseURL string
+	APIKey  string
+	Client  *http.Client
+}
+
+// NewHTTPProvider returns a provider for the gateway at baseURL
+func NewHTTPProvider(baseURL, apiKey string) *HTTPProvider {
+	return &HTTPProvider{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		APIKey:  apiKey,
+		Client:  &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (p *HTTPProvider) do(ctx context.Context, method, path string, body any) (Payment, error) {
+	var payment Payment
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return payment, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.BaseURL+path, reader)
+	if err != nil {
+		return payment, err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return payment, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return payment, fmt.Errorf("payment gateway: %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	err = json.NewDecoder(resp.Body).Decode(&payment)
+	return payment, err
+}
+
+// Create starts a payment
+func (p *HTTPProvider) Create(ctx context.Context, amount int64, currency, reference string) (Payment, error) {
+	return p.do(ctx, http.MethodPost, "/v1/payments", map[string]any{
+		"amount":    amount,
+		"currency":  currency,
+		"reference": reference,
+	})
+}
+
+// Get returns the current state of a payment
+func (p *HTTPProvider) Get(ctx context.Context, id string) (Payment, error) {
+	return p.do(ctx, http.MethodGet, "/v1/payments/"+url.PathEscape(id), nil)
+}
@@ -0,0 +1,248 @@
+// Package mock is an in-memory payment gateway that serves the API used by
+// payments.HTTPProvider and sends signed webhooks, so the whole online
+// payment flow runs locally and in tests without network access. Run it
+// with httptest.NewServer(mock.New(...)) or as cmd/mockpay.
+package mock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/internal/payments"
+)
+
+// Server is the mock gateway
+type Server struct {
+	APIKey     string
+	Secret     []byte // webhook signing secret
+	WebhookURL string // where webhooks are sent; empty sends none
+	PublicURL  string // base of checkout URLs
+
+	// Client sends webhooks
+	Client *http.Client
+
+	mu       sync.Mutex
+	mux      *http.ServeMux
+	seq      int
+	payments map[string]*payments.Payment
+	byRef    map[string]string         // reference → payment ID
+	events   map[string]payments.Event // last event sent for each payment
+}
+
+// New returns a mock gateway. Checkout pages link to publicURL.
+func New(apiKey string, secret []byte, webhookURL, publicURL string) *Server {
+	s := &Server{
+		APIKey:     apiKey,
+		Secret:     secret,
+		WebhookURL: webhookURL,
+		PublicURL:  strings.TrimSuffix(publicURL, "/"),
+		Client:     &http.Client{Timeout: 10 * time.Second},
+		payments:   make(map[string]*payments.Payment),
+		byRef:      make(map[string]string),
+		events:     make(map[string]payments.Event),
+	}
+
+	s.mux = http.NewServeMux()
+	// Gateway API
+	s.mux.HandleFunc("POST /v1/payments", s.authorized(s.create))
+	s.mux.HandleFunc("GET /v1/payments/{id}", s.authorized(s.get))
+	// Customer checkout
+	s.mux.HandleFunc("GET /checkout/{id}", s.checkout)
+	s.mux.HandleFunc("POST /checkout/{id}/{outcome}", s.complete)
+	// Test controls: resend the last webhook of a payment, as gateways do on retry
+	s.mux.HandleFunc("POST /mock/payments/{id}/resend", s.resend)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+s.APIKey {
+			http.Error(w, "invalid API key", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) create(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Amount    int64  `json:"amount"`
+		Currency  string `json:"currency"`
+		Reference string `json:"reference"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Amount <= 0 || req.Currency == "" {
+		http.Error(w, "amount and currency are required", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The same reference returns the payment already created for it
+	if id, ok := s.byRef[req.Reference]; ok && req.Reference != "" {
+		writeJSON(w, http.StatusOK, s.payments[id])
+		return
+	}
+
+	s.seq++
+	id := fmt.Sprintf("pay_%06d", s.seq)
+	p := &payments.Payment{
+		ID:          id,
+		Status:      payments.Created,
+		Amount:      req.Amount,
+		Currency:    req.Currency,
+		Reference:   req.Reference,
+		CheckoutURL: s.PublicURL + "/checkout/" + id,
+	}
+	s.payments[id] = p
+	if req.Reference != "" {
+		s.byRef[req.Reference] = id
+	}
+	writeJSON(w, http.StatusCreated, p)
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	p, ok := s.payments[r.PathValue("id")]
+	var payment payments.Payment
+	if ok {
+		payment = *p
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		http.Error(w, "payment not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, payment)
+}
+
+func (s *Server) checkout(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	p, ok := s.payments[r.PathValue("id")]
+	var payment payments.Payment
+	if ok {
+		payment = *p
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		http.Error(w, "payment not found", http.StatusNotFound)
+		return
+	}
+
+	id := html.EscapeString(payment.ID)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, `<!doctype html><title>Mock checkout</title>
+<h1>Pay ₹%d.%02d</h1><p>Payment %s for %s: %s</p>
+<form method="post" action="/checkout/%s/succeed"><button>Pay</button></form>
+<form method="post" action="/checkout/%s/fail"><button>Decline</button></form>`,
+		payment.Amount/100, payment.Amount%100, id, html.EscapeString(payment.Reference), payment.Status, id, id)
+}
+
+// complete settles a payment as the customer would at checkout and sends
+// the webhook. outcome is "succeed", "fail", or "silent-succeed" and
+// "silent-fail", which settle the payment without sending a webhook, as
+// when a webhook is lost.
+func (s *Server) complete(w http.ResponseWriter, r *http.Request) {
+	outcome, silent := strings.CutPrefix(r.PathValue("outcome"), "silent-")
+	var status payments.Status
+	switch outcome {
+	case "succeed":
+		status = payments.Succeeded
+	case "fail":
+		status = payments.Failed
+	default:
+		http.Error(w, "outcome must be succeed or fail", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	p, ok := s.payments[r.PathValue("id")]
+	if !ok {
+		s.mu.Unlock()
+		http.Error(w, "payment not found", http.StatusNotFound)
+		return
+	}
+	if p.Status != payments.Created {
+		s.mu.Unlock()
+		http.Error(w, "payment already "+string(p.Status), http.StatusConflict)
+		return
+	}
+	p.Status = status
+	s.seq++
+	event := payments.Event{
+		ID:      fmt.Sprintf("evt_%06d", s.seq),
+		Type:    "payment." + string(status),
+		Payment: *p,
+	}
+	s.events[p.ID] = event
+	s.mu.Unlock()
+
+	if !silent {
+		if err := s.Send(event); err != nil {
+			log.Printf("mock gateway: webhook for %s failed: %v", event.Payment.ID, err)
+		}
+	}
+	writeJSON(w, http.StatusOK, event.Payment)
+}
+
+func (s *Server) resend(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	event, ok := s.events[r.PathValue("id")]
+	s.mu.Unlock()
+
+	if !ok {
+		http.Error(w, "no event sent for this payment", http.StatusNotFound)
+		return
+	}
+	if err := s.Send(event); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, http.StatusOK, event)
+}
+
+// Send delivers a signed webhook for event to WebhookURL
+func (s *Server) Send(event payments.Event) error {
+	if s.WebhookURL == "" {
+		return nil
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(payments.SignatureHeader, payments.Sign(s.Secret, time.Now(), body))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package mock_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend/internal/payments"
+	"backend/internal/payments/mock"
+)
+
+func TestGateway(t *testing.T) {
+	secret := []byte("whsec_test")
+	received := make(chan payments.Event, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		event, err := payments.VerifyWebhook(secret, r.Header.Get(payments.SignatureHeader), body, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		received <- event
+	}))
+	defer hook.Close()
+
+	gateway := mock.New("key_test", secret, hook.URL, "")
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+	gateway.PublicURL = server.URL
+
+	ctx := context.Background()
+	provider := payments.NewHTTPProvider(server.URL, "key_test")
+	p, err := provider.Create(ctx, 1250, payments.Currency, "file-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != payments.Created || p.Amount != 1250 || p.CheckoutURL != server.URL+"/checkout/"+p.ID {
+		t.Errorf("created %+v", p)
+	}
+
+	again, err := provider.Create(ctx, 1250, payments.Currency, "file-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != p.ID {
+		t.Errorf("retry with the same reference created %s, want %s", again.ID, p.ID)
+	}
+
+	if _, err := payments.NewHTTPProvider(server.URL, "wrong").Get(ctx, p.ID); err == nil {
+		t.Error("Get with a wrong API key succeeded")
+	}
+
+	resp, err := http.Post(server.URL+"/checkout/"+p.ID+"/succeed", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("checkout: %s", resp.Status)
+	}
+
+	select {
+	case event := <-received:
+		if event.Type != "payment.succeeded" || event.Payment.ID != p.ID {
+			t.Errorf("webhook %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook")
+	}
+
+	got, err := provider.Get(ctx, p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != payments.Succeeded {
+		t.Errorf("status %s after checkout, want succeeded", got.Status)
+	}
+
+	// A settled payment cannot be completed again
+	resp, err = http.Post(server.URL+"/checkout/"+p.ID+"/fail", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("second checkout: %s, want 409", resp.Status)
+	}
+}
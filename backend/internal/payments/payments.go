@@ -0,0 +1,144 @@
+// Package payments takes online payments for print jobs through a payment
+// gateway, behind a provider-neutral interface. Outcomes arrive as signed
+// webhooks and are confirmed by polling when a webhook never comes.
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Status is the state of a payment at the gateway
+type Status string
+
+const (
+	Created   Status = "created"   // waiting for the customer to pay
+	Succeeded Status = "succeeded" // money received
+	Failed    Status = "failed"    // declined or abandoned at the gateway
+
+	// Expired is never reported by the gateway. It marks a payment given up
+	// on locally because the customer did not complete it in time.
+	Expired Status = "expired"
+)
+
+// Currency is the only currency jobs are priced in
+const Currency = "INR"
+
+// Payment is a payment as the gateway reports it. Gateway amounts are
+// integers in paise, unlike the rupee amounts of this API.
+type Payment struct {
+	ID          string `json:"id"`
+	Status      Status `json:"status"`
+	Amount      int64  `json:"amount"`
+	Currency    string `json:"currency"`
+	Reference   string `json:"reference"`
+	CheckoutURL string `json:"checkout_url,omitempty"`
+}
+
+// Event is a webhook notification that a payment changed status. Event IDs
+// are unique; the gateway may deliver the same event more than once.
+type Event struct {
+	ID      string  `json:"id"`
+	Type    string  `json:"type"` // "payment.succeeded" or "payment.failed"
+	Payment Payment `json:"payment"`
+}
+
+// Provider is a payment gateway
+type Provider interface {
+	// Create starts a payment the customer completes at CheckoutURL. The
+	// reference is echoed back in webhooks and makes retries idempotent.
+	Create(ctx context.Context, amount int64, currency, reference string) (Payment, error)
+	// Get returns the current state of a payment
+	Get(ctx context.Context, id string) (Payment, error)
+}
+
+// Gateway is the configured payment provider, or nil if online payments are disabled
+var Gateway Provider
+
+// WebhookSecret is the shared secret webhooks are signed with
+var WebhookSecret []byte
+
+// Init configures Gateway from the environment: PAYMENT_API_URL,
+// PAYMENT_API_KEY and PAYMENT_WEBHOOK_SECRET. Without PAYMENT_API_URL
+// online payments are disabled.
+func Init() {
+	url := os.Getenv("PAYMENT_API_URL")
+	if url == "" {
+		fmt.Println("Online payments disabled (PAYMENT_API_URL not set)")
+		return
+	}
+	secret := os.Getenv("PAYMENT_WEBHOOK_SECRET")
+	if secret == "" {
+		log.Fatal("PAYMENT_WEBHOOK_SECRET is required when PAYMENT_API_URL is set")
+	}
+	Gateway = NewHTTPProvider(url, os.Getenv("PAYMENT_API_KEY"))
+	WebhookSecret = []byte(secret)
+	fmt.Printf("Taking online payments through %s\n", url)
+}
+
+// SignatureHeader carries the webhook signature
+const SignatureHeader = "Payment-Signature"
+
+// signatureTolerance is how old a signed webhook may be, limiting replays
+const signatureTolerance = 5 * time.Minute
+
+// ErrBadSignature is returned for a webhook that is unsigned, wrongly
+// signed or too old
+var ErrBadSignature = errors.New("invalid webhook signature")
+
+func mac(secret []byte, timestamp string, body []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+// Sign returns the signature header value for a webhook body:
+// "t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<body>">"
+func Sign(secret []byte, at time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac(secret, timestamp, body))
+}
+
+// VerifyWebhook checks a webhook's signature and age and decodes its event
+func VerifyWebhook(secret []byte, header string, body []byte, now time.Time) (Event, error) {
+	var event Event
+	var timestamp, signature string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signature = value
+		}
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return event, ErrBadSignature
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > signatureTolerance || age < -signatureTolerance {
+		return event, ErrBadSignature
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(got, mac(secret, timestamp, body)) {
+		return event, ErrBadSignature
+	}
+
+	if err := json.Unmarshal(body, &event); err != nil {
+		return event, err
+	}
+	return event, nil
+}
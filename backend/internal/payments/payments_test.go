@@ -0,0 +1,47 @@
+package payments
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerifyWebhook(t *testing.T) {
+	secret := []byte("whsec_test")
+	body := []byte(`{"id":"evt_1","type":"payment.succeeded","payment":{"id":"pay_1","status":"succeeded","amount":1250,"currency":"INR"}}`)
+	now := time.Unix(1_700_000_000, 0)
+
+	tests := []struct {
+		name   string
+		header string
+		body   []byte
+		ok     bool
+	}{
+		{"valid", Sign(secret, now, body), body, true},
+		{"valid, clock skew", Sign(secret, now.Add(4*time.Minute), body), body, true},
+		{"wrong secret", Sign([]byte("other"), now, body), body, false},
+		{"tampered body", Sign(secret, now, body), []byte(`{"id":"evt_1","type":"payment.succeeded","payment":{"id":"pay_1","status":"succeeded","amount":1,"currency":"INR"}}`), false},
+		{"stale", Sign(secret, now.Add(-6*time.Minute), body), body, false},
+		{"from the future", Sign(secret, now.Add(6*time.Minute), body), body, false},
+		{"unsigned", "", body, false},
+		{"no timestamp", "v1=00", body, false},
+		{"signature not hex", "t=1700000000,v1=zz", body, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := VerifyWebhook(secret, tt.header, tt.body, now)
+			if !tt.ok {
+				if !errors.Is(err, ErrBadSignature) {
+					t.Fatalf("got %v, want ErrBadSignature", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if event.ID != "evt_1" || event.Payment.Status != Succeeded || event.Payment.Amount != 1250 {
+				t.Errorf("decoded %+v", event)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package printer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// DirPrinter "prints" by copying documents into a directory. It is meant for
+// testing the agent without a printer.
+type DirPrinter struct {
+	Dir string
+}
+
+func (p *DirPrinter) Print(ctx context.Context, job Job, path string) error {
+	if err := os.MkdirAll(p.Dir, 0755); err != nil {
+		return err
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	name := fmt.Sprintf("%d-%s", job.ID, filepath.Base(job.Name))
+	dst, err := os.Create(filepath.Join(p.Dir, name))
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
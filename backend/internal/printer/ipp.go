@@ -0,0 +1,182 @@
+package printer
+
+import (
+	"backend/internal/ipp"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// IPPPrinter submits documents with an IPP Print-Job request and polls
+// Get-Job-Attributes until the printer reports the job as completed.
+type IPPPrinter struct {
+	URI          string // ipp://host[:port]/path
+	PollInterval time.Duration
+
+	endpoint  string // http://host:port/path
+	requestID atomic.Uint32
+	client    *http.Client
+}
+
+func NewIPPPrinter(uri string) (*IPPPrinter, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "ipp":
+		u.Scheme = "http"
+	case "ipps":
+		u.Scheme = "https"
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("unsupported printer URI %q", uri)
+	}
+	if u.Port() == "" {
+		u.Host += ":631"
+	}
+
+	return &IPPPrinter{
+		URI:          uri,
+		PollInterval: 2 * time.Second,
+		endpoint:     u.String(),
+		client:       &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+func (p *IPPPrinter) Print(ctx context.Context, job Job, path string) error {
+	doc, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer doc.Close()
+
+	req := ipp.NewRequest(ipp.OpPrintJob, p.requestID.Add(1))
+	req.Add(ipp.TagOperation,
+		ipp.URI("printer-uri", p.URI),
+		ipp.Name("requesting-user-name", "qprint-agent"),
+		ipp.Name("job-name", job.Name),
+		ipp.MimeType("document-format", "application/pdf"))
+
+	sides := "one-sided"
+	if job.Duplex {
+		sides = "two-sided-long-edge"
+	}
+	colorMode := "monochrome"
+	if job.Color {
+		colorMode = "color"
+	}
+	req.Add(ipp.TagJob,
+		ipp.Integer("copies", max(job.Copies, 1)),
+		ipp.Keyword("sides", sides),
+		ipp.Keyword("media", ipp.MediaName(job.PaperSize)),
+		ipp.Keyword("print-color-mode", colorMode))
+
+	resp, err := p.do(ctx, req, doc)
+	if err != nil {
+		return err
+	}
+
+	jobID, ok := resp.Int(ipp.TagJob, "job-id")
+	if !ok {
+		return fmt.Errorf("printer did not return a job-id")
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.cancel(jobID)
+			return ctx.Err()
+		case <-time.After(p.PollInterval):
+		}
+
+		state, reasons, err := p.jobState(ctx, jobID)
+		if err != nil {
+			return err
+		}
+		switch state {
+		case ipp.JobCompleted:
+			return nil
+		case ipp.JobCanceled, ipp.JobAborted:
+			return fmt.Errorf("printer %s the job: %s", map[int]string{
+				ipp.JobCanceled: "cancelled",
+				ipp.JobAborted:  "aborted",
+			}[state], strings.Join(reasons, ", "))
+		}
+	}
+}
+
+func (p *IPPPrinter) jobState(ctx context.Context, jobID int) (int, []string, error) {
+	req := ipp.NewRequest(ipp.OpGetJobAttributes, p.requestID.Add(1))
+	req.Add(ipp.TagOperation,
+		ipp.URI("printer-uri", p.URI),
+		ipp.Integer("job-id", jobID),
+		ipp.Keyword("requested-attributes", "job-state", "job-state-reasons"))
+
+	resp, err := p.do(ctx, req, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	state, ok := resp.Int(ipp.TagJob, "job-state")
+	if !ok {
+		return 0, nil, fmt.Errorf("printer did not return job-state")
+	}
+	return state, resp.Strings(ipp.TagJob, "job-state-reasons"), nil
+}
+
+func (p *IPPPrinter) cancel(jobID int) {
+	req := ipp.NewRequest(ipp.OpCancelJob, p.requestID.Add(1))
+	req.Add(ipp.TagOperation,
+		ipp.URI("printer-uri", p.URI),
+		ipp.Integer("job-id", jobID))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	p.do(ctx, req, nil)
+}
+
+func (p *IPPPrinter) do(ctx context.Context, req *ipp.Message, doc io.Reader) (*ipp.Message, error) {
+	var body bytes.Buffer
+	if err := req.Encode(&body); err != nil {
+		return nil, err
+	}
+
+	var payload io.Reader = &body
+	if doc != nil {
+		payload = io.MultiReader(&body, doc)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, payload)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/ipp")
+
+	httpResp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("printer returned HTTP %d", httpResp.StatusCode)
+	}
+
+	resp, err := ipp.Decode(httpResp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Code >= 0x0100 {
+		return nil, &ipp.StatusError{Code: resp.Code, Message: resp.String(ipp.TagOperation, "status-message")}
+	}
+	return resp, nil
+}
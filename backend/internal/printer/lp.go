@@ -0,0 +1,78 @@
+package printer
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LPPrinter prints through the CUPS lp command and waits for the job to
+// leave the queue, then checks that CUPS recorded it as completed.
+type LPPrinter struct {
+	Destination  string
+	PollInterval time.Duration
+}
+
+var lpRequestID = regexp.MustCompile(`request id is (\S+)`)
+
+func (p *LPPrinter) Print(ctx context.Context, job Job, path string) error {
+	args := []string{"-n", strconv.Itoa(max(job.Copies, 1)), "-t", job.Name, "-o", "media=" + job.PaperSize}
+	if p.Destination != "" {
+		args = append(args, "-d", p.Destination)
+	}
+	if job.Duplex {
+		args = append(args, "-o", "sides=two-sided-long-edge")
+	} else {
+		args = append(args, "-o", "sides=one-sided")
+	}
+	if job.Color {
+		args = append(args, "-o", "print-color-mode=color")
+	} else {
+		args = append(args, "-o", "print-color-mode=monochrome")
+	}
+	args = append(args, path)
+
+	out, err := exec.CommandContext(ctx, "lp", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("lp failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	match := lpRequestID.FindStringSubmatch(string(out))
+	if match == nil {
+		return fmt.Errorf("unexpected lp output: %s", strings.TrimSpace(string(out)))
+	}
+	requestID := match[1]
+
+	interval := p.PollInterval
+	if interval == 0 {
+		interval = 2 * time.Second
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			exec.Command("cancel", requestID).Run()
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+
+		// lpstat lists the request while it is still pending or printing
+		out, _ := exec.CommandContext(ctx, "lpstat", "-W", "not-completed", "-o").Output()
+		if strings.Contains(string(out), requestID+" ") {
+			continue
+		}
+
+		out, err := exec.CommandContext(ctx, "lpstat", "-W", "completed", "-o").Output()
+		if err != nil {
+			return fmt.Errorf("lpstat failed: %w", err)
+		}
+		if !strings.Contains(string(out), requestID+" ") {
+			return fmt.Errorf("print job %s was cancelled or aborted", requestID)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,42 @@
+// Package printer sends documents to a physical or test printer on behalf of
+// the shop print agent.
+package printer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Job describes how a document should be printed
+type Job struct {
+	ID        int
+	Name      string
+	Copies    int
+	Duplex    bool
+	Color     bool
+	PaperSize string
+}
+
+// Printer prints a PDF stored at path. Print returns only once the printer
+// reports that the job completed, or an error if it failed.
+type Printer interface {
+	Print(ctx context.Context, job Job, path string) error
+}
+
+// New creates a printer backend by name: "ipp", "raw", "lp" or "dir".
+// target is the printer URI, host:port, CUPS destination or directory respectively.
+func New(backend, target string) (Printer, error) {
+	switch strings.ToLower(backend) {
+	case "ipp":
+		return NewIPPPrinter(target)
+	case "raw":
+		return &RawPrinter{Address: target}, nil
+	case "lp":
+		return &LPPrinter{Destination: target}, nil
+	case "dir":
+		return &DirPrinter{Dir: target}, nil
+	default:
+		return nil, fmt.Errorf("unknown printer backend %q", backend)
+	}
+}
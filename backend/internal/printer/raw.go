@@ -0,0 +1,55 @@
+package printer
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// RawPrinter sends documents to a printer's raw TCP port (usually 9100).
+// The printer must understand PDF directly. The protocol has no status
+// channel, so a job counts as printed once the printer accepts all data and
+// the connection closes cleanly.
+type RawPrinter struct {
+	Address string
+}
+
+func (p *RawPrinter) Print(ctx context.Context, job Job, path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", p.Address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(10 * time.Minute))
+	}
+
+	// Raw printing has no copies option, so the document is sent once per copy
+	for i := 0; i < max(job.Copies, 1); i++ {
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.Copy(conn, src); err != nil {
+			return err
+		}
+	}
+
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.CloseWrite()
+		// Wait for the printer to close its side, which it does once the data is consumed
+		io.Copy(io.Discard, conn)
+	}
+	return nil
+}
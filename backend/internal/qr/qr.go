@@ -0,0 +1,482 @@
+// Package qr encodes text as a QR code (ISO/IEC 18004) and renders it as a
+// PNG. It supports byte mode at error correction level M in versions 1–13,
+// which holds up to 331 bytes: plenty for payment links.
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// ErrTooLong is returned for text that does not fit in the largest supported version
+var ErrTooLong = errors.New("text too long for a QR code")
+
+// Code is an encoded QR code. Modules are indexed [row][column]; true is dark.
+type Code struct {
+	Size    int
+	Modules [][]bool
+}
+
+// version holds the level M block structure of one QR version
+type version struct {
+	ecPerBlock int
+	groups     [][2]int // {blocks, data codewords per block}
+	align      []int    // alignment pattern centres
+}
+
+var versions = []version{
+	1:  {10, [][2]int{{1, 16}}, nil},
+	2:  {16, [][2]int{{1, 28}}, []int{6, 18}},
+	3:  {26, [][2]int{{1, 44}}, []int{6, 22}},
+	4:  {18, [][2]int{{2, 32}}, []int{6, 26}},
+	5:  {24, [][2]int{{2, 43}}, []int{6, 30}},
+	6:  {16, [][2]int{{4, 27}}, []int{6, 34}},
+	7:  {18, [][2]int{{4, 31}}, []int{6, 22, 38}},
+	8:  {22, [][2]int{{2, 38}, {2, 39}}, []int{6, 24, 42}},
+	9:  {22, [][2]int{{3, 36}, {2, 37}}, []int{6, 26, 46}},
+	10: {26, [][2]int{{4, 43}, {1, 44}}, []int{6, 28, 50}},
+	11: {30, [][2]int{{1, 50}, {4, 51}}, []int{6, 30, 54}},
+	12: {22, [][2]int{{6, 36}, {2, 37}}, []int{6, 32, 58}},
+	13: {22, [][2]int{{8, 37}, {1, 38}}, []int{6, 34, 62}},
+}
+
+func (v version) dataCodewords() int {
+	n := 0
+	for _, g := range v.groups {
+		n += g[0] * g[1]
+	}
+	return n
+}
+
+// Encode encodes text in the smallest version that holds it
+func Encode(text string) (*Code, error) {
+	data := []byte(text)
+	for ver := 1; ver < len(versions); ver++ {
+		countBits := 8
+		if ver >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) <= 8*versions[ver].dataCodewords() {
+			return build(ver, encodeData(data, countBits, versions[ver].dataCodewords())), nil
+		}
+	}
+	return nil, ErrTooLong
+}
+
+// bitWriter appends bits most significant first
+type bitWriter struct {
+	buf []byte
+	n   int
+}
+
+func (w *bitWriter) write(value, bits int) {
+	for i := bits - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if value>>i&1 == 1 {
+			w.buf[w.n/8] |= 0x80 >> (w.n % 8)
+		}
+		w.n++
+	}
+}
+
+// encodeData builds the byte mode data codewords, padded to capacity
+func encodeData(data []byte, countBits, capacity int) []byte {
+	var w bitWriter
+	w.write(0b0100, 4) // byte mode
+	w.write(len(data), countBits)
+	for _, b := range data {
+		w.write(int(b), 8)
+	}
+	w.write(0, min(4, 8*capacity-w.n)) // terminator
+	if w.n%8 != 0 {
+		w.write(0, 8-w.n%8)
+	}
+	for pad := 0; len(w.buf) < capacity; pad++ {
+		w.buf = append(w.buf, [2]byte{0xEC, 0x11}[pad%2])
+	}
+	return w.buf
+}
+
+// GF(256) arithmetic with the QR polynomial x^8 + x^4 + x^3 + x^2 + 1
+var gfExp, gfLog [256]int
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = x
+		gfLog[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+	gfExp[255] = gfExp[0]
+}
+
+func gfMul(a, b int) int {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[(gfLog[a]+gfLog[b])%255]
+}
+
+// errorCorrection returns the Reed-Solomon codewords for one block
+func errorCorrection(data []byte, n int) []byte {
+	// Generator polynomial (x - α^0)(x - α^1)…(x - α^(n-1)), highest degree first
+	gen := []int{1}
+	for i := 0; i < n; i++ {
+		next := make([]int, len(gen)+1)
+		for j, c := range gen {
+			next[j] ^= c
+			next[j+1] ^= gfMul(c, gfExp[i])
+		}
+		gen = next
+	}
+
+	rem := make([]int, n)
+	for _, b := range data {
+		factor := int(b) ^ rem[0]
+		copy(rem, rem[1:])
+		rem[n-1] = 0
+		for i := range rem {
+			rem[i] ^= gfMul(gen[i+1], factor)
+		}
+	}
+	ec := make([]byte, n)
+	for i, c := range rem {
+		ec[i] = byte(c)
+	}
+	return ec
+}
+
+// interleave splits data into blocks, adds error correction and
+// interleaves the codewords in transmission order
+func interleave(v version, data []byte) []byte {
+	var blocks, ecBlocks [][]byte
+	for _, g := range v.groups {
+		for i := 0; i < g[0]; i++ {
+			block := data[:g[1]]
+			data = data[g[1]:]
+			blocks = append(blocks, block)
+			ecBlocks = append(ecBlocks, errorCorrection(block, v.ecPerBlock))
+		}
+	}
+
+	var out []byte
+	longest := v.groups[len(v.groups)-1][1]
+	for i := 0; i < longest; i++ {
+		for _, b := range blocks {
+			if i < len(b) {
+				out = append(out, b[i])
+			}
+		}
+	}
+	for i := 0; i < v.ecPerBlock; i++ {
+		for _, b := range ecBlocks {
+			out = append(out, b[i])
+		}
+	}
+	return out
+}
+
+// matrix is a code under construction. Function modules (finders, timing,
+// alignment, format and version information) are never masked.
+type matrix struct {
+	size     int
+	dark     [][]bool
+	function [][]bool
+}
+
+func newMatrix(size int) *matrix {
+	m := &matrix{size: size, dark: make([][]bool, size), function: make([][]bool, size)}
+	for i := range m.dark {
+		m.dark[i] = make([]bool, size)
+		m.function[i] = make([]bool, size)
+	}
+	return m
+}
+
+func (m *matrix) set(row, col int, dark bool) {
+	m.dark[row][col] = dark
+	m.function[row][col] = true
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func build(ver int, data []byte) *Code {
+	v := versions[ver]
+	m := newMatrix(17 + 4*ver)
+	m.drawFunctionPatterns(ver)
+	m.drawData(interleave(v, data))
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		m.applyMask(mask)
+		m.drawFormat(mask)
+		if p := m.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		m.applyMask(mask) // masking twice restores the data
+	}
+	m.applyMask(best)
+	m.drawFormat(best)
+
+	return &Code{Size: m.size, Modules: m.dark}
+}
+
+func (m *matrix) drawFunctionPatterns(ver int) {
+	for i := 0; i < m.size; i++ {
+		m.set(6, i, i%2 == 0)
+		m.set(i, 6, i%2 == 0)
+	}
+
+	// Finder patterns with their separators
+	for _, c := range [][2]int{{3, 3}, {3, m.size - 4}, {m.size - 4, 3}} {
+		for dr := -4; dr <= 4; dr++ {
+			for dc := -4; dc <= 4; dc++ {
+				r, col := c[0]+dr, c[1]+dc
+				if r < 0 || r >= m.size || col < 0 || col >= m.size {
+					continue
+				}
+				dist := max(abs(dr), abs(dc))
+				m.set(r, col, dist != 2 && dist != 4)
+			}
+		}
+	}
+
+	// Alignment patterns, except where they would overlap a finder
+	align := versions[ver].align
+	last := len(align) - 1
+	for i, r := range align {
+		for j, c := range align {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dr := -2; dr <= 2; dr++ {
+				for dc := -2; dc <= 2; dc++ {
+					m.set(r+dr, c+dc, max(abs(dr), abs(dc)) != 1)
+				}
+			}
+		}
+	}
+
+	// Reserve the format areas; drawFormat fills them in
+	m.drawFormat(0)
+
+	if ver >= 7 {
+		rem := ver
+		for i := 0; i < 12; i++ {
+			rem = rem<<1 ^ (rem>>11)*0x1F25
+		}
+		bits := ver<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := bits>>i&1 == 1
+			a, b := m.size-11+i%3, i/3
+			m.set(b, a, dark)
+			m.set(a, b, dark)
+		}
+	}
+}
+
+// drawFormat writes the error correction level (M) and mask, twice
+func (m *matrix) drawFormat(mask int) {
+	data := 0b00<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		m.set(i, 8, bit(i))
+	}
+	m.set(7, 8, bit(6))
+	m.set(8, 8, bit(7))
+	m.set(8, 7, bit(8))
+	for i := 9; i < 15; i++ {
+		m.set(8, 14-i, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		m.set(8, m.size-1-i, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		m.set(m.size-15+i, 8, bit(i))
+	}
+	m.set(m.size-8, 8, true) // dark module
+}
+
+// drawData places codewords in the zigzag order of the standard, upwards
+// and downwards in two-module columns from the bottom right
+func (m *matrix) drawData(codewords []byte) {
+	i := 0
+	for right := m.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < m.size; vert++ {
+			row := vert
+			if upward {
+				row = m.size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				col := right - j
+				if m.function[row][col] || i >= len(codewords)*8 {
+					continue
+				}
+				m.dark[row][col] = codewords[i/8]>>(7-i%8)&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+func (m *matrix) applyMask(mask int) {
+	for r := 0; r < m.size; r++ {
+		for c := 0; c < m.size; c++ {
+			if m.function[r][c] {
+				continue
+			}
+			var flip bool
+			switch mask {
+			case 0:
+				flip = (r+c)%2 == 0
+			case 1:
+				flip = r%2 == 0
+			case 2:
+				flip = c%3 == 0
+			case 3:
+				flip = (r+c)%3 == 0
+			case 4:
+				flip = (r/2+c/3)%2 == 0
+			case 5:
+				flip = r*c%2+r*c%3 == 0
+			case 6:
+				flip = (r*c%2+r*c%3)%2 == 0
+			case 7:
+				flip = ((r+c)%2+r*c%3)%2 == 0
+			}
+			if flip {
+				m.dark[r][c] = !m.dark[r][c]
+			}
+		}
+	}
+}
+
+// penalty scores a masked code by the four rules of the standard; the
+// mask with the lowest score is used
+func (m *matrix) penalty() int {
+	at := func(r, c int, transpose bool) bool {
+		if transpose {
+			return m.dark[c][r]
+		}
+		return m.dark[r][c]
+	}
+
+	score := 0
+	finderLike := []bool{true, false, true, true, true, false, true}
+	for _, transpose := range []bool{false, true} {
+		for r := 0; r < m.size; r++ {
+			// Rule 1: runs of five or more modules of one colour
+			run := 1
+			for c := 1; c <= m.size; c++ {
+				if c < m.size && at(r, c, transpose) == at(r, c-1, transpose) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					score += 3 + run - 5
+				}
+				run = 1
+			}
+
+			// Rule 3: finder-like patterns with four light modules on either side
+			for c := 0; c+7 <= m.size; c++ {
+				match := true
+				for k, dark := range finderLike {
+					if at(r, c+k, transpose) != dark {
+						match = false
+						break
+					}
+				}
+				if match && (m.lightRun(r, c-4, c, transpose) || m.lightRun(r, c+7, c+11, transpose)) {
+					score += 40
+				}
+			}
+		}
+	}
+
+	// Rule 2: 2×2 blocks of one colour
+	dark := 0
+	for r := 0; r < m.size; r++ {
+		for c := 0; c < m.size; c++ {
+			if m.dark[r][c] {
+				dark++
+			}
+			if r+1 < m.size && c+1 < m.size {
+				d := m.dark[r][c]
+				if m.dark[r][c+1] == d && m.dark[r+1][c] == d && m.dark[r+1][c+1] == d {
+					score += 3
+				}
+			}
+		}
+	}
+
+	// Rule 4: balance of dark and light modules
+	percent := dark * 100 / (m.size * m.size)
+	score += abs(percent-50) / 5 * 10
+	return score
+}
+
+// lightRun reports whether modules from..to-1 of a row (or column) are all
+// light. Modules outside the code count as light.
+func (m *matrix) lightRun(r, from, to int, transpose bool) bool {
+	for c := from; c < to; c++ {
+		if c < 0 || c >= m.size {
+			continue
+		}
+		if (transpose && m.dark[c][r]) || (!transpose && m.dark[r][c]) {
+			return false
+		}
+	}
+	return true
+}
+
+// quietZone is the light border required around a code, in modules
+const quietZone = 4
+
+// PNG renders the code with each module scale pixels wide
+func (c *Code) PNG(scale int) ([]byte, error) {
+	side := (c.Size + 2*quietZone) * scale
+	img := image.NewPaletted(image.Rect(0, 0, side, side), color.Palette{color.White, color.Black})
+	for r, row := range c.Modules {
+		for col, dark := range row {
+			if !dark {
+				continue
+			}
+			for y := 0; y < scale; y++ {
+				for x := 0; x < scale; x++ {
+					img.SetColorIndex((col+quietZone)*scale+x, (r+quietZone)*scale+y, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,120 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/png"
+	"testing"
+
+	"rsc.io/qr/coding"
+)
+
+// payload returns a UPI link padded to n bytes
+func payload(n int) string {
+	s := "upi://pay?pa=shop@okbank&pn=print+shop&am=24.00&tn=job+31&tr="
+	for len(s) < n {
+		s += "0123456789abcdef"
+	}
+	return s[:n]
+}
+
+// mask reads the mask number back out of the code's second copy of the format information
+func mask(c *Code) int {
+	bits := 0
+	for i := 0; i < 8; i++ {
+		if c.Modules[8][c.Size-1-i] {
+			bits |= 1 << i
+		}
+	}
+	for i := 8; i < 15; i++ {
+		if c.Modules[c.Size-15+i][8] {
+			bits |= 1 << i
+		}
+	}
+	return (bits ^ 0x5412) >> 10 & 7
+}
+
+// TestEncodeMatchesReference checks every module against rsc.io/qr built
+// with the same version, level M and mask. Lengths are chosen at the edges
+// of versions, on both sides of the switch to 16 bit counts at version 10.
+func TestEncodeMatchesReference(t *testing.T) {
+	tests := []struct {
+		length, version int
+	}{
+		{1, 1},
+		{14, 1},
+		{15, 2},
+		{122, 7},
+		{123, 8},
+		{180, 9},
+		{181, 10},
+		{250, 11},
+		{331, 13},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%d bytes", test.length), func(t *testing.T) {
+			text := payload(test.length)
+			code, err := Encode(text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := 17 + 4*test.version; code.Size != want {
+				t.Fatalf("size %d, want %d (version %d)", code.Size, want, test.version)
+			}
+
+			plan, err := coding.NewPlan(coding.Version(test.version), coding.M, coding.Mask(mask(code)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ref, err := plan.Encode(coding.String(text))
+			if err != nil {
+				t.Fatal(err)
+			}
+			diff := 0
+			for r := 0; r < code.Size; r++ {
+				for c := 0; c < code.Size; c++ {
+					if code.Modules[r][c] != ref.Black(c, r) {
+						diff++
+					}
+				}
+			}
+			if diff > 0 {
+				t.Errorf("%d of %d modules differ from the reference (mask %d)", diff, code.Size*code.Size, mask(code))
+			}
+		})
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	for _, n := range []int{332, 1000} {
+		if _, err := Encode(payload(n)); !errors.Is(err, ErrTooLong) {
+			t.Errorf("%d bytes: %v, want ErrTooLong", n, err)
+		}
+	}
+}
+
+func TestPNG(t *testing.T) {
+	code, err := Encode(payload(40))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := code.PNG(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if side := (code.Size + 2*quietZone) * 3; img.Bounds().Dx() != side || img.Bounds().Dy() != side {
+		t.Errorf("image is %v, want %d pixels square", img.Bounds(), side)
+	}
+	// The top left module is the corner of a finder pattern
+	if r, _, _, _ := img.At(quietZone*3, quietZone*3).RGBA(); r != 0 {
+		t.Error("finder pattern corner is not dark")
+	}
+	if r, _, _, _ := img.At(0, 0).RGBA(); r == 0 {
+		t.Error("quiet zone is not light")
+	}
+}
@@ -0,0 +1,61 @@
+// Package storage stores uploaded documents behind a driver-neutral
+// interface, so that several API replicas can share uploads.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// ErrNotFound is returned when no object exists under a key
+var ErrNotFound = errors.New("object not found")
+
+// Info describes a stored object
+type Info struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Storage is a flat key/value store for documents. Keys use "/" as separator.
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Open(ctx context.Context, key string) (io.ReadCloser, Info, error)
+	Stat(ctx context.Context, key string) (Info, error)
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) ([]Info, error)
+}
+
+// Files is the storage used for uploaded documents
+var Files Storage
+
+// Init configures Files from the environment. STORAGE_DRIVER selects
+// "local" (default, under STORAGE_DIR) or "s3" (S3_ENDPOINT, S3_BUCKET,
+// S3_REGION, S3_ACCESS_KEY, S3_SECRET_KEY).
+func Init() {
+	driver := os.Getenv("STORAGE_DRIVER")
+	switch driver {
+	case "", "local":
+		dir := os.Getenv("STORAGE_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		Files = &Local{Dir: dir}
+		fmt.Printf("Storing uploads in %s\n", dir)
+	case "s3":
+		s3, err := NewS3(os.Getenv("S3_ENDPOINT"), os.Getenv("S3_BUCKET"), os.Getenv("S3_REGION"),
+			os.Getenv("S3_ACCESS_KEY"), os.Getenv("S3_SECRET_KEY"))
+		if err != nil {
+			log.Fatalf("Invalid S3 storage configuration: %v", err)
+		}
+		Files = s3
+		fmt.Printf("Storing uploads in S3 bucket %s\n", os.Getenv("S3_BUCKET"))
+	default:
+		log.Fatalf("Unknown STORAGE_DRIVER %q", driver)
+	}
+}
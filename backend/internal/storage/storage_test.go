@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testConformance checks that a driver behaves as the Storage interface
+// promises. Objects are created under prefix and removed afterwards.
+func testConformance(t *testing.T, s Storage, prefix string) {
+	ctx := context.Background()
+	t.Cleanup(func() {
+		objects, _ := s.List(ctx, prefix)
+		for _, o := range objects {
+			s.Delete(ctx, o.Key)
+		}
+	})
+
+	missing := prefix + "missing.pdf"
+	if _, err := s.Stat(ctx, missing); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat of a missing object: %v, want ErrNotFound", err)
+	}
+	if _, _, err := s.Open(ctx, missing); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open of a missing object: %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, missing); err != nil {
+		t.Errorf("Delete of a missing object: %v", err)
+	}
+	if objects, err := s.List(ctx, prefix); err != nil || len(objects) != 0 {
+		t.Errorf("List of an empty prefix: %v, %v", objects, err)
+	}
+
+	objects := map[string][]byte{
+		prefix + "a/one.pdf":                 []byte("%PDF-1.7 one"),
+		prefix + "a/two words + symbols.pdf": []byte("%PDF-1.7 two"),
+		prefix + "b/large.pdf":               bytes.Repeat([]byte("0123456789abcdef"), 1<<16),
+		prefix + "empty.pdf":                 {},
+	}
+	for key, data := range objects {
+		if err := s.Put(ctx, key, bytes.NewReader(data)); err != nil {
+			t.Fatalf("Put %s: %v", key, err)
+		}
+	}
+
+	for key, data := range objects {
+		info, err := s.Stat(ctx, key)
+		if err != nil {
+			t.Errorf("Stat %s: %v", key, err)
+			continue
+		}
+		if info.Key != key || info.Size != int64(len(data)) || info.ModTime.IsZero() {
+			t.Errorf("Stat %s: %+v, want size %d", key, info, len(data))
+		}
+		if time.Since(info.ModTime) > time.Hour || time.Until(info.ModTime) > time.Hour {
+			t.Errorf("Stat %s: modified %v", key, info.ModTime)
+		}
+
+		r, info, err := s.Open(ctx, key)
+		if err != nil {
+			t.Errorf("Open %s: %v", key, err)
+			continue
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("Open %s: read %d bytes, %v; want the %d stored", key, len(got), err, len(data))
+		}
+		if info.Size != int64(len(data)) {
+			t.Errorf("Open %s: size %d, want %d", key, info.Size, len(data))
+		}
+	}
+
+	// Put replaces an object
+	replaced := prefix + "a/one.pdf"
+	objects[replaced] = []byte("%PDF-1.7 replaced")
+	if err := s.Put(ctx, replaced, bytes.NewReader(objects[replaced])); err != nil {
+		t.Fatal(err)
+	}
+	if r, _, err := s.Open(ctx, replaced); err != nil {
+		t.Error(err)
+	} else {
+		got, _ := io.ReadAll(r)
+		r.Close()
+		if !bytes.Equal(got, objects[replaced]) {
+			t.Errorf("Open after replacing: %q", got)
+		}
+	}
+
+	list := func(prefix string) []string {
+		t.Helper()
+		infos, err := s.List(ctx, prefix)
+		if err != nil {
+			t.Fatalf("List %s: %v", prefix, err)
+		}
+		var keys []string
+		for _, info := range infos {
+			keys = append(keys, info.Key)
+			if data, ok := objects[info.Key]; ok && info.Size != int64(len(data)) {
+				t.Errorf("List %s: %s has size %d, want %d", prefix, info.Key, info.Size, len(data))
+			}
+		}
+		slices.Sort(keys)
+		return keys
+	}
+	var all []string
+	for key := range objects {
+		all = append(all, key)
+	}
+	slices.Sort(all)
+	if got := list(prefix); !slices.Equal(got, all) {
+		t.Errorf("List everything: %q, want %q", got, all)
+	}
+	if got, want := list(prefix+"a/"), []string{prefix + "a/one.pdf", prefix + "a/two words + symbols.pdf"}; !slices.Equal(got, want) {
+		t.Errorf("List a/: %q, want %q", got, want)
+	}
+
+	// Delete removes exactly one object
+	if err := s.Delete(ctx, replaced); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Stat(ctx, replaced); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat after Delete: %v, want ErrNotFound", err)
+	}
+	if got := list(prefix + "a/"); !slices.Equal(got, []string{prefix + "a/two words + symbols.pdf"}) {
+		t.Errorf("List a/ after Delete: %q", got)
+	}
+}
+
+func TestLocal(t *testing.T) {
+	local := &Local{Dir: t.TempDir()}
+	t.Run("conformance", func(t *testing.T) {
+		testConformance(t, local, "uploads/")
+	})
+
+	ctx := context.Background()
+	for _, key := range []string{"", ".", "../escape.pdf", "a/../../escape.pdf", "/etc/passwd"} {
+		if err := local.Put(ctx, key, strings.NewReader("x")); err == nil {
+			t.Errorf("Put %q outside the storage directory succeeded", key)
+		}
+	}
+
+	// A partial upload is never listed
+	if err := os.WriteFile(local.Dir+"/uploads/.upload-123", []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if objects, _ := local.List(ctx, ""); len(objects) != 0 {
+		t.Errorf("List shows %v", objects)
+	}
+}
+
+// TestS3 runs against a real bucket when S3_TEST_ENDPOINT, S3_TEST_BUCKET,
+// S3_TEST_ACCESS_KEY and S3_TEST_SECRET_KEY (and optionally S3_TEST_REGION)
+// are set, for example a local MinIO:
+//
+//	S3_TEST_ENDPOINT=http://localhost:9000 S3_TEST_BUCKET=test \
+//	S3_TEST_ACCESS_KEY=minioadmin S3_TEST_SECRET_KEY=minioadmin go test ./internal/storage
+func TestS3(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT not set")
+	}
+	s3, err := NewS3(endpoint, os.Getenv("S3_TEST_BUCKET"), os.Getenv("S3_TEST_REGION"),
+		os.Getenv("S3_TEST_ACCESS_KEY"), os.Getenv("S3_TEST_SECRET_KEY"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testConformance(t, s3, fmt.Sprintf("conformance-%d/", time.Now().UnixNano()))
+}
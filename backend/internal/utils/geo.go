@@ -0,0 +1,29 @@
+package utils
+
+import "math"
+
+// EarthRadiusKm is the mean Earth radius used for all distances
+const EarthRadiusKm = 6371
+
+// BoundingBox returns the latitude and longitude ranges that contain every
+// point within radiusKm of (lat, long). Near the poles, or when the box
+// would cross the antimeridian, the full longitude range is returned.
+func BoundingBox(lat, long, radiusKm float64) (minLat, minLong, maxLat, maxLong float64) {
+	dLat := radiusKm / EarthRadiusKm * 180 / math.Pi
+	minLat = math.Max(lat-dLat, -90)
+	maxLat = math.Min(lat+dLat, 90)
+
+	if minLat == -90 || maxLat == 90 {
+		return minLat, -180, maxLat, 180
+	}
+
+	// The box is widest in longitude at the latitude furthest from the equator
+	widest := math.Max(math.Abs(minLat), math.Abs(maxLat))
+	dLong := dLat / math.Cos(widest*math.Pi/180)
+	minLong = long - dLong
+	maxLong = long + dLong
+	if minLong < -180 || maxLong > 180 {
+		return minLat, -180, maxLat, 180
+	}
+	return minLat, minLong, maxLat, maxLong
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"backend/internal/models"
+)
+
+// GSTRates are the GST rates in percent a price card may charge
+var GSTRates = []int{0, 5, 12, 18, 28, 40}
+
+// gstinPattern matches a GSTIN: state code, PAN, entity number, "Z" and a check character
+var gstinPattern = regexp.MustCompile(`^[0-9]{2}[A-Z]{5}[0-9]{4}[A-Z][1-9A-Z]Z[0-9A-Z]$`)
+
+// gstinChars are the base-36 digits of the GSTIN check character
+const gstinChars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// ValidGSTIN reports whether s is a well-formed GSTIN with a correct check character
+func ValidGSTIN(s string) bool {
+	if !gstinPattern.MatchString(s) {
+		return false
+	}
+	sum := 0
+	for i, c := range s[:14] {
+		product := strings.IndexRune(gstinChars, c) * (i%2 + 1)
+		sum += product/36 + product%36
+	}
+	return s[14] == gstinChars[(36-sum%36)%36]
+}
+
+// ValidGSTRate reports whether rate is a GST rate a price card may charge
+func ValidGSTRate(rate int) bool {
+	return slices.Contains(GSTRates, rate)
+}
+
+// ValidateBillingDetails tidies a customer's billing details and checks the GSTIN
+func ValidateBillingDetails(req *models.BillingDetails) error {
+	req.Name = strings.TrimSpace(req.Name)
+	req.GSTIN = strings.ToUpper(strings.TrimSpace(req.GSTIN))
+	if req.GSTIN != "" && !ValidGSTIN(req.GSTIN) {
+		return fmt.Errorf("invalid GSTIN %q", req.GSTIN)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"fmt"
+
+	"backend/internal/models"
+	"backend/internal/money"
+)
+
+// PaperSizes are the paper sizes jobs can be printed on
+var PaperSizes = []string{"A4", "A3", "Letter", "Legal"}
+
+// DefaultPriceCard returns the card used for jobs that are not sent to a shop
+// with a published price card: ₹1 per page for every combination.
+func DefaultPriceCard() *models.PriceCard {
+	var rates []models.PriceRate
+	for _, paperSize := range PaperSizes {
+		for _, colorMode := range []string{"bw", "color"} {
+			for _, printMode := range []string{"single", "double"} {
+				rates = append(rates, models.PriceRate{
+					PaperSize: paperSize,
+					ColorMode: colorMode,
+					PrintMode: printMode,
+					PerPage:   money.Rupee,
+				})
+			}
+		}
+	}
+	return &models.PriceCard{Rates: rates}
+}
+
+// FindRate returns the per-page rate on the card for the given job settings
+func FindRate(card *models.PriceCard, paperSize, colorMode, printMode string) (money.Paise, bool) {
+	for _, rate := range card.Rates {
+		if rate.PaperSize == paperSize && rate.ColorMode == colorMode && rate.PrintMode == printMode {
+			return rate.PerPage, true
+		}
+	}
+	return 0, false
+}
+
+// ErrCostTooLarge is returned for jobs whose cost cannot be stored
+var ErrCostTooLarge = fmt.Errorf("job cost exceeds %s", money.MaxAmount.Format())
+
+// CalculateCost prices a job against a price card.
+// Cost formula: Pages × Copies × per-page rate + per-job fee, raised to the
+// card's minimum order. Rates are whole paise, so the cost is exact. Costs
+// above money.MaxAmount, which would not fit the files table, are rejected
+// with ErrCostTooLarge before they can overflow.
+func CalculateCost(card *models.PriceCard, pages, copies int, paperSize, colorMode, printMode string) (money.Paise, error) {
+	rate, ok := FindRate(card, paperSize, colorMode, printMode)
+	if !ok {
+		return 0, fmt.Errorf("no rate for %s %s %s printing", paperSize, colorMode, printMode)
+	}
+	if pages < 0 || copies < 0 {
+		return 0, fmt.Errorf("pages and copies must not be negative")
+	}
+
+	cost := card.PerJobFee
+	if rate > 0 && copies > 0 {
+		if int64(pages) > int64(money.MaxAmount/rate)/int64(copies) {
+			return 0, ErrCostTooLarge
+		}
+		cost += money.Paise(pages*copies) * rate
+	}
+	if cost > money.MaxAmount {
+		return 0, ErrCostTooLarge
+	}
+	return max(cost, card.MinOrder), nil
+}
+
+// ValidatePriceCard checks that a card submitted by a shopkeeper is usable
+func ValidatePriceCard(card *models.PriceCard) error {
+	if len(card.Rates) == 0 {
+		return fmt.Errorf("price card must contain at least one rate")
+	}
+	if card.MinOrder < 0 || card.PerJobFee < 0 {
+		return fmt.Errorf("min_order and per_job_fee must not be negative")
+	}
+	if !ValidGSTRate(card.GSTRate) {
+		return fmt.Errorf("gst_rate must be one of %v", GSTRates)
+	}
+
+	seen := make(map[string]bool)
+	for _, rate := range card.Rates {
+		if rate.PaperSize == "" {
+			return fmt.Errorf("rate is missing paper_size")
+		}
+		if rate.ColorMode != "bw" && rate.ColorMode != "color" {
+			return fmt.Errorf("invalid color_mode %q", rate.ColorMode)
+		}
+		if rate.PrintMode != "single" && rate.PrintMode != "double" {
+			return fmt.Errorf("invalid print_mode %q", rate.PrintMode)
+		}
+		if rate.PerPage < 0 {
+			return fmt.Errorf("per_page rate must not be negative")
+		}
+		key := rate.PaperSize + "/" + rate.ColorMode + "/" + rate.PrintMode
+		if seen[key] {
+			return fmt.Errorf("duplicate rate for %s", key)
+		}
+		seen[key] = true
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+
+	"backend/internal/money"
+)
+
+func TestCalculateCost(t *testing.T) {
+	card := DefaultPriceCard()
+	card.PerJobFee = money.Rupees(5)
+	card.MinOrder = money.Rupees(10)
+
+	tests := []struct {
+		name          string
+		pages, copies int
+		want          money.Paise
+		err           error
+	}{
+		{"raised to the minimum order", 2, 1, money.Rupees(10), nil},
+		{"pages × copies × rate + fee", 10, 3, money.Rupees(35), nil},
+		{"largest storable cost", 99_999_994, 1, money.MaxAmount - 99, nil},
+		{"above the column's range", 99_999_995, 1, 0, ErrCostTooLarge},
+		{"overflows int64", 1 << 40, 1 << 30, 0, ErrCostTooLarge},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cost, err := CalculateCost(card, test.pages, test.copies, "A4", "bw", "single")
+			if !errors.Is(err, test.err) || cost != test.want {
+				t.Errorf("CalculateCost = %s, %v; want %s, %v", cost, err, test.want, test.err)
+			}
+		})
+	}
+
+	if _, err := CalculateCost(card, 1, 1, "A5", "bw", "single"); err == nil {
+		t.Error("priced a paper size the card has no rate for")
+	}
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"math"
+	"sort"
+
+	"backend/internal/models"
+)
+
+// recommendationFactors are the parts of a recommendation score. Weights sum
+// to 1. For distance, queue and wait, halfAt is the value at which the
+// factor's score drops to one half.
+var recommendationFactors = []struct {
+	name   string
+	weight float64
+	halfAt float64
+}{
+	{"distance", 0.30, 2}, // km
+	{"queue", 0.15, 5},    // jobs ahead
+	{"wait", 0.20, 15},    // minutes
+	{"price", 0.25, 0},    // scored against the cheapest quote
+	{"open", 0.10, 0},     // 1 if open now, else 0
+}
+
+// RankShops scores every shop that can print the job, fills in the score
+// breakdown and sorts the shops best first. Shops that cannot print the job
+// are left unscored at the end, nearest first.
+func RankShops(recs []models.ShopRecommendation) {
+	cheapest := math.Inf(1)
+	for _, rec := range recs {
+		if rec.Available {
+			cheapest = math.Min(cheapest, rec.TotalCost.InRupees())
+		}
+	}
+
+	for i := range recs {
+		rec := &recs[i]
+		if !rec.Available {
+			continue
+		}
+
+		rec.Breakdown = nil
+		rec.Score = 0
+		for _, f := range recommendationFactors {
+			var value, score float64
+			switch f.name {
+			case "distance":
+				value = rec.Distance
+			case "queue":
+				value = float64(rec.QueueJobs)
+			case "wait":
+				value = float64(rec.EstimatedWaitMinutes)
+			case "price":
+				value, score = rec.TotalCost.InRupees(), 1
+				if value > 0 {
+					score = cheapest / value
+				}
+			case "open":
+				if rec.Open {
+					value, score = 1, 1
+				}
+			}
+			if f.halfAt > 0 {
+				score = 1 / (1 + value/f.halfAt)
+			}
+
+			points := score * f.weight * 100
+			rec.Score += points
+			rec.Breakdown = append(rec.Breakdown, models.ScoreFactor{
+				Factor: f.name,
+				Value:  round2(value),
+				Score:  round2(score),
+				Weight: f.weight,
+				Points: round2(points),
+			})
+		}
+		rec.Score = round2(rec.Score)
+	}
+
+	sort.SliceStable(recs, func(i, j int) bool {
+		a, b := recs[i], recs[j]
+		if a.Available != b.Available {
+			return a.Available
+		}
+		if a.Available && a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.Distance < b.Distance
+	})
+
+	for i := range recs {
+		if recs[i].Available {
+			recs[i].Rank = i + 1
+		}
+	}
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
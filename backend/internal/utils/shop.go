@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"backend/internal/models"
+)
+
+// DefaultTimezone is used for shops that have not set one
+const DefaultTimezone = "Asia/Kolkata"
+
+// weekdays are the day names used in opening hours, indexed by time.Weekday
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ValidateCapabilities checks a shop's capabilities and removes duplicate paper sizes
+func ValidateCapabilities(caps *models.ShopCapabilities) error {
+	if len(caps.PaperSizes) == 0 {
+		return fmt.Errorf("paper_sizes must list at least one paper size")
+	}
+	var sizes []string
+	for _, size := range caps.PaperSizes {
+		if !slices.Contains(PaperSizes, size) {
+			return fmt.Errorf("unsupported paper size %q", size)
+		}
+		if !slices.Contains(sizes, size) {
+			sizes = append(sizes, size)
+		}
+	}
+	caps.PaperSizes = sizes
+	return nil
+}
+
+// CanPrint reports why a shop with the given capabilities cannot print a job
+// with these settings, or nil if it can
+func CanPrint(caps models.ShopCapabilities, paperSize, colorMode, printMode string) error {
+	if !slices.Contains(caps.PaperSizes, paperSize) {
+		return fmt.Errorf("shop does not print on %s paper", paperSize)
+	}
+	if colorMode == "color" && !caps.Color {
+		return fmt.Errorf("shop does not print in color")
+	}
+	if printMode == "double" && !caps.Duplex {
+		return fmt.Errorf("shop does not print double-sided")
+	}
+	return nil
+}
+
+// validClock reports whether s is an "HH:MM" time of day
+func validClock(s string) bool {
+	_, err := time.Parse("15:04", s)
+	return err == nil && len(s) == 5
+}
+
+// ValidateShopProfile checks the UPI ID, GSTIN, timezone, opening hours and
+// holidays of a shop profile, filling in the default timezone
+func ValidateShopProfile(req *models.ShopProfileRequest) error {
+	if err := ValidateCapabilities(&req.ShopCapabilities); err != nil {
+		return err
+	}
+
+	req.DisplayName = strings.TrimSpace(req.DisplayName)
+	req.UPIVPA = strings.TrimSpace(req.UPIVPA)
+	if req.UPIVPA != "" && !ValidVPA(req.UPIVPA) {
+		return fmt.Errorf("invalid UPI ID %q, use name@bank", req.UPIVPA)
+	}
+	req.GSTIN = strings.ToUpper(strings.TrimSpace(req.GSTIN))
+	if req.GSTIN != "" && !ValidGSTIN(req.GSTIN) {
+		return fmt.Errorf("invalid GSTIN %q", req.GSTIN)
+	}
+	if req.Timezone == "" {
+		req.Timezone = DefaultTimezone
+	}
+	if _, err := time.LoadLocation(req.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", req.Timezone)
+	}
+
+	for _, h := range req.OpeningHours {
+		if !slices.Contains(weekdays, h.Day) {
+			return fmt.Errorf("invalid day %q, use mon, tue, wed, thu, fri, sat or sun", h.Day)
+		}
+		if !validClock(h.Open) || (!validClock(h.Close) && h.Close != "24:00") {
+			return fmt.Errorf("opening hours must be HH:MM")
+		}
+		if h.Open >= h.Close {
+			return fmt.Errorf("opening hours on %s close before they open", h.Day)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, holiday := range req.Holidays {
+		if _, err := time.Parse("2006-01-02", holiday.Date); err != nil {
+			return fmt.Errorf("invalid holiday date %q, use YYYY-MM-DD", holiday.Date)
+		}
+		if seen[holiday.Date] {
+			return fmt.Errorf("duplicate holiday %s", holiday.Date)
+		}
+		seen[holiday.Date] = true
+	}
+	return nil
+}
+
+// IsOpen reports whether a shop is open at the given instant. Holidays are
+// matched against the date in the shop's timezone. A shop without opening
+// hours is always open except on holidays.
+func IsOpen(timezone string, hours []models.OpeningHours, holidays []string, now time.Time) bool {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+
+	if slices.Contains(holidays, local.Format("2006-01-02")) {
+		return false
+	}
+	if len(hours) == 0 {
+		return true
+	}
+
+	day := weekdays[local.Weekday()]
+	clock := local.Format("15:04")
+	for _, h := range hours {
+		if h.Day == day && h.Open <= clock && clock < h.Close {
+			return true
+		}
+	}
+	return false
+}
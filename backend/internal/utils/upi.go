@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"backend/internal/money"
+)
+
+// vpaPattern matches a UPI virtual payment address such as "shop@okaxis"
+var vpaPattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{2,256}@[a-zA-Z][a-zA-Z0-9]{1,63}$`)
+
+// ValidVPA reports whether s is a well-formed UPI ID
+func ValidVPA(s string) bool {
+	return vpaPattern.MatchString(s)
+}
+
+// upiEscape escapes a UPI URI parameter. UPI apps expect spaces as %20, not
+// "+", and the "@" of a UPI ID as it is.
+func upiEscape(s string) string {
+	return strings.NewReplacer("+", "%20", "%40", "@").Replace(url.QueryEscape(s))
+}
+
+// UPIPaymentURI returns a UPI deep link ("upi://pay?...") asking for amount
+// to be paid to vpa, with note as the transaction note
+func UPIPaymentURI(vpa, payee string, amount money.Paise, note string) string {
+	return "upi://pay?pa=" + upiEscape(vpa) +
+		"&pn=" + upiEscape(payee) +
+		"&am=" + amount.String() +
+		"&cu=INR" +
+		"&tn=" + upiEscape(note)
+}
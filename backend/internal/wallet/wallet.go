@@ -0,0 +1,209 @@
+// Package wallet moves money between customer and shop wallets. Every
+// movement is a ledger transaction of entries that sum to zero, recorded in
+// the same database transaction that updates the balances.
+package wallet
+
+import (
+	"context"
+	"errors"
+
+	"backend/internal/money"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Kind is the reason for a ledger transaction
+type Kind string
+
+const (
+	TopUp         Kind = "topup"          // money added to a customer wallet from outside
+	JobPayment    Kind = "job_payment"    // customer pays for a job into escrow
+	JobSettlement Kind = "job_settlement" // escrow pays the shop that printed the job
+	JobRefund     Kind = "job_refund"     // escrow returns a job payment to the customer
+)
+
+// System accounts. They keep no balance, so posting to them takes no lock
+// and jobs at different shops never wait on each other.
+const (
+	escrow  = "escrow"  // payments for jobs that have not been printed yet
+	topups  = "topups"  // money received outside the app, such as cash at a counter
+	gateway = "gateway" // money received through the online payment gateway
+)
+
+// ErrInsufficientFunds is returned when a wallet balance would go negative
+var ErrInsufficientFunds = errors.New("insufficient wallet balance")
+
+// account is a row of wallet_accounts
+type account struct {
+	id     int
+	system bool
+}
+
+// transfer moves amount from one account to another as one ledger transaction
+type transfer struct {
+	kind      Kind
+	fileID    *int
+	memo      string
+	createdBy int
+	from, to  account
+	amount    money.Paise
+}
+
+// userAccount returns the wallet account of a user, creating it if needed
+func userAccount(ctx context.Context, tx pgx.Tx, userID int) (account, error) {
+	var a account
+	err := tx.QueryRow(ctx,
+		`INSERT INTO wallet_accounts (user_id, balance) VALUES ($1, 0)
+		 ON CONFLICT (user_id) DO UPDATE SET user_id = EXCLUDED.user_id
+		 RETURNING id`, userID).Scan(&a.id)
+	return a, err
+}
+
+func systemAccount(ctx context.Context, tx pgx.Tx, name string) (account, error) {
+	a := account{system: true}
+	err := tx.QueryRow(ctx, "SELECT id FROM wallet_accounts WHERE system = $1", name).Scan(&a.id)
+	return a, err
+}
+
+// adjust changes the balance of a user account and returns the new balance;
+// system accounts are left alone. The row stays locked until tx ends, so
+// concurrent payments from one wallet are applied one at a time and each
+// sees the balance left by the one before.
+func adjust(ctx context.Context, tx pgx.Tx, a account, delta money.Paise) (*money.Paise, error) {
+	if a.system {
+		return nil, nil
+	}
+	var balance money.Paise
+	err := tx.QueryRow(ctx,
+		`UPDATE wallet_accounts SET balance = balance + $2
+		 WHERE id = $1 AND balance + $2 >= 0
+		 RETURNING balance`, a.id, delta).Scan(&balance)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrInsufficientFunds
+	}
+	return &balance, err
+}
+
+// post records a transfer in the ledger and updates both balances
+func post(ctx context.Context, tx pgx.Tx, t transfer) error {
+	amount := t.amount
+	if amount <= 0 {
+		return nil
+	}
+
+	// Debit first, so an overdrawn wallet fails before anything is written
+	fromBalance, err := adjust(ctx, tx, t.from, -amount)
+	if err != nil {
+		return err
+	}
+	toBalance, err := adjust(ctx, tx, t.to, amount)
+	if err != nil {
+		return err
+	}
+
+	var memo *string
+	if t.memo != "" {
+		memo = &t.memo
+	}
+	var txID int64
+	err = tx.QueryRow(ctx,
+		`INSERT INTO ledger_transactions (kind, file_id, memo, created_by) VALUES ($1, $2, $3, $4) RETURNING id`,
+		t.kind, t.fileID, memo, t.createdBy).Scan(&txID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx,
+		`INSERT INTO ledger_entries (transaction_id, account_id, amount, balance_after)
+		 VALUES ($1, $2, $3, $4), ($1, $5, $6, $7)`,
+		txID, t.from.id, -amount, fromBalance, t.to.id, amount, toBalance)
+	return err
+}
+
+// AddFunds credits money received outside the app to a user's wallet
+func AddFunds(ctx context.Context, tx pgx.Tx, userID int, amount money.Paise, memo string, createdBy int) error {
+	customer, err := userAccount(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	source, err := systemAccount(ctx, tx, topups)
+	if err != nil {
+		return err
+	}
+	return post(ctx, tx, transfer{kind: TopUp, memo: memo, createdBy: createdBy,
+		from: source, to: customer, amount: amount})
+}
+
+// PayForJob moves a job's cost from the customer's wallet into escrow. It
+// returns ErrInsufficientFunds if the wallet cannot cover it.
+func PayForJob(ctx context.Context, tx pgx.Tx, fileID, userID int, amount money.Paise) error {
+	customer, err := userAccount(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	held, err := systemAccount(ctx, tx, escrow)
+	if err != nil {
+		return err
+	}
+	return post(ctx, tx, transfer{kind: JobPayment, fileID: &fileID, createdBy: userID,
+		from: customer, to: held, amount: amount})
+}
+
+// PayOnline records a job's online payment, received through the payment
+// gateway, in escrow. From there it is settled or refunded like a wallet payment.
+func PayOnline(ctx context.Context, tx pgx.Tx, fileID, userID int, amount money.Paise) error {
+	source, err := systemAccount(ctx, tx, gateway)
+	if err != nil {
+		return err
+	}
+	held, err := systemAccount(ctx, tx, escrow)
+	if err != nil {
+		return err
+	}
+	return post(ctx, tx, transfer{kind: JobPayment, fileID: &fileID, createdBy: userID,
+		from: source, to: held, amount: amount})
+}
+
+// Held returns how much of a job's payment is still in escrow
+func Held(ctx context.Context, tx pgx.Tx, fileID int) (money.Paise, error) {
+	var held money.Paise
+	err := tx.QueryRow(ctx,
+		`SELECT COALESCE(SUM(e.amount), 0)
+		 FROM ledger_entries e
+		 JOIN ledger_transactions t ON t.id = e.transaction_id
+		 JOIN wallet_accounts a ON a.id = e.account_id
+		 WHERE t.file_id = $1 AND a.system = $2`, fileID, escrow).Scan(&held)
+	return held, err
+}
+
+// release moves whatever a job still holds in escrow to the given user
+func release(ctx context.Context, tx pgx.Tx, kind Kind, fileID, userID, changedBy int) (money.Paise, error) {
+	held, err := Held(ctx, tx, fileID)
+	if err != nil || held <= 0 {
+		return 0, err
+	}
+	payee, err := userAccount(ctx, tx, userID)
+	if err != nil {
+		return 0, err
+	}
+	source, err := systemAccount(ctx, tx, escrow)
+	if err != nil {
+		return 0, err
+	}
+	err = post(ctx, tx, transfer{kind: kind, fileID: &fileID, createdBy: changedBy,
+		from: source, to: payee, amount: held})
+	return held, err
+}
+
+// Settle pays the shop that printed a job everything the job holds in
+// escrow and returns the amount. Jobs not paid from a wallet hold nothing.
+// The caller must hold the job's row lock, as every status change does, so
+// a job is settled or refunded at most once.
+func Settle(ctx context.Context, tx pgx.Tx, fileID, shopID, changedBy int) (money.Paise, error) {
+	return release(ctx, tx, JobSettlement, fileID, shopID, changedBy)
+}
+
+// Refund returns everything a job holds in escrow to the customer and
+// returns the amount. The caller must hold the job's row lock.
+func Refund(ctx context.Context, tx pgx.Tx, fileID, customerID, changedBy int) (money.Paise, error) {
+	return release(ctx, tx, JobRefund, fileID, customerID, changedBy)
+}
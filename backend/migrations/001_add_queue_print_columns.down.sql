@@ -0,0 +1,9 @@
+ALTER TABLE files DROP COLUMN IF EXISTS queue_position;
+ALTER TABLE files DROP COLUMN IF EXISTS shop_id;
+ALTER TABLE files DROP COLUMN IF EXISTS total_cost;
+ALTER TABLE files DROP COLUMN IF EXISTS num_pages;
+ALTER TABLE files DROP COLUMN IF EXISTS paper_size;
+ALTER TABLE files DROP COLUMN IF EXISTS color_mode;
+ALTER TABLE files DROP COLUMN IF EXISTS print_mode;
+ALTER TABLE files DROP COLUMN IF EXISTS copies;
+ALTER TABLE files DROP COLUMN IF EXISTS print_type;
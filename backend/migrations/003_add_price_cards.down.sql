@@ -0,0 +1,2 @@
+ALTER TABLE files DROP COLUMN IF EXISTS price_card_version;
+DROP TABLE IF EXISTS price_cards;
@@ -0,0 +1,14 @@
+-- Migration script to add per-shop price cards
+CREATE TABLE IF NOT EXISTS price_cards (
+    id SERIAL PRIMARY KEY,
+    shop_id INT NOT NULL REFERENCES users(id),
+    version INT NOT NULL,
+    rates JSONB NOT NULL,
+    min_order DECIMAL(10,2) DEFAULT 0,
+    per_job_fee DECIMAL(10,2) DEFAULT 0,
+    created_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE (shop_id, version)
+);
+
+-- Record which card version priced each job
+ALTER TABLE files ADD COLUMN IF NOT EXISTS price_card_version INT;
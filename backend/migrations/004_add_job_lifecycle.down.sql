@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS file_status_history;
+
+-- Fold the lifecycle statuses back into 'uploaded' and 'downloaded'
+UPDATE files SET status = 'uploaded' WHERE status IN ('queued', 'printing', 'failed');
+UPDATE files SET status = 'downloaded' WHERE status IN ('printed', 'collected', 'cancelled', 'expired');
@@ -0,0 +1,16 @@
+-- Migration script to add the job lifecycle and status history
+CREATE TABLE IF NOT EXISTS file_status_history (
+    id SERIAL PRIMARY KEY,
+    file_id INT NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    from_status TEXT,
+    to_status TEXT NOT NULL,
+    changed_by INT REFERENCES users(id),
+    note TEXT,
+    changed_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_status_history_file ON file_status_history(file_id);
+
+-- 'downloaded' is replaced by the lifecycle statuses
+UPDATE files SET status = 'collected' WHERE status = 'downloaded';
+UPDATE files SET status = 'queued' WHERE status = 'uploaded' AND print_type = 'queue' AND queue_position IS NOT NULL;
@@ -0,0 +1,14 @@
+DROP VIEW IF EXISTS queue_positions;
+DROP INDEX IF EXISTS idx_files_shop_queue;
+DROP TABLE IF EXISTS shop_queue_counters;
+
+-- Store each queued job's current position again
+ALTER TABLE files ADD COLUMN IF NOT EXISTS queue_position INT;
+UPDATE files f SET queue_position = p.position
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY shop_id ORDER BY queue_seq)::INT AS position
+    FROM files
+    WHERE print_type = 'queue' AND status IN ('queued', 'printing') AND queue_seq IS NOT NULL
+) p
+WHERE f.id = p.id;
+ALTER TABLE files DROP COLUMN IF EXISTS queue_seq;
@@ -0,0 +1,22 @@
+-- Migration script to replace stored queue positions with a per-shop sequence.
+-- Positions are computed on read by the queue_positions view.
+ALTER TABLE files ADD COLUMN IF NOT EXISTS queue_seq BIGINT;
+UPDATE files SET queue_seq = queue_position WHERE queue_seq IS NULL AND queue_position IS NOT NULL;
+ALTER TABLE files DROP COLUMN IF EXISTS queue_position;
+
+CREATE TABLE IF NOT EXISTS shop_queue_counters (
+    shop_id INT PRIMARY KEY REFERENCES users(id),
+    next_seq BIGINT NOT NULL
+);
+
+INSERT INTO shop_queue_counters (shop_id, next_seq)
+SELECT shop_id, MAX(queue_seq) FROM files WHERE shop_id IS NOT NULL AND queue_seq IS NOT NULL GROUP BY shop_id
+ON CONFLICT (shop_id) DO NOTHING;
+
+CREATE INDEX IF NOT EXISTS idx_files_shop_queue ON files(shop_id, queue_seq) WHERE status IN ('queued', 'printing');
+
+CREATE OR REPLACE VIEW queue_positions AS
+SELECT id AS file_id, shop_id,
+    ROW_NUMBER() OVER (PARTITION BY shop_id ORDER BY queue_seq)::INT AS queue_position
+FROM files
+WHERE print_type = 'queue' AND status IN ('queued', 'printing') AND queue_seq IS NOT NULL;
@@ -0,0 +1,8 @@
+CREATE OR REPLACE VIEW queue_positions AS
+SELECT id AS file_id, shop_id,
+    ROW_NUMBER() OVER (PARTITION BY shop_id ORDER BY queue_seq)::INT AS queue_position
+FROM files
+WHERE print_type = 'queue' AND status IN ('queued', 'printing') AND queue_seq IS NOT NULL;
+
+ALTER TABLE files DROP COLUMN IF EXISTS on_hold;
+ALTER TABLE files DROP COLUMN IF EXISTS queue_priority;
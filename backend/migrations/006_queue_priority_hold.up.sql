@@ -0,0 +1,10 @@
+-- Migration script to add shopkeeper queue priority and hold
+ALTER TABLE files ADD COLUMN IF NOT EXISTS queue_priority BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS on_hold BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Pinned jobs come first; held jobs have no position until resumed
+CREATE OR REPLACE VIEW queue_positions AS
+SELECT id AS file_id, shop_id,
+    ROW_NUMBER() OVER (PARTITION BY shop_id ORDER BY queue_priority DESC, queue_seq)::INT AS queue_position
+FROM files
+WHERE print_type = 'queue' AND status IN ('queued', 'printing') AND queue_seq IS NOT NULL AND NOT on_hold;
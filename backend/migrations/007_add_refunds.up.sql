@@ -0,0 +1,10 @@
+-- Migration script to record refunds for cancelled jobs
+CREATE TABLE IF NOT EXISTS refunds (
+    id SERIAL PRIMARY KEY,
+    file_id INT NOT NULL UNIQUE REFERENCES files(id),
+    user_id INT NOT NULL REFERENCES users(id),
+    amount DECIMAL(10,2) NOT NULL,
+    reason TEXT,
+    status TEXT NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMP DEFAULT NOW()
+);
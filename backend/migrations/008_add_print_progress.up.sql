@@ -0,0 +1,2 @@
+-- Migration script to store print agent progress messages
+ALTER TABLE files ADD COLUMN IF NOT EXISTS progress TEXT;
@@ -0,0 +1,2 @@
+UPDATE files SET storage_key = 'uploads/' || storage_key;
+ALTER TABLE files RENAME COLUMN storage_key TO file_path;
@@ -0,0 +1,10 @@
+-- Migration script to store documents by storage key instead of a local path.
+-- Keys are relative to the storage driver (STORAGE_DIR or the S3 bucket).
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_name = 'files' AND column_name = 'file_path') THEN
+        ALTER TABLE files RENAME COLUMN file_path TO storage_key;
+        UPDATE files SET storage_key = regexp_replace(storage_key, '^uploads[/\\]', '');
+    END IF;
+END $$;
@@ -0,0 +1,3 @@
+-- Documents stay encrypted in storage; rolling back loses their data keys
+ALTER TABLE files DROP COLUMN IF EXISTS wrapped_key;
+ALTER TABLE files DROP COLUMN IF EXISTS key_id;
@@ -0,0 +1,3 @@
+-- Migration script to store the wrapped data key of each encrypted document
+ALTER TABLE files ADD COLUMN IF NOT EXISTS key_id TEXT;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS wrapped_key BYTEA;
@@ -0,0 +1,6 @@
+ALTER TABLE users DROP COLUMN IF EXISTS shop_rejection_reason;
+ALTER TABLE users DROP COLUMN IF EXISTS shop_status;
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE users DROP COLUMN IF EXISTS suspension_reason;
+ALTER TABLE users DROP COLUMN IF EXISTS suspended_at;
+ALTER TABLE users DROP COLUMN IF EXISTS created_at;
@@ -0,0 +1,11 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS created_at TIMESTAMP DEFAULT NOW();
+
+-- Suspended users cannot log in; deleted users are kept, anonymised, for job history
+ALTER TABLE users ADD COLUMN IF NOT EXISTS suspended_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS suspension_reason TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+-- Shop registrations wait for admin approval; shops that already exist stay listed
+ALTER TABLE users ADD COLUMN IF NOT EXISTS shop_status TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS shop_rejection_reason TEXT;
+UPDATE users SET shop_status = 'approved' WHERE role = 'shopkeeper' AND shop_status IS NULL;
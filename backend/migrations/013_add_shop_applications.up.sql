@@ -0,0 +1,18 @@
+-- Business details and printer capabilities submitted with a shop registration
+CREATE TABLE IF NOT EXISTS shops (
+    user_id INT PRIMARY KEY REFERENCES users(id),
+    business_name TEXT NOT NULL,
+    contact_phone TEXT NOT NULL DEFAULT '',
+    contact_email TEXT,
+    color BOOLEAN NOT NULL DEFAULT FALSE,
+    duplex BOOLEAN NOT NULL DEFAULT FALSE,
+    paper_sizes TEXT[] NOT NULL DEFAULT '{A4}',
+    submitted_at TIMESTAMP DEFAULT NOW(),
+    reviewed_at TIMESTAMP,
+    reviewed_by INT REFERENCES users(id)
+);
+
+-- Shops registered before onboarding accepted every job, so they keep doing so
+INSERT INTO shops (user_id, business_name, color, duplex, paper_sizes)
+SELECT id, username, TRUE, TRUE, '{A4,A3,Letter,Legal}' FROM users WHERE role = 'shopkeeper'
+ON CONFLICT (user_id) DO NOTHING;
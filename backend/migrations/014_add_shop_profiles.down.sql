@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS shop_holidays;
+ALTER TABLE shops DROP COLUMN IF EXISTS opening_hours;
+ALTER TABLE shops DROP COLUMN IF EXISTS timezone;
+ALTER TABLE shops DROP COLUMN IF EXISTS display_name;
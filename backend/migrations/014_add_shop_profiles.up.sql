@@ -0,0 +1,12 @@
+-- Shop profile: display name, timezone and weekly opening hours
+ALTER TABLE shops ADD COLUMN IF NOT EXISTS display_name TEXT;
+ALTER TABLE shops ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT 'Asia/Kolkata';
+ALTER TABLE shops ADD COLUMN IF NOT EXISTS opening_hours JSONB;
+
+-- Dates a shop is closed all day
+CREATE TABLE IF NOT EXISTS shop_holidays (
+    shop_id INT NOT NULL REFERENCES users(id),
+    day DATE NOT NULL,
+    note TEXT,
+    PRIMARY KEY (shop_id, day)
+);
@@ -0,0 +1,4 @@
+-- Shop search narrows shops to a bounding box with this index before
+-- computing exact distances
+CREATE INDEX IF NOT EXISTS idx_users_shop_location ON users USING gist (point(long, lat))
+    WHERE role = 'shopkeeper';
@@ -0,0 +1,7 @@
+ALTER TABLE files DROP COLUMN IF EXISTS paid_at;
+ALTER TABLE files DROP COLUMN IF EXISTS payment_method;
+DROP TABLE IF EXISTS ledger_entries;
+DROP TABLE IF EXISTS ledger_transactions;
+DROP FUNCTION IF EXISTS ledger_check_balanced();
+DROP FUNCTION IF EXISTS ledger_append_only();
+DROP TABLE IF EXISTS wallet_accounts;
@@ -0,0 +1,71 @@
+-- Wallet accounts. Each customer and shop has one, holding a balance that
+-- is locked and updated in the same transaction as its ledger entries.
+-- System accounts (escrow for jobs paid but not yet printed, top-ups for
+-- money received from outside) keep no balance and are never locked.
+CREATE TABLE IF NOT EXISTS wallet_accounts (
+    id SERIAL PRIMARY KEY,
+    user_id INT UNIQUE REFERENCES users(id),
+    system TEXT UNIQUE,
+    balance DECIMAL(10,2) CHECK (balance >= 0),
+    created_at TIMESTAMP DEFAULT NOW(),
+    CHECK ((user_id IS NULL) <> (system IS NULL)),
+    CHECK ((user_id IS NULL) = (balance IS NULL))
+);
+
+INSERT INTO wallet_accounts (system) VALUES ('escrow'), ('topups') ON CONFLICT (system) DO NOTHING;
+
+-- Append-only double-entry ledger. Every transaction has entries that sum to zero.
+CREATE TABLE IF NOT EXISTS ledger_transactions (
+    id BIGSERIAL PRIMARY KEY,
+    kind TEXT NOT NULL,
+    file_id INT REFERENCES files(id),
+    memo TEXT,
+    created_by INT REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    id BIGSERIAL PRIMARY KEY,
+    transaction_id BIGINT NOT NULL REFERENCES ledger_transactions(id),
+    account_id INT NOT NULL REFERENCES wallet_accounts(id),
+    amount DECIMAL(10,2) NOT NULL CHECK (amount <> 0),
+    balance_after DECIMAL(10,2)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_transactions_file ON ledger_transactions(file_id) WHERE file_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_account ON ledger_entries(account_id, id);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_transaction ON ledger_entries(transaction_id);
+
+CREATE OR REPLACE FUNCTION ledger_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'ledger rows cannot be changed or deleted';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS ledger_transactions_append_only ON ledger_transactions;
+CREATE TRIGGER ledger_transactions_append_only BEFORE UPDATE OR DELETE ON ledger_transactions
+    FOR EACH ROW EXECUTE FUNCTION ledger_append_only();
+
+DROP TRIGGER IF EXISTS ledger_entries_append_only ON ledger_entries;
+CREATE TRIGGER ledger_entries_append_only BEFORE UPDATE OR DELETE ON ledger_entries
+    FOR EACH ROW EXECUTE FUNCTION ledger_append_only();
+
+-- Checked at commit, once every entry of the transaction has been inserted
+CREATE OR REPLACE FUNCTION ledger_check_balanced() RETURNS trigger AS $$
+BEGIN
+    IF (SELECT SUM(amount) FROM ledger_entries WHERE transaction_id = NEW.transaction_id) <> 0 THEN
+        RAISE EXCEPTION 'ledger transaction % does not balance', NEW.transaction_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS ledger_entries_balanced ON ledger_entries;
+CREATE CONSTRAINT TRIGGER ledger_entries_balanced AFTER INSERT ON ledger_entries
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION ledger_check_balanced();
+
+-- How a job is paid for. Cash jobs are settled at the counter; wallet jobs
+-- are paid when they are submitted.
+ALTER TABLE files ADD COLUMN IF NOT EXISTS payment_method TEXT NOT NULL DEFAULT 'cash';
+ALTER TABLE files ADD COLUMN IF NOT EXISTS paid_at TIMESTAMP;
@@ -0,0 +1,27 @@
+-- Online payments for queue jobs. A job paid online waits in
+-- pending_payment, outside the shop queue, until its payment succeeds.
+CREATE TABLE IF NOT EXISTS payment_intents (
+    id SERIAL PRIMARY KEY,
+    file_id INT NOT NULL UNIQUE REFERENCES files(id),
+    user_id INT NOT NULL REFERENCES users(id),
+    provider_payment_id TEXT NOT NULL UNIQUE,
+    amount DECIMAL(10,2) NOT NULL,
+    currency TEXT NOT NULL DEFAULT 'INR',
+    status TEXT NOT NULL DEFAULT 'created',
+    checkout_url TEXT,
+    created_at TIMESTAMP DEFAULT NOW(),
+    completed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_intents_open ON payment_intents(created_at) WHERE status = 'created';
+
+-- Webhook events already handled, so a redelivered event is applied once
+CREATE TABLE IF NOT EXISTS payment_events (
+    event_id TEXT PRIMARY KEY,
+    provider_payment_id TEXT NOT NULL,
+    type TEXT NOT NULL,
+    received_at TIMESTAMP DEFAULT NOW()
+);
+
+-- Money received through the gateway enters the ledger from this account
+INSERT INTO wallet_accounts (system) VALUES ('gateway') ON CONFLICT (system) DO NOTHING;
@@ -0,0 +1,2 @@
+-- UPI ID (virtual payment address) customers pay a shop at
+ALTER TABLE shops ADD COLUMN IF NOT EXISTS upi_vpa TEXT;
@@ -0,0 +1,6 @@
+-- Put back the rates as they were published
+UPDATE price_cards p SET rates = u.rates
+FROM price_cards_unrounded u
+WHERE u.price_card_id = p.id;
+
+DROP TABLE IF EXISTS price_cards_unrounded;
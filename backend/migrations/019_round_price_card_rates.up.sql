@@ -0,0 +1,24 @@
+-- Money is handled in whole paise. Per-page rates published with more than
+-- two decimal places are rounded to the nearest paisa, as every cost
+-- computed from them already was. Every card changed keeps its published
+-- rates in price_cards_unrounded, so the affected shops can be listed and the
+-- down migration can put them back.
+CREATE TABLE IF NOT EXISTS price_cards_unrounded (
+    price_card_id INT PRIMARY KEY REFERENCES price_cards(id) ON DELETE CASCADE,
+    rates JSONB NOT NULL,
+    rounded_at TIMESTAMP DEFAULT NOW()
+);
+
+INSERT INTO price_cards_unrounded (price_card_id, rates)
+SELECT id, rates FROM price_cards
+WHERE EXISTS (
+    SELECT 1 FROM jsonb_array_elements(rates) r
+    WHERE (r->>'per_page')::numeric <> ROUND((r->>'per_page')::numeric, 2)
+)
+ON CONFLICT (price_card_id) DO NOTHING;
+
+UPDATE price_cards SET rates = (
+    SELECT jsonb_agg(r || jsonb_build_object('per_page', ROUND((r->>'per_page')::numeric, 2)) ORDER BY n)
+    FROM jsonb_array_elements(rates) WITH ORDINALITY AS e(r, n)
+)
+WHERE id IN (SELECT price_card_id FROM price_cards_unrounded);
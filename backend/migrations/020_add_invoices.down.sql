@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS invoices;
+DROP TABLE IF EXISTS shop_invoice_counters;
+ALTER TABLE price_cards DROP COLUMN IF EXISTS gst_rate;
+ALTER TABLE shops DROP COLUMN IF EXISTS gstin;
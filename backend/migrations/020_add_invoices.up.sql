@@ -0,0 +1,34 @@
+-- GST registration of a shop. Shops without one issue bills of supply
+-- instead of tax invoices.
+ALTER TABLE shops ADD COLUMN IF NOT EXISTS gstin TEXT;
+
+-- GST rate in percent included in every price on the card
+ALTER TABLE price_cards ADD COLUMN IF NOT EXISTS gst_rate INT NOT NULL DEFAULT 0;
+
+-- Invoice numbers run consecutively per shop without gaps. The counter row
+-- is locked until the invoice that took the number commits.
+CREATE TABLE IF NOT EXISTS shop_invoice_counters (
+    shop_id INT PRIMARY KEY REFERENCES users(id),
+    next_number BIGINT NOT NULL
+);
+
+-- Invoices are issued once per job and never change. Seller and buyer
+-- details are copied so the invoice reads the same after a profile edit.
+CREATE TABLE IF NOT EXISTS invoices (
+    id SERIAL PRIMARY KEY,
+    shop_id INT NOT NULL REFERENCES users(id),
+    number BIGINT NOT NULL,
+    file_id INT NOT NULL UNIQUE REFERENCES files(id),
+    issued_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    seller_name TEXT NOT NULL,
+    seller_address TEXT,
+    seller_gstin TEXT,
+    buyer_name TEXT NOT NULL,
+    gst_rate INT NOT NULL,
+    lines JSONB NOT NULL,
+    taxable_value DECIMAL(10,2) NOT NULL,
+    cgst DECIMAL(10,2) NOT NULL,
+    sgst DECIMAL(10,2) NOT NULL,
+    total DECIMAL(10,2) NOT NULL,
+    UNIQUE (shop_id, number)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE invoices DROP COLUMN IF EXISTS buyer_gstin;
+ALTER TABLE users DROP COLUMN IF EXISTS gstin;
+ALTER TABLE users DROP COLUMN IF EXISTS billing_name;
@@ -0,0 +1,6 @@
+-- Billing details a customer may have printed on their invoices instead of
+-- the username. A registered business gives its GSTIN to claim input tax.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS billing_name TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS gstin TEXT;
+
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS buyer_gstin TEXT;
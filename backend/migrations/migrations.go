@@ -0,0 +1,8 @@
+// Package migrations embeds the numbered SQL migrations into the binary.
+// Each version has a NNN_name.up.sql file and a matching NNN_name.down.sql.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -11,6 +11,25 @@ const MapComponent = dynamic(() => import('@/components/MapComponent'), {
     loading: () => <div className="h-[400px] w-full bg-gray-200 animate-pulse rounded-xl"></div>
 });
 
+const completedStatuses = ['printed', 'collected'];
+const inactiveStatuses = ['printed', 'collected', 'cancelled', 'expired', 'failed'];
+
+const isCompleted = (status: string) => completedStatuses.includes(status);
+const isActive = (status: string) => !inactiveStatuses.includes(status);
+
+const statusLabel = (status: string) => {
+    switch (status) {
+        case 'pending_payment': return '💳 Awaiting payment';
+        case 'printing': return '🖨️ Printing';
+        case 'printed': return '✅ Ready for pickup';
+        case 'collected': return '✅ Collected';
+        case 'cancelled': return '✖️ Cancelled';
+        case 'expired': return '⌛ Expired';
+        case 'failed': return '⚠️ Failed';
+        default: return '⏳ Pending';
+    }
+};
+
 export default function DashboardPage() {
     const [file, setFile] = useState<File | null>(null);
     const [uniqueCode, setUniqueCode] = useState('');
@@ -48,6 +67,8 @@ export default function DashboardPage() {
     const [paperSize, setPaperSize] = useState('A4');
     const [printType, setPrintType] = useState<'private' | 'queue'>('private');
     const [selectedShop, setSelectedShop] = useState('');
+    const [paymentMethod, setPaymentMethod] = useState<'cash' | 'wallet' | 'online'>('cash');
+    const [walletBalance, setWalletBalance] = useState<number | null>(null);
     const [username, setUsername] = useState('');
 
     // User location
@@ -85,6 +106,7 @@ export default function DashboardPage() {
         }
 
         fetchMyFiles();
+        fetchWallet();
 
         // Refresh files every 5 seconds to update status
         const interval = setInterval(fetchMyFiles, 5000);
@@ -109,6 +131,15 @@ export default function DashboardPage() {
         }
     };
 
+    const fetchWallet = async () => {
+        try {
+            const res = await api.get('/wallet', { params: { limit: 1 } });
+            setWalletBalance(res.data.balance);
+        } catch (err) {
+            console.error('Error fetching wallet:', err);
+        }
+    };
+
     const handleUpload = async (e: React.FormEvent) => {
         e.preventDefault();
         if (!file) return;
@@ -128,6 +159,9 @@ export default function DashboardPage() {
         if (printType === 'queue') {
             formData.append('shop_id', selectedShop);
         }
+        // Online payment is only offered for queue jobs
+        const method = paymentMethod === 'online' && printType !== 'queue' ? 'cash' : paymentMethod;
+        formData.append('payment_method', method);
 
         try {
             const res = await api.post('/upload', formData);
@@ -139,7 +173,11 @@ export default function DashboardPage() {
                 setQueuePosition(res.data.queue_position);
             }
             fetchMyFiles(); // Refresh file list
+            fetchWallet();
             setFile(null); // Reset form
+            if (res.data.payment?.checkout_url) {
+                window.open(res.data.payment.checkout_url, '_blank');
+            }
         } catch (err: any) {
             alert('Upload failed: ' + (err.response?.data || err.message));
         } finally {
@@ -147,12 +185,38 @@ export default function DashboardPage() {
         }
     };
 
+    // Opens the customer's UPI app with the shop, amount and job code filled in
+    const handlePayUPI = async (fileId: number) => {
+        try {
+            const res = await api.get(`/jobs/${fileId}/upi`);
+            window.location.href = res.data.uri;
+        } catch (err: any) {
+            alert('UPI payment unavailable: ' + (err.response?.data || err.message));
+        }
+    };
+
+    // Opens the job's invoice PDF. The first download issues the invoice.
+    const handleDownloadInvoice = async (fileId: number) => {
+        try {
+            const res = await api.get(`/jobs/${fileId}/invoice`, { responseType: 'blob' });
+            window.open(window.URL.createObjectURL(res.data), '_blank');
+        } catch (err: any) {
+            alert('Invoice unavailable: ' + err.message);
+        }
+    };
+
     const [showProfileMenu, setShowProfileMenu] = useState(false);
 
     // ... (existing code)
 
-    const handleLogout = () => {
+    const handleLogout = async () => {
+        try {
+            await api.post('/logout', { refresh_token: localStorage.getItem('refresh_token') });
+        } catch (err) {
+            console.error('Logout error:', err);
+        }
         localStorage.removeItem('token');
+        localStorage.removeItem('refresh_token');
         localStorage.removeItem('role');
         localStorage.removeItem('username');
         router.push('/');
@@ -369,7 +433,7 @@ export default function DashboardPage() {
                                                 <optgroup label="--- Favorites ---" className="text-pink-600 font-bold">
                                                     {shops.filter(s => favorites.includes(s.id)).map((shop) => (
                                                         <option key={'fav-' + shop.id} value={shop.id} className="text-black font-semibold">
-                                                            ⭐ {shop.username} - {shop.distance?.toFixed(2)} km
+                                                            ⭐ {shop.display_name || shop.username} - {shop.distance?.toFixed(2)} km{shop.open === false ? ' (closed)' : ''}
                                                         </option>
                                                     ))}
                                                 </optgroup>
@@ -378,7 +442,7 @@ export default function DashboardPage() {
                                             <optgroup label="--- All Shops ---">
                                                 {shops.slice(0, 5).map((shop) => (
                                                     <option key={shop.id} value={shop.id} className="text-black">
-                                                        {favorites.includes(shop.id) ? '⭐ ' : '🏪 '} {shop.username} - {shop.distance?.toFixed(2)} km
+                                                        {favorites.includes(shop.id) ? '⭐ ' : '🏪 '} {shop.display_name || shop.username} - {shop.distance?.toFixed(2)} km{shop.open === false ? ' (closed)' : ''}
                                                     </option>
                                                 ))}
                                             </optgroup>
@@ -387,7 +451,7 @@ export default function DashboardPage() {
                                                 <optgroup label="--- More Shops ---" className="text-gray-500">
                                                     {shops.slice(5).map((shop) => (
                                                         <option key={shop.id} value={shop.id} className="text-black">
-                                                            {favorites.includes(shop.id) ? '⭐ ' : '🏪 '} {shop.username} - {shop.distance?.toFixed(2)} km
+                                                            {favorites.includes(shop.id) ? '⭐ ' : '🏪 '} {shop.display_name || shop.username} - {shop.distance?.toFixed(2)} km{shop.open === false ? ' (closed)' : ''}
                                                         </option>
                                                     ))}
                                                 </optgroup>
@@ -410,6 +474,27 @@ export default function DashboardPage() {
                                 </div>
                             )}
 
+                            {/* Payment */}
+                            <div>
+                                <label className="block text-white font-semibold mb-2">
+                                    Payment
+                                    {walletBalance !== null && (
+                                        <span className="text-purple-200 text-sm ml-2">(wallet balance ₹{walletBalance.toFixed(2)})</span>
+                                    )}
+                                </label>
+                                <select
+                                    value={paymentMethod}
+                                    onChange={(e) => setPaymentMethod(e.target.value as 'cash' | 'wallet' | 'online')}
+                                    className="w-full bg-white/20 border border-white/30 p-3 rounded-lg text-white focus:outline-none focus:ring-2 focus:ring-pink-500"
+                                >
+                                    <option value="cash" className="text-black">Cash at the shop</option>
+                                    <option value="wallet" className="text-black">Pay from wallet</option>
+                                    {printType === 'queue' && (
+                                        <option value="online" className="text-black">Pay online</option>
+                                    )}
+                                </select>
+                            </div>
+
                             {/* Submit Button */}
                             <button
                                 type="submit"
@@ -436,7 +521,7 @@ export default function DashboardPage() {
                                         </div>
                                         <div>
                                             <p className="text-purple-200 text-xs">Total Cost</p>
-                                            <p className="text-white font-bold text-lg">₹{totalCost}</p>
+                                            <p className="text-white font-bold text-lg">₹{totalCost.toFixed(2)}</p>
                                         </div>
                                     </div>
                                     <p className="text-purple-200 text-sm mb-2">Your Unique Code</p>
@@ -478,7 +563,7 @@ export default function DashboardPage() {
                                     </div>
                                     <div>
                                         <p className="text-purple-200 text-xs">Total Cost</p>
-                                        <p className="text-white font-bold text-lg">₹{totalCost}</p>
+                                        <p className="text-white font-bold text-lg">₹{totalCost.toFixed(2)}</p>
                                     </div>
                                 </div>
                                 <div className="bg-gradient-to-r from-blue-500/20 to-cyan-600/20 border border-blue-400/30 rounded-lg p-6 text-center">
@@ -538,7 +623,7 @@ export default function DashboardPage() {
                                 <p className="text-pink-200 text-sm mb-1">Total Spent</p>
                                 <h3 className="text-4xl font-bold text-white">
                                     ₹{myFiles
-                                        .filter(f => f.status === 'downloaded')
+                                        .filter(f => isCompleted(f.status))
                                         .reduce((sum, f) => sum + f.total_cost, 0).toFixed(2)}
                                 </h3>
                                 <p className="text-white/60 text-xs mt-2">Verified completed prints</p>
@@ -548,7 +633,7 @@ export default function DashboardPage() {
                                 <p className="text-yellow-200 text-sm mb-1">Pending Costs</p>
                                 <h3 className="text-4xl font-bold text-white">
                                     ₹{myFiles
-                                        .filter(f => f.status !== 'downloaded')
+                                        .filter(f => isActive(f.status))
                                         .reduce((sum, f) => sum + f.total_cost, 0).toFixed(2)}
                                 </h3>
                                 <p className="text-white/60 text-xs mt-2">Active queue/private prints</p>
@@ -622,7 +707,7 @@ export default function DashboardPage() {
                                                     </div>
                                                     <div>
                                                         <span className="text-purple-300">Cost:</span>
-                                                        <span className="text-white ml-1">₹{file.total_cost}</span>
+                                                        <span className="text-white ml-1">₹{file.total_cost.toFixed(2)}</span>
                                                     </div>
                                                 </div>
 
@@ -637,7 +722,31 @@ export default function DashboardPage() {
                                                                     <span className="text-pink-400 ml-1 font-bold">#{file.queue_position}</span>
                                                                 </>
                                                             )}
+                                                            {file.estimated_completion && (
+                                                                <>
+                                                                    <span className="text-purple-300 ml-3">Ready by:</span>
+                                                                    <span className="text-white ml-1">{new Date(file.estimated_completion).toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' })}</span>
+                                                                </>
+                                                            )}
                                                         </div>
+                                                        {file.paid_at ? (
+                                                            <span className="ml-auto text-green-300 text-xs">✅ Paid</span>
+                                                        ) : file.payment_method === 'cash' && !['cancelled', 'expired'].includes(file.status) && (
+                                                            <button
+                                                                onClick={() => handlePayUPI(file.id)}
+                                                                className="ml-auto px-3 py-1 bg-green-500/20 text-green-300 rounded-lg hover:bg-green-500/30 transition-colors flex items-center gap-1 text-xs"
+                                                            >
+                                                                ₹ Pay by UPI
+                                                            </button>
+                                                        )}
+                                                        {isCompleted(file.status) && (
+                                                            <button
+                                                                onClick={() => handleDownloadInvoice(file.id)}
+                                                                className="px-3 py-1 bg-purple-500/20 text-purple-200 rounded-lg hover:bg-purple-500/30 transition-colors flex items-center gap-1 text-xs"
+                                                            >
+                                                                🧾 Invoice
+                                                            </button>
+                                                        )}
                                                         {file.shop_lat && file.shop_long && (
                                                             <a
                                                                 href={`https://www.google.com/maps/dir/?api=1&destination=${file.shop_lat},${file.shop_long}`}
@@ -664,11 +773,11 @@ export default function DashboardPage() {
                                             </div>
 
                                             <div className="text-right">
-                                                <div className={`px-3 py-1 rounded-full text-xs font-semibold ${file.status === 'downloaded'
+                                                <div className={`px-3 py-1 rounded-full text-xs font-semibold ${isCompleted(file.status)
                                                     ? 'bg-green-500/20 text-green-300'
                                                     : 'bg-yellow-500/20 text-yellow-300'
                                                     }`}>
-                                                    {file.status === 'downloaded' ? '✅ Downloaded' : '⏳ Pending'}
+                                                    {statusLabel(file.status)}
                                                 </div>
                                             </div>
                                         </div>
@@ -726,7 +835,12 @@ export default function DashboardPage() {
                                 <div key={shop.id} className="bg-white/5 border border-white/10 rounded-xl p-6 hover:bg-white/10 transition-all">
                                     <div className="flex justify-between items-start mb-4">
                                         <div>
-                                            <h3 className="text-xl font-bold text-white">{shop.username}</h3>
+                                            <h3 className="text-xl font-bold text-white">
+                                                {shop.display_name || shop.username}
+                                                <span className={`ml-2 px-2 py-1 rounded text-xs font-bold align-middle ${shop.open ? 'bg-green-500/20 text-green-300' : 'bg-red-500/20 text-red-300'}`}>
+                                                    {shop.open ? 'OPEN' : 'CLOSED'}
+                                                </span>
+                                            </h3>
                                             <p className="text-purple-200 text-sm">{shop.distance?.toFixed(2)} km away</p>
                                         </div>
                                         <button
@@ -17,6 +17,7 @@ export default function LoginPage() {
         try {
             const res = await api.post('/login', { username, password });
             localStorage.setItem('token', res.data.token);
+            localStorage.setItem('refresh_token', res.data.refresh_token);
             localStorage.setItem('role', res.data.role);
             localStorage.setItem('username', res.data.username);
 
@@ -12,6 +12,12 @@ export default function RegisterPage() {
     const [address, setAddress] = useState('');
     const [lat, setLat] = useState(0);
     const [long, setLong] = useState(0);
+    const [businessName, setBusinessName] = useState('');
+    const [contactPhone, setContactPhone] = useState('');
+    const [contactEmail, setContactEmail] = useState('');
+    const [color, setColor] = useState(false);
+    const [duplex, setDuplex] = useState(false);
+    const [paperSizes, setPaperSizes] = useState<string[]>(['A4']);
     const [error, setError] = useState('');
     const router = useRouter();
 
@@ -19,7 +25,10 @@ export default function RegisterPage() {
         e.preventDefault();
         setError('');
         try {
-            await api.post('/register', { username, password, role, lat, long, address });
+            const shop = role === 'shopkeeper'
+                ? { business_name: businessName, contact_phone: contactPhone, contact_email: contactEmail, color, duplex, paper_sizes: paperSizes }
+                : undefined;
+            await api.post('/register', { username, password, role, lat, long, address, shop });
             router.push('/login');
         } catch (err: any) {
             console.error('Registration error:', err);
@@ -33,6 +42,10 @@ export default function RegisterPage() {
         }
     };
 
+    const togglePaperSize = (size: string) => {
+        setPaperSizes((sizes) => sizes.includes(size) ? sizes.filter((s) => s !== size) : [...sizes, size]);
+    };
+
     const getLocation = () => {
         if (navigator.geolocation) {
             navigator.geolocation.getCurrentPosition((position) => {
@@ -81,6 +94,50 @@ export default function RegisterPage() {
 
                         {role === 'shopkeeper' && (
                             <>
+                                <input
+                                    type="text"
+                                    placeholder="Shop Name"
+                                    value={businessName}
+                                    onChange={(e) => setBusinessName(e.target.value)}
+                                    className="bg-white/20 border border-white/30 p-3 rounded-lg text-white placeholder-purple-200 focus:outline-none focus:ring-2 focus:ring-pink-500"
+                                    required
+                                />
+                                <input
+                                    type="tel"
+                                    placeholder="Contact Phone"
+                                    value={contactPhone}
+                                    onChange={(e) => setContactPhone(e.target.value)}
+                                    className="bg-white/20 border border-white/30 p-3 rounded-lg text-white placeholder-purple-200 focus:outline-none focus:ring-2 focus:ring-pink-500"
+                                    required
+                                />
+                                <input
+                                    type="email"
+                                    placeholder="Contact Email (optional)"
+                                    value={contactEmail}
+                                    onChange={(e) => setContactEmail(e.target.value)}
+                                    className="bg-white/20 border border-white/30 p-3 rounded-lg text-white placeholder-purple-200 focus:outline-none focus:ring-2 focus:ring-pink-500"
+                                />
+                                <div className="text-purple-200 text-sm bg-white/10 p-3 rounded-lg flex flex-col gap-2">
+                                    <span className="font-semibold">Printer capabilities</span>
+                                    <div className="flex gap-4">
+                                        <label className="flex items-center gap-2">
+                                            <input type="checkbox" checked={color} onChange={(e) => setColor(e.target.checked)} />
+                                            Color
+                                        </label>
+                                        <label className="flex items-center gap-2">
+                                            <input type="checkbox" checked={duplex} onChange={(e) => setDuplex(e.target.checked)} />
+                                            Double-sided
+                                        </label>
+                                    </div>
+                                    <div className="flex gap-4">
+                                        {['A4', 'A3', 'Letter', 'Legal'].map((size) => (
+                                            <label key={size} className="flex items-center gap-2">
+                                                <input type="checkbox" checked={paperSizes.includes(size)} onChange={() => togglePaperSize(size)} />
+                                                {size}
+                                            </label>
+                                        ))}
+                                    </div>
+                                </div>
                                 <input
                                     type="text"
                                     placeholder="Shop Address"
@@ -101,6 +158,9 @@ export default function RegisterPage() {
                                         Location: {lat.toFixed(4)}, {long.toFixed(4)}
                                     </div>
                                 )}
+                                <p className="text-purple-200 text-sm">
+                                    Your shop is listed to customers once an admin approves it.
+                                </p>
                             </>
                         )}
 
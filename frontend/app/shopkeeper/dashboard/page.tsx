@@ -14,6 +14,7 @@ export default function ShopkeeperPage() {
     const [view, setView] = useState<'dashboard' | 'history' | 'stats'>('dashboard');
     const [history, setHistory] = useState<any[]>([]);
     const [showProfileMenu, setShowProfileMenu] = useState(false);
+    const [application, setApplication] = useState<any>(null);
 
     // New state for manual confirmation
     const [showConfirmModal, setShowConfirmModal] = useState(false);
@@ -28,6 +29,7 @@ export default function ShopkeeperPage() {
             return;
         }
         setUsername(localStorage.getItem('username') || 'Shopkeeper');
+        fetchApplication();
         fetchQueue();
         // Refresh queue every 5 seconds
         const interval = setInterval(fetchQueue, 5000);
@@ -43,6 +45,27 @@ export default function ShopkeeperPage() {
         }
     };
 
+    const fetchApplication = async () => {
+        try {
+            const res = await api.get('/shop/application');
+            setApplication(res.data);
+        } catch (err) {
+            console.error('Error fetching shop application:', err);
+        }
+    };
+
+    const resubmitApplication = async () => {
+        try {
+            await api.put('/shop/application', application);
+            setMessage('✅ Application submitted for review.');
+            setMessageType('success');
+            fetchApplication();
+        } catch (err: any) {
+            setMessage('❌ ' + (err.response?.data || 'Failed to submit application.'));
+            setMessageType('error');
+        }
+    };
+
     const fetchHistory = async () => {
         try {
             const res = await api.get('/shop/history');
@@ -151,13 +174,47 @@ export default function ShopkeeperPage() {
         setPendingPrint(null);
     };
 
+    const handleMarkPaid = async (fileId: number) => {
+        try {
+            await api.post(`/queue/${fileId}/paid`);
+            fetchQueue();
+        } catch (err: any) {
+            alert('Could not mark paid: ' + (err.response?.data || err.message));
+        }
+    };
+
+    const handleShowUPI = async (fileId: number) => {
+        try {
+            const res = await api.get(`/jobs/${fileId}/upi/qr`, { responseType: 'blob' });
+            window.open(window.URL.createObjectURL(res.data), '_blank');
+        } catch (err: any) {
+            alert('No UPI QR code: ' + (err.response?.status === 404 ? 'add your UPI ID to your shop profile' : err.message));
+        }
+    };
+
+    // Opens the job's invoice PDF. The first download issues the invoice.
+    const handleDownloadInvoice = async (fileId: number) => {
+        try {
+            const res = await api.get(`/jobs/${fileId}/invoice`, { responseType: 'blob' });
+            window.open(window.URL.createObjectURL(res.data), '_blank');
+        } catch (err: any) {
+            alert('Invoice unavailable: ' + err.message);
+        }
+    };
+
     const handlePrivatePrintSubmit = (e: React.FormEvent) => {
         e.preventDefault();
         handlePrint(code);
     };
 
-    const handleLogout = () => {
+    const handleLogout = async () => {
+        try {
+            await api.post('/logout', { refresh_token: localStorage.getItem('refresh_token') });
+        } catch (err) {
+            console.error('Logout error:', err);
+        }
         localStorage.removeItem('token');
+        localStorage.removeItem('refresh_token');
         localStorage.removeItem('role');
         router.push('/');
     };
@@ -224,6 +281,49 @@ export default function ShopkeeperPage() {
             </div>
 
             <div className="max-w-7xl mx-auto space-y-6">
+                {/* Shop Application Status */}
+                {application && application.status !== 'approved' && (
+                    <div className={`p-4 rounded-lg ${application.status === 'rejected'
+                        ? 'bg-red-500/20 border border-red-400/30 text-red-100'
+                        : 'bg-yellow-500/20 border border-yellow-400/30 text-yellow-100'
+                        }`}>
+                        {application.status === 'rejected' ? (
+                            <>
+                                <p className="font-semibold">❌ Your shop application was rejected</p>
+                                <p className="text-sm mt-1">Reason: {application.rejection_reason}</p>
+                                <div className="flex flex-col md:flex-row gap-2 mt-3">
+                                    <input
+                                        type="text"
+                                        value={application.business_name}
+                                        onChange={(e) => setApplication({ ...application, business_name: e.target.value })}
+                                        className="bg-white/20 border border-white/30 p-2 rounded-lg text-white"
+                                    />
+                                    <input
+                                        type="text"
+                                        value={application.address || ''}
+                                        onChange={(e) => setApplication({ ...application, address: e.target.value })}
+                                        className="flex-1 bg-white/20 border border-white/30 p-2 rounded-lg text-white"
+                                    />
+                                    <input
+                                        type="tel"
+                                        value={application.contact_phone}
+                                        onChange={(e) => setApplication({ ...application, contact_phone: e.target.value })}
+                                        className="bg-white/20 border border-white/30 p-2 rounded-lg text-white"
+                                    />
+                                    <button
+                                        onClick={resubmitApplication}
+                                        className="px-4 py-2 bg-gradient-to-r from-pink-500 to-purple-600 text-white font-bold rounded-lg"
+                                    >
+                                        Submit Again
+                                    </button>
+                                </div>
+                            </>
+                        ) : (
+                            <p className="font-semibold">⏳ Your shop is waiting for admin approval. Customers cannot see it yet.</p>
+                        )}
+                    </div>
+                )}
+
                 {/* Global Message */}
                 {message && (
                     <div className={`p-4 rounded-lg ${messageType === 'success'
@@ -305,7 +405,7 @@ export default function ShopkeeperPage() {
                                                         {item.type.toUpperCase()}
                                                     </span>
                                                 </td>
-                                                <td className="p-3 text-green-300 font-bold text-sm">₹{item.cost}</td>
+                                                <td className="p-3 text-green-300 font-bold text-sm">₹{item.cost.toFixed(2)}</td>
                                             </tr>
                                         ))}
                                     </tbody>
@@ -366,7 +466,16 @@ export default function ShopkeeperPage() {
                                                     </td>
                                                     <td className="p-3 text-white">{item.pages}</td>
                                                     <td className="p-3 text-white">{item.copies}</td>
-                                                    <td className="p-3 text-green-300 font-bold">₹{item.cost}</td>
+                                                    <td className="p-3 text-green-300 font-bold">
+                                                        ₹{item.cost.toFixed(2)}
+                                                        {!item.paid_at && <span className="ml-2 text-yellow-300 text-xs font-normal">unpaid</span>}
+                                                        <button
+                                                            onClick={() => handleDownloadInvoice(item.id)}
+                                                            className="ml-2 text-xs text-purple-200 font-normal underline hover:text-white"
+                                                        >
+                                                            Invoice
+                                                        </button>
+                                                    </td>
                                                 </tr>
                                             ))
                                         )}
@@ -498,7 +607,25 @@ export default function ShopkeeperPage() {
                                                     </div>
                                                 </td>
                                                 <td className="p-3">
-                                                    <p className="text-white font-bold text-lg">₹{job.total_cost}</p>
+                                                    <p className="text-white font-bold text-lg">₹{job.total_cost.toFixed(2)}</p>
+                                                    {job.paid_at ? (
+                                                        <p className="text-green-300 text-xs">✅ Paid</p>
+                                                    ) : (
+                                                        <div className="flex gap-2 mt-1">
+                                                            <button
+                                                                onClick={() => handleShowUPI(job.id)}
+                                                                className="text-xs text-purple-200 underline hover:text-white"
+                                                            >
+                                                                UPI QR
+                                                            </button>
+                                                            <button
+                                                                onClick={() => handleMarkPaid(job.id)}
+                                                                className="text-xs text-green-300 underline hover:text-white"
+                                                            >
+                                                                Mark paid
+                                                            </button>
+                                                        </div>
+                                                    )}
                                                 </td>
                                                 <td className="p-3">
                                                     <button
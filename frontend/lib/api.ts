@@ -12,4 +12,43 @@ api.interceptors.request.use((config) => {
     return config;
 });
 
+// Access tokens are short-lived. On a 401, exchange the refresh token for a
+// new pair once and retry; concurrent requests share the same refresh.
+let refreshing: Promise<string> | null = null;
+
+const refreshAccessToken = async (): Promise<string> => {
+    const refreshToken = localStorage.getItem('refresh_token');
+    if (!refreshToken) {
+        throw new Error('No refresh token');
+    }
+    const res = await axios.post(`${api.defaults.baseURL}/refresh`, { refresh_token: refreshToken });
+    localStorage.setItem('token', res.data.token);
+    localStorage.setItem('refresh_token', res.data.refresh_token);
+    return res.data.token;
+};
+
+api.interceptors.response.use(
+    (response) => response,
+    async (error) => {
+        const original = error.config;
+        if (error.response?.status !== 401 || !original || original._retried || original.url === '/login') {
+            return Promise.reject(error);
+        }
+        original._retried = true;
+
+        try {
+            refreshing = refreshing || refreshAccessToken();
+            const token = await refreshing;
+            original.headers.Authorization = `Bearer ${token}`;
+            return api(original);
+        } catch {
+            localStorage.removeItem('token');
+            localStorage.removeItem('refresh_token');
+            return Promise.reject(error);
+        } finally {
+            refreshing = null;
+        }
+    }
+);
+
 export default api;